@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// search analytics page
+func (app *application) adminSearchAnalytics(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode url query into form
+	input := &model.SearchAnalyticsInput{
+		Days: 30,
+	}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+	td.SearchAnalyticsFilter = input
+
+	// read aggregated stats from service
+	report, err := app.services.Searches.Report(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "adminsearches.gohtml", "base", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.SearchAnalytics = report
+
+	// render template response
+	app.render(w, r, http.StatusOK, "adminsearches.gohtml", "base", td)
+}
+
+// login lockouts page
+func (app *application) adminLockouts(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	throttles, err := app.services.LoginThrottles.ListLocked(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.LoginThrottles = throttles
+
+	app.render(w, r, http.StatusOK, "adminlockouts.gohtml", "base", td)
+}
+
+// unlock email or client ip hx
+func (app *application) lockoutUnlockPost(w http.ResponseWriter, r *http.Request) {
+	// parse and decode form
+	input := &model.LoginUnlockInput{}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+
+	err = app.services.LoginThrottles.Unlock(r.Context(), input)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Info("login unlocked", "scope", input.Scope, "key", input.Key, "by", app.contextGetUser(r).ID)
+
+	// 200 ok default response
+}
+
+// recently used sessions page
+func (app *application) adminSessions(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	sessions, err := app.services.Sessions.ListRecent(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.UserSessions = sessions
+
+	app.render(w, r, http.StatusOK, "adminsessions.gohtml", "base", td)
+}
+
+// sign a user out everywhere hx
+func (app *application) userSessionsRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	err = app.revokeUserSessions(r, id, false)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Info("user signed out everywhere", "user_id", id, "by", app.contextGetUser(r).ID)
+
+	// reload the list, the user may have had several sessions on it
+	w.Header().Add("HX-Redirect", "/admin/sessions")
+	w.Write([]byte("user signed out everywhere; reloading sessions"))
+}
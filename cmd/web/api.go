@@ -0,0 +1,562 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// beans
+
+// bean list api
+func (app *application) apiBeanList(w http.ResponseWriter, r *http.Request) {
+	// decode url query into filter
+	input := &model.BeanFilterInput{
+		Sort: "id_asc",
+	}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+
+	// read beans from service
+	beans, err := app.services.Beans.Find(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+	app.recordSearch(r, model.SearchKindBeans, input.Term, len(beans))
+	if app.notModified(w, r, beanListETag(beans)) {
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"beans": beans}, nil)
+}
+
+// bean view api
+func (app *application) apiBeanView(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	bean, err := app.services.Beans.Get(r.Context(), id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+	if app.notModified(w, r, beanETag(bean)) {
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"bean": bean}, nil)
+}
+
+// bean create api
+func (app *application) apiBeanCreate(w http.ResponseWriter, r *http.Request) {
+	input := &model.BeanCreateInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+
+	bean, err := app.services.Beans.Create(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/api/v1/beans/%d", bean.ID))
+
+	app.writeJSONResponse(w, r, http.StatusCreated, envelope{"bean": bean}, headers)
+}
+
+// bean update api
+func (app *application) apiBeanUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	input := &model.BeanEditInput{}
+	err = app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+	input.ID = id
+
+	version, err := app.beanIfMatch(r, id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+	if input.Version == 0 {
+		input.Version = version
+	}
+
+	bean, err := app.services.Beans.Update(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", beanETag(bean))
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"bean": bean}, headers)
+}
+
+// bean delete api
+func (app *application) apiBeanDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	_, err = app.beanIfMatch(r, id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.services.Beans.Delete(r.Context(), id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// roasters
+
+// roaster list api
+func (app *application) apiRoasterList(w http.ResponseWriter, r *http.Request) {
+	// decode url query into filter
+	input := &model.RoasterFilterInput{
+		Sort: "id_asc",
+	}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+
+	// read roasters from service
+	roasters, err := app.services.Roasters.Find(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+	app.recordSearch(r, model.SearchKindRoasters, input.Term, len(roasters))
+	if app.notModified(w, r, roasterListETag(roasters)) {
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"roasters": roasters}, nil)
+}
+
+// roaster view api
+func (app *application) apiRoasterView(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	roaster, err := app.services.Roasters.Get(r.Context(), id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+	if app.notModified(w, r, roasterETag(roaster)) {
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"roaster": roaster}, nil)
+}
+
+// roaster create api
+func (app *application) apiRoasterCreate(w http.ResponseWriter, r *http.Request) {
+	input := &model.RoasterCreateInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+
+	roaster, err := app.services.Roasters.Create(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/api/v1/roasters/%d", roaster.ID))
+
+	app.writeJSONResponse(w, r, http.StatusCreated, envelope{"roaster": roaster}, headers)
+}
+
+// roaster update api
+func (app *application) apiRoasterUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	input := &model.RoasterEditInput{}
+	err = app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+	input.ID = id
+
+	version, err := app.roasterIfMatch(r, id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+	if input.Version == 0 {
+		input.Version = version
+	}
+
+	roaster, err := app.services.Roasters.Update(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", roasterETag(roaster))
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"roaster": roaster}, headers)
+}
+
+// roaster delete api
+func (app *application) apiRoasterDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	_, err = app.roasterIfMatch(r, id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.services.Roasters.Delete(r.Context(), id)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// users
+
+// user signup api
+func (app *application) apiUserCreate(w http.ResponseWriter, r *http.Request) {
+	input := &model.UserCreateInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+
+	user, err := app.services.Users.Signup(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	app.loadInitialRole(r, user)
+
+	// email the activation link
+	app.sendActivationEmail(r, user.ID)
+
+	app.writeJSONResponse(w, r, http.StatusCreated, envelope{"user": user}, nil)
+}
+
+// user activation api
+func (app *application) apiUserActivate(w http.ResponseWriter, r *http.Request) {
+	input := &model.UserActivateInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+
+	user, err := app.services.Users.Activate(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+}
+
+// forgot password api; always accepted, whether or not the email is registered
+func (app *application) apiUserPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	input := &model.UserPasswordForgotInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+
+	// email the reset link
+	app.sendPasswordResetEmail(r, input)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// reset password api; signs the user out of all sessions
+func (app *application) apiUserPasswordReset(w http.ResponseWriter, r *http.Request) {
+	input := &model.UserPasswordResetInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+
+	user, err := app.services.Users.ResetPassword(r.Context(), input)
+	if err != nil {
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	err = app.signOutEverywhere(r, user.ID)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+}
+
+// user login api; starts a cookie session like the login page
+func (app *application) apiUserLogin(w http.ResponseWriter, r *http.Request) {
+	input := &model.UserLoginInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+	input.IP = clientIP(r)
+
+	user, err := app.services.Users.Login(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRTOOMANY {
+			app.logLoginThrottled(input, err)
+		}
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	// users with 2fa on finish at /api/v1/users/login/2fa, like in the browser
+	if user.TwoFactorEnabled {
+		err = app.startPendingTwoFactor(r, user.ID)
+		if err != nil {
+			app.apiErrorResponse(w, r, err)
+			return
+		}
+
+		app.writeJSONResponse(w, r, http.StatusAccepted, envelope{"two_factor_required": true}, nil)
+		return
+	}
+
+	app.apiCompleteLogin(w, r, user)
+}
+
+// user login second step api; takes an authenticator or recovery code for the
+// login pending in the session
+func (app *application) apiUserLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.pendingTwoFactorUserID(r)
+	if userID == 0 {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRNOTAUTHORIZED, "no pending login; log in with the password again"))
+		return
+	}
+
+	input := &model.TwoFactorLoginInput{}
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "%s", err))
+		return
+	}
+	input.UserID = userID
+	input.IP = clientIP(r)
+
+	user, err := app.services.TwoFactor.Verify(r.Context(), input)
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRTOOMANY:
+			app.logTwoFactorThrottled(input, err)
+			app.clearPendingTwoFactor(r)
+		case errs.ERRUNPROCESSABLE:
+			if app.failedTwoFactorAttempt(r) {
+				app.apiErrorResponse(w, r, errs.Errorf(errs.ERRNOTAUTHORIZED, "too many attempts; log in with the password again"))
+				return
+			}
+		}
+		app.apiServiceError(w, r, err, input.Validator)
+		return
+	}
+
+	app.apiCompleteLogin(w, r, user)
+}
+
+// apiCompleteLogin signs the user in and answers with them
+func (app *application) apiCompleteLogin(w http.ResponseWriter, r *http.Request, user *model.UserResponse) {
+	// change session token to avoid session fixation
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	app.clearPendingTwoFactor(r)
+
+	// add user id to session
+	err = app.signIn(r, user.ID)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+}
+
+// user logout api
+func (app *application) apiUserLogout(w http.ResponseWriter, r *http.Request) {
+	// change the session token
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	// remove user id from session
+	err = app.signOut(r)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// current user api
+func (app *application) apiUserMe(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+}
+
+// write json, logging failures to encode the response
+func (app *application) writeJSONResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) {
+	err := app.writeJSON(w, status, data, headers)
+	if err != nil {
+		app.apiErrorResponse(w, r, err)
+	}
+}
+
+// imports
+
+// bean import api
+func (app *application) apiBeanImport(w http.ResponseWriter, r *http.Request) {
+	app.apiImport(w, r, importKindBeans)
+}
+
+// roaster import api
+func (app *application) apiRoasterImport(w http.ResponseWriter, r *http.Request) {
+	app.apiImport(w, r, importKindRoasters)
+}
+
+// the body is the csv or json file itself, told apart by its content type;
+// ?dry_run=true only validates
+func (app *application) apiImport(w http.ResponseWriter, r *http.Request, kind string) {
+	r.Body = http.MaxBytesReader(w, r.Body, model.ImportMaxBytes)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.apiErrorResponse(w, r, errs.Errorf(errs.ERRBAD, "body must not be larger than %d bytes", model.ImportMaxBytes))
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	input := &model.ImportInput{
+		Format: model.ImportFormatJSON,
+		Data:   string(data),
+	}
+	if mediaType == "text/csv" {
+		input.Format = model.ImportFormatCSV
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	result, err := app.runImport(r.Context(), kind, input, dryRun)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.apiImportValidationResponse(w, r, err, input)
+		} else {
+			app.apiErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSONResponse(w, r, http.StatusOK, envelope{"import": result}, nil)
+}
+
+// like apiValidationResponse, with the field errors of every failed row
+func (app *application) apiImportValidationResponse(w http.ResponseWriter, r *http.Request, err error, input *model.ImportInput) {
+	type rowError struct {
+		Line        int               `json:"line"`
+		ExternalRef string            `json:"external_ref"`
+		Fields      map[string]string `json:"fields"`
+	}
+
+	rows := []rowError{}
+	for _, row := range input.BeanRows {
+		if !row.Input.Valid() {
+			rows = append(rows, rowError{row.Line, row.ExternalRef, row.Input.FieldErrors})
+		}
+	}
+	for _, row := range input.RoasterRows {
+		if !row.Input.Valid() {
+			rows = append(rows, rowError{row.Line, row.ExternalRef, row.Input.FieldErrors})
+		}
+	}
+
+	fields := input.FieldErrors
+	if fields == nil {
+		fields = map[string]string{}
+	}
+
+	body := envelope{"error": envelope{
+		"code":    errs.ERRUNPROCESSABLE,
+		"message": errs.ErrorMessage(err),
+		"fields":  fields,
+		"rows":    rows,
+	}}
+
+	err = app.writeJSON(w, http.StatusUnprocessableEntity, body, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
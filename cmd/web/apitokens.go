@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// api token create hx
+func (app *application) apiTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+	user := app.contextGetUser(r)
+
+	// parse and decode form
+	input := &model.APITokenCreateInput{
+		UserID: user.ID,
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.APITokenCreate = input
+
+	// try to insert
+	token, err := app.services.APITokens.Create(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "account.gohtml", "apitokencreate", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.APIToken = token
+
+	// show the plaintext once with a cleared form
+	td.APITokenCreate = &model.APITokenCreateInput{}
+	td.Result = true
+	app.render(w, r, http.StatusOK, "account.gohtml", "apitokencreate", td)
+}
+
+// api token revoke hx
+func (app *application) apiTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	err = app.services.APITokens.Revoke(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// 200 ok default response
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
@@ -26,6 +27,23 @@ func (app *application) beanView(w http.ResponseWriter, r *http.Request) {
 	}
 	td.Bean = bean
 
+	// read precomputed recommendations
+	similar, err := app.services.Recommendations.Similar(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.SimilarBeans = similar
+
+	// answer revalidations of an unchanged page
+	parts := beanETagParts(bean)
+	for _, s := range similar {
+		parts = append(parts, beanETagParts(s.Bean)...)
+	}
+	if app.notModified(w, r, app.pageETag(r, parts)) {
+		return
+	}
+
 	// render template response
 	app.render(w, r, http.StatusOK, "beanview.gohtml", "base", td)
 }
@@ -45,6 +63,12 @@ func (app *application) beanList(w http.ResponseWriter, r *http.Request) {
 	}
 	td.BeanFilter = input
 
+	// advertise the bean feeds, and the feed of this search if filtered
+	td.Feeds = feedLinks("New beans", "/beans/feed", "")
+	if input.Term != "" {
+		td.Feeds = append(td.Feeds, feedLinks(fmt.Sprintf("New beans matching %q", input.Term), "/beans/feed", beanFeedQuery(input.Term))...)
+	}
+
 	// read beans from db
 	beans, err := app.services.Beans.Find(r.Context(), input)
 	if err != nil {
@@ -58,6 +82,8 @@ func (app *application) beanList(w http.ResponseWriter, r *http.Request) {
 	}
 	td.Beans = beans
 
+	app.recordSearch(r, model.SearchKindBeans, input.Term, len(beans))
+
 	// render template response
 	app.render(w, r, http.StatusOK, "beanlist.gohtml", "base", td)
 }
@@ -66,18 +92,27 @@ func (app *application) beanList(w http.ResponseWriter, r *http.Request) {
 func (app *application) beanSearch(w http.ResponseWriter, r *http.Request) {
 	td := app.newTemplateData(r)
 
-	var input *model.BeanFilterInput
+	input := &model.BeanFilterInput{
+		Sort: "id_asc",
+	}
 	err := app.decodeURLQuery(r, input)
 	if err != nil {
 		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
 		return
 	}
-	// TODO: figure out how to redirect unprocessable errors to the form
+	td.BeanFilter = input
 
 	// read beans from db
 	beans, err := app.services.Beans.Find(r.Context(), input)
 	if err != nil {
-		app.errorResponse(w, r, err)
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			// show the errors inline next to the filter form instead of the results
+			w.Header().Add("HX-Retarget", "#term-error")
+			w.Header().Add("HX-Reswap", "innerHTML")
+			app.render(w, r, http.StatusUnprocessableEntity, "beanlist.gohtml", "termerror", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
 		return
 	}
 	td.Beans = beans
@@ -104,7 +139,7 @@ func (app *application) beanCreatePost(w http.ResponseWriter, r *http.Request) {
 	td := app.newTemplateData(r)
 
 	// parse and decode form
-	var input *model.BeanCreateInput
+	input := &model.BeanCreateInput{}
 	err := app.decodePostForm(r, input)
 	if err != nil {
 		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
@@ -116,6 +151,7 @@ func (app *application) beanCreatePost(w http.ResponseWriter, r *http.Request) {
 	bean, err := app.services.Beans.Create(r.Context(), input)
 	if err != nil {
 		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			input.RoasterName = app.roasterName(r, input.RoasterID)
 			app.render(w, r, http.StatusUnprocessableEntity, "beancreate.gohtml", "form", td)
 		} else {
 			app.errorResponse(w, r, err)
@@ -124,7 +160,8 @@ func (app *application) beanCreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 	td.Bean = bean
 
-	// display success message
+	// display success message with a cleared form
+	td.BeanCreate = &model.BeanCreateInput{}
 	td.Result = true
 	app.render(w, r, http.StatusOK, "beancreate.gohtml", "form", td)
 }
@@ -173,18 +210,33 @@ func (app *application) beanEditPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// update roaster
+	// update bean
 	bean, err := app.services.Beans.Update(r.Context(), input)
 	if err != nil {
-		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+		switch errs.ErrorCode(err) {
+		case errs.ERRUNPROCESSABLE:
+			input.RoasterName = app.roasterName(r, input.RoasterID)
 			td.BeanEdit = input // only re-populate input form if validation error
 			app.render(w, r, http.StatusUnprocessableEntity, "beanedit.gohtml", "form", td)
-		} else {
+		case errs.ERRCONFLICT:
+			// edited by someone else since the form was loaded; show both sides
+			current, err := app.services.Beans.Get(r.Context(), id)
+			if err != nil {
+				app.errorResponse(w, r, err)
+				return
+			}
+			input.RoasterName = app.roasterName(r, input.RoasterID)
+			input.LoadedRoasterName = app.roasterName(r, input.LoadedRoasterID)
+			td.EditConflict = input.Conflict(current)
+			td.BeanEdit = input
+			app.render(w, r, http.StatusConflict, "beanedit.gohtml", "form", td)
+		default:
 			app.errorResponse(w, r, err)
 		}
 		return
 	}
 	td.Bean = bean
+	td.BeanEdit = bean.ToEditInput()
 
 	// display success
 	td.Result = true
@@ -207,3 +259,21 @@ func (app *application) beanRemove(w http.ResponseWriter, r *http.Request) {
 
 	// 200 ok default response
 }
+
+// roasterName looks up the name of the roaster picked in a bean form so it can be
+// shown again when the form is re-rendered; unknown ids yield an empty name
+func (app *application) roasterName(r *http.Request, id int64) string {
+	if id < 1 {
+		return ""
+	}
+
+	roaster, err := app.services.Roasters.Get(r.Context(), id)
+	if err != nil {
+		if errs.ErrorCode(err) != errs.ERRNOTFOUND {
+			app.logError(r, err)
+		}
+		return ""
+	}
+
+	return roaster.Name
+}
@@ -9,7 +9,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	tokenScopesContextKey = contextKey("tokenScopes")
+	tokenIDContextKey     = contextKey("tokenID")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *model.UserResponse) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -24,3 +28,27 @@ func (app *application) contextGetUser(r *http.Request) *model.UserResponse {
 
 	return user
 }
+
+// scopes of the api token the request was authenticated with
+func (app *application) contextSetTokenScopes(r *http.Request, scopes []string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenScopesContextKey, scopes)
+	return r.WithContext(ctx)
+}
+
+// nil when the request wasn't authenticated with an api token
+func (app *application) contextGetTokenScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(tokenScopesContextKey).([]string)
+	return scopes
+}
+
+// id of the api token the request was authenticated with
+func (app *application) contextSetTokenID(r *http.Request, id int64) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// 0 when the request wasn't authenticated with an api token
+func (app *application) contextGetTokenID(r *http.Request) int64 {
+	id, _ := r.Context().Value(tokenIDContextKey).(int64)
+	return id
+}
@@ -7,6 +7,11 @@ import (
 )
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if isAPIRequest(r) {
+		app.apiErrorResponse(w, r, err)
+		return
+	}
+
 	code, message := errs.ErrorCode(err), errs.ErrorMessage(err)
 
 	if code == errs.ERRINTERNAL {
@@ -34,9 +39,12 @@ func (app *application) logError(r *http.Request, err error) {
 var codetostatus = map[string]int{
 	errs.ERRCONFLICT:       http.StatusConflict,
 	errs.ERRBAD:            http.StatusBadRequest,
+	errs.ERRUNPROCESSABLE:  http.StatusUnprocessableEntity,
 	errs.ERRNOTFOUND:       http.StatusNotFound,
 	errs.ERRNOTIMPLEMENTED: http.StatusNotImplemented,
 	errs.ERRNOTAUTHORIZED:  http.StatusUnauthorized,
+	errs.ERRPRECONDITION:   http.StatusPreconditionFailed,
+	errs.ERRTOOMANY:        http.StatusTooManyRequests,
 	errs.ERRINTERNAL:       http.StatusInternalServerError,
 }
 
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// entity tags are derived from row versions. A resource is tagged with its id
+// and version, followed by a hash over the resources embedded in it; lists and
+// html pages are tagged with a hash over the same parts.
+
+func versionPart(kind string, id int64, version int) string {
+	return fmt.Sprintf("%s-%d-v%d", kind, id, version)
+}
+
+// short hex digest of the parts, in order
+func hashParts(parts []string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
+
+func beanETagParts(b *model.BeanResponse) []string {
+	parts := []string{versionPart("bean", b.ID, b.Version)}
+	if b.Roaster != nil {
+		parts = append(parts, versionPart("roaster", b.Roaster.ID, b.Roaster.Version))
+	}
+	return parts
+}
+
+func roasterETagParts(ro *model.RoasterResponse) []string {
+	parts := []string{versionPart("roaster", ro.ID, ro.Version)}
+	for _, b := range ro.Beans {
+		parts = append(parts, beanETagParts(b)...)
+	}
+	return parts
+}
+
+// resource tag, e.g. "bean-12-v3" or "bean-12-v3.1f0c..." with embedded resources
+func resourceETag(parts []string) string {
+	tag := parts[0]
+	if len(parts) > 1 {
+		tag += "." + hashParts(parts[1:])
+	}
+	return `"` + tag + `"`
+}
+
+func beanETag(b *model.BeanResponse) string {
+	return resourceETag(beanETagParts(b))
+}
+
+func roasterETag(ro *model.RoasterResponse) string {
+	return resourceETag(roasterETagParts(ro))
+}
+
+func beanListETag(beans []*model.BeanResponse) string {
+	parts := []string{}
+	for _, b := range beans {
+		parts = append(parts, beanETagParts(b)...)
+	}
+	return `"beans-` + hashParts(parts) + `"`
+}
+
+func roasterListETag(roasters []*model.RoasterResponse) string {
+	parts := []string{}
+	for _, ro := range roasters {
+		parts = append(parts, roasterETagParts(ro)...)
+	}
+	return `"roasters-` + hashParts(parts) + `"`
+}
+
+// pageETag tags an html page; pages also depend on the signed-in user and the
+// templates of the running build, and are only weakly comparable
+func (app *application) pageETag(r *http.Request, parts []string) string {
+	parts = append(parts, fmt.Sprintf("user-%d", app.contextGetUser(r).ID), version)
+	return `W/"page-` + hashParts(parts) + `"`
+}
+
+// notModified sets the tag on the response and answers a matching
+// If-None-Match with 304; it reports whether the response is done
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !etagListMatches(r.Header.Values("If-None-Match"), etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch fails when the request has an If-Match that doesn't list the
+// current tag of the resource; requests without one always pass
+func checkIfMatch(r *http.Request, etag string) error {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return nil
+	}
+	if !etagListMatches(values, etag, false) {
+		return errs.Errorf(errs.ERRPRECONDITION, "the resource has changed since it was read; fetch it again")
+	}
+	return nil
+}
+
+// ifMatchRequested reports whether a write is conditional
+func ifMatchRequested(r *http.Request) bool {
+	return r.Header.Get("If-Match") != ""
+}
+
+// etagListMatches compares against the tags of an If-Match/If-None-Match
+// header; weak comparison ignores the W/ prefix, strong comparison never
+// matches a weak tag
+func etagListMatches(values []string, etag string, weak bool) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			switch {
+			case t == "*":
+				return true
+			case weak && strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/"):
+				return true
+			case !weak && t == etag && !strings.HasPrefix(t, "W/"):
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// beanIfMatch checks a conditional bean write against the current bean and
+// returns the version it matched, so the write can't race a concurrent one;
+// unconditional writes get 0
+func (app *application) beanIfMatch(r *http.Request, id int64) (int, error) {
+	if !ifMatchRequested(r) {
+		return 0, nil
+	}
+
+	current, err := app.services.Beans.Get(r.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkIfMatch(r, beanETag(current))
+	if err != nil {
+		return 0, err
+	}
+
+	return current.Version, nil
+}
+
+// roasterIfMatch checks a conditional roaster write against the current roaster and
+// returns the version it matched, so the write can't race a concurrent one;
+// unconditional writes get 0
+func (app *application) roasterIfMatch(r *http.Request, id int64) (int, error) {
+	if !ifMatchRequested(r) {
+		return 0, nil
+	}
+
+	current, err := app.services.Roasters.Get(r.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkIfMatch(r, roasterETag(current))
+	if err != nil {
+		return 0, err
+	}
+
+	return current.Version, nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// rows written between flushes to the client
+const exportFlushRows = 500
+
+// seconds clients are asked to wait when every export slot is taken
+const exportRetryAfter = 30
+
+var exportContentTypes = map[string]string{
+	model.ExportFormatCSV:    "text/csv; charset=utf-8",
+	model.ExportFormatJSON:   "application/json",
+	model.ExportFormatNDJSON: "application/x-ndjson",
+}
+
+// bean export; takes the same query as the bean list plus a format
+func (app *application) beanExport(w http.ResponseWriter, r *http.Request) {
+	input := &model.BeanFilterInput{
+		Sort: model.SortByIDAsc,
+	}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+
+	ex, err := app.newExport(w, r, "beans", model.BeanExportColumns())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if !app.takeExportSlot(w, r) {
+		return
+	}
+	defer app.releaseExportSlot()
+
+	err = app.services.Beans.Export(r.Context(), input, func(row *model.BeanExportRow) error {
+		return ex.write(row)
+	})
+	app.finishExport(w, r, ex, err, input.Validator)
+}
+
+// roaster export; takes the same query as the roaster list plus a format
+func (app *application) roasterExport(w http.ResponseWriter, r *http.Request) {
+	input := &model.RoasterFilterInput{
+		Sort: model.SortByIDAsc,
+	}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+
+	ex, err := app.newExport(w, r, "roasters", model.RoasterExportColumns())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if !app.takeExportSlot(w, r) {
+		return
+	}
+	defer app.releaseExportSlot()
+
+	err = app.services.Roasters.Export(r.Context(), input, func(row *model.RoasterExportRow) error {
+		return ex.write(row)
+	})
+	app.finishExport(w, r, ex, err, input.Validator)
+}
+
+// takeExportSlot reserves one of the exports allowed at once, or answers 429
+// and returns false. An export holds a db connection for as long as the client
+// takes to read it, so slow downloads must not be able to use up the pool
+func (app *application) takeExportSlot(w http.ResponseWriter, r *http.Request) bool {
+	select {
+	case app.exportSlots <- struct{}{}:
+		return true
+	default:
+		w.Header().Set("Retry-After", fmt.Sprint(exportRetryAfter))
+		app.errorResponse(w, r, errs.Errorf(errs.ERRTOOMANY, "too many exports are running; try again in %d seconds", exportRetryAfter))
+		return false
+	}
+}
+
+func (app *application) releaseExportSlot() {
+	<-app.exportSlots
+}
+
+// export streams rows to the response as the service reads them from the
+// database. Headers are only sent with the first row, so errors before that
+// still get a normal error response.
+type export struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+	format  string
+	name    string
+	columns []string
+	rows    int
+	started bool
+}
+
+func (app *application) newExport(w http.ResponseWriter, r *http.Request, name string, columns []string) (*export, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = model.ExportFormatCSV
+	}
+	if !slices.Contains(model.ExportFormats(), format) {
+		return nil, errs.Errorf(errs.ERRBAD, "unknown export format %q; formats are %v", format, model.ExportFormats())
+	}
+
+	ex := &export{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		buf:     bufio.NewWriter(w),
+		format:  format,
+		name:    name,
+		columns: columns,
+	}
+	ex.csv = csv.NewWriter(ex.buf)
+	ex.json = json.NewEncoder(ex.buf)
+
+	// large exports take longer than the server write timeout allows
+	err := ex.rc.SetWriteDeadline(time.Now().Add(app.config.server.exportTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, err
+	}
+
+	return ex, nil
+}
+
+func (ex *export) start() error {
+	filename := fmt.Sprintf("%s-%s.%s", ex.name, time.Now().Format("2006-01-02"), ex.format)
+
+	ex.w.Header().Set("Content-Type", exportContentTypes[ex.format])
+	ex.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ex.w.Header().Set("X-Content-Type-Options", "nosniff")
+	ex.w.WriteHeader(http.StatusOK)
+	ex.started = true
+
+	switch ex.format {
+	case model.ExportFormatCSV:
+		return ex.csv.Write(ex.columns)
+	case model.ExportFormatJSON:
+		_, err := ex.buf.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (ex *export) write(row model.ExportRow) error {
+	if !ex.started {
+		err := ex.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch ex.format {
+	case model.ExportFormatCSV:
+		err = ex.csv.Write(row.Record())
+	case model.ExportFormatJSON:
+		sep := ",\n"
+		if ex.rows == 0 {
+			sep = "\n"
+		}
+		var js []byte
+		js, err = json.Marshal(row)
+		if err == nil {
+			ex.buf.WriteString(sep)
+			_, err = ex.buf.Write(js)
+		}
+	case model.ExportFormatNDJSON:
+		err = ex.json.Encode(row)
+	}
+	if err != nil {
+		return err
+	}
+
+	ex.rows++
+	if ex.rows%exportFlushRows == 0 {
+		return ex.flush()
+	}
+	return nil
+}
+
+func (ex *export) flush() error {
+	ex.csv.Flush()
+	err := ex.csv.Error()
+	if err != nil {
+		return err
+	}
+
+	err = ex.buf.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = ex.rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+func (ex *export) close() error {
+	if !ex.started {
+		// no rows; still send the header row or an empty array
+		err := ex.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	if ex.format == model.ExportFormatJSON {
+		end := "\n]\n"
+		if ex.rows == 0 {
+			end = "]\n"
+		}
+		_, err := ex.buf.WriteString(end)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ex.flush()
+}
+
+func (app *application) finishExport(w http.ResponseWriter, r *http.Request, ex *export, err error, v validator.Validator) {
+	if err == nil {
+		err = ex.close()
+		if err != nil {
+			app.logError(r, err)
+		}
+		return
+	}
+
+	if !ex.started {
+		if isAPIRequest(r) {
+			app.apiServiceError(w, r, err, v)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the status line is already sent; cut the connection so the client sees a
+	// truncated download instead of one that looks complete
+	app.logError(r, err)
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/form/v4"
+)
+
+func TestExportSlots(t *testing.T) {
+	app := &application{
+		exportSlots: make(chan struct{}, 2),
+		formDecoder: form.NewDecoder(),
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	// exports holding every slot, e.g. slow downloads
+	for i := 0; i < cap(app.exportSlots); i++ {
+		if !app.takeExportSlot(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/beans/export", nil)) {
+			t.Fatalf("slot %d refused", i+1)
+		}
+	}
+
+	for _, tt := range []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/beans/export?format=csv", app.beanExport},
+		{"/roasters/export?format=ndjson", app.roasterExport},
+		{"/api/v1/beans/export", app.beanExport},
+	} {
+		rr := httptest.NewRecorder()
+		tt.handler(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("%s: status %d; want %d", tt.path, rr.Code, http.StatusTooManyRequests)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: no Retry-After", tt.path)
+		}
+	}
+
+	// a finished export frees its slot
+	app.releaseExportSlot()
+	if !app.takeExportSlot(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/beans/export", nil)) {
+		t.Error("released slot refused")
+	}
+}
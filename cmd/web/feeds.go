@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+const (
+	feedFormatAtom = "atom"
+	feedFormatRSS  = "rss"
+)
+
+var feedContentTypes = map[string]string{
+	feedFormatAtom: "application/atom+xml",
+	feedFormatRSS:  "application/rss+xml",
+}
+
+// feed advertised through <link rel="alternate"> on html pages
+type feedLink struct {
+	Title string
+	Type  string
+	URL   string
+}
+
+// atom and rss links for a feed path without extension, e.g. /beans/feed
+func feedLinks(title string, path string, query string) []feedLink {
+	if query != "" {
+		query = "?" + query
+	}
+	return []feedLink{
+		{Title: title + " (Atom)", Type: feedContentTypes[feedFormatAtom], URL: path + ".atom" + query},
+		{Title: title + " (RSS)", Type: feedContentTypes[feedFormatRSS], URL: path + ".rss" + query},
+	}
+}
+
+// feed query string for a bean filter term; "" for all beans
+func beanFeedQuery(term string) string {
+	if term == "" {
+		return ""
+	}
+	return url.Values{"term": {term}}.Encode()
+}
+
+// site-wide bean feeds; a term narrows them like the bean list does
+func (app *application) beanFeedAtom(w http.ResponseWriter, r *http.Request) {
+	app.beanFeed(w, r, feedFormatAtom)
+}
+
+func (app *application) beanFeedRSS(w http.ResponseWriter, r *http.Request) {
+	app.beanFeed(w, r, feedFormatRSS)
+}
+
+// per roaster bean feeds
+func (app *application) roasterFeedAtom(w http.ResponseWriter, r *http.Request) {
+	app.roasterFeed(w, r, feedFormatAtom)
+}
+
+func (app *application) roasterFeedRSS(w http.ResponseWriter, r *http.Request) {
+	app.roasterFeed(w, r, feedFormatRSS)
+}
+
+func (app *application) beanFeed(w http.ResponseWriter, r *http.Request, format string) {
+	input := &model.BeanFeedInput{}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+
+	beans, err := app.services.Beans.Feed(r.Context(), input)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	f := &feed{
+		Title:    "New beans - somethingsomethingcoffee",
+		SelfPath: "/beans/feed." + format,
+		HTMLPath: "/beans",
+		Beans:    beans,
+	}
+	if q := beanFeedQuery(input.Term); q != "" {
+		f.Title = fmt.Sprintf("New beans matching %q - somethingsomethingcoffee", input.Term)
+		f.SelfPath += "?" + q
+		f.HTMLPath += "?" + q
+	}
+
+	app.writeFeed(w, r, format, f)
+}
+
+func (app *application) roasterFeed(w http.ResponseWriter, r *http.Request, format string) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	roaster, err := app.services.Roasters.Get(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	beans, err := app.services.Beans.Feed(r.Context(), &model.BeanFeedInput{RoasterID: id})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	f := &feed{
+		Title:    fmt.Sprintf("New beans from %s - somethingsomethingcoffee", roaster.Name),
+		SelfPath: fmt.Sprintf("/roasters/%d/feed.%s", id, format),
+		HTMLPath: fmt.Sprintf("/roasters/%d", id),
+		Beans:    beans,
+	}
+
+	app.writeFeed(w, r, format, f)
+}
+
+// format independent feed, converted to atom or rss when written
+type feed struct {
+	Title    string
+	SelfPath string
+	HTMLPath string
+	Beans    []*model.BeanResponse
+}
+
+// newest entry; beans are never backdated, so this is when the feed last changed
+func (f *feed) updated() time.Time {
+	if len(f.Beans) == 0 {
+		return time.Unix(0, 0).UTC()
+	}
+	return f.Beans[0].CreatedAt.UTC()
+}
+
+func beanEntryTitle(b *model.BeanResponse) string {
+	if b.Roaster != nil {
+		return fmt.Sprintf("%s by %s", b.Name, b.Roaster.Name)
+	}
+	return b.Name
+}
+
+func beanEntrySummary(b *model.BeanResponse) string {
+	s := fmt.Sprintf("Roast level: %s.", b.RoastLevel)
+	if b.Roaster != nil {
+		s += fmt.Sprintf(" Roaster: %s, %s.", b.Roaster.Name, b.Roaster.Location)
+	}
+	return s
+}
+
+func (app *application) writeFeed(w http.ResponseWriter, r *http.Request, format string, f *feed) {
+	// answer revalidations of an unchanged feed
+	if app.notModified(w, r, beanListETag(f.Beans)) {
+		return
+	}
+
+	var doc any
+	switch format {
+	case feedFormatAtom:
+		doc = app.atomFeedOf(r, f)
+	case feedFormatRSS:
+		doc = app.rssFeedOf(r, f)
+	default:
+		panic("unknown feed format " + format)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", feedContentTypes[format]+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+// atom, RFC 4287
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+}
+
+func (app *application) atomFeedOf(r *http.Request, f *feed) *atomFeed {
+	af := &atomFeed{
+		Title:   f.Title,
+		ID:      app.absoluteURL(r, f.SelfPath),
+		Updated: f.updated().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: app.absoluteURL(r, f.SelfPath), Rel: "self", Type: feedContentTypes[feedFormatAtom]},
+			{Href: app.absoluteURL(r, f.HTMLPath), Rel: "alternate", Type: "text/html"},
+		},
+		Author: atomPerson{Name: "somethingsomethingcoffee"},
+	}
+
+	for _, b := range f.Beans {
+		link := app.absoluteURL(r, fmt.Sprintf("/beans/%d", b.ID))
+		created := b.CreatedAt.UTC().Format(time.RFC3339)
+		af.Entries = append(af.Entries, atomEntry{
+			Title:     beanEntryTitle(b),
+			ID:        link,
+			Updated:   created,
+			Published: created,
+			Links:     []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+			Summary:   beanEntrySummary(b),
+		})
+	}
+
+	return af
+}
+
+// rss 2.0
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	LastBuildDate string      `xml:"lastBuildDate"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	Items         []rssItem   `xml:"item"`
+}
+
+// rss readers find the feed's own url through an atom link
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+func (app *application) rssFeedOf(r *http.Request, f *feed) *rssFeed {
+	rf := &rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          app.absoluteURL(r, f.HTMLPath),
+			Description:   f.Title,
+			LastBuildDate: f.updated().Format(time.RFC1123Z),
+			AtomLink: rssAtomLink{
+				Href: app.absoluteURL(r, f.SelfPath),
+				Rel:  "self",
+				Type: feedContentTypes[feedFormatRSS],
+			},
+		},
+	}
+
+	for _, b := range f.Beans {
+		link := app.absoluteURL(r, fmt.Sprintf("/beans/%d", b.ID))
+		rf.Channel.Items = append(rf.Channel.Items, rssItem{
+			Title:       beanEntryTitle(b),
+			Link:        link,
+			Description: beanEntrySummary(b),
+			GUID:        rssGUID{Value: link, IsPermaLink: true},
+			PubDate:     b.CreatedAt.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return rf
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/alexedwards/flow"
 	"github.com/go-playground/form/v4"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
-	id, err := strconv.ParseInt(flow.Param(r.Context(), "id"), 10, 64)
+	return app.readInt64Param(r, "id")
+}
+
+// read a positive integer path parameter, e.g. :id
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(flow.Param(r.Context(), name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -57,7 +65,63 @@ func (app *application) decodeURLQuery(r *http.Request, dst any) error {
 	return nil
 }
 
+// absoluteURL resolves a path against the public url of the site
+func (app *application) absoluteURL(r *http.Request, path string) string {
+	base := strings.TrimSuffix(app.config.baseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + path
+}
+
+// emailURL resolves a path against -base-url for links sent by email. Unlike
+// absoluteURL it never trusts the Host header, which a client could point at
+// their own site; without -base-url (only allowed without smtp) it is localhost
+func (app *application) emailURL(path string) string {
+	base := strings.TrimSuffix(app.config.baseURL, "/")
+	if base == "" {
+		base = fmt.Sprintf("http://localhost:%d", app.config.server.port)
+	}
+	return base + path
+}
+
+// clientIP is the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	user := app.contextGetUser(r)
 	return !user.IsAnonymous()
 }
+
+// recordSearch logs a search for analytics. Only list pages and api list calls
+// record, not the live results fetched while typing. Failures are only logged,
+// so analytics never break the search itself
+func (app *application) recordSearch(r *http.Request, kind string, term string, results int) {
+	err := app.services.Searches.Record(r.Context(), kind, term, app.searcherKey(r), results)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// searcherKey tells searchers apart for analytics without knowing who they are:
+// api calls by their token, signed-in browsers by their session, and everyone
+// else by client ip and user agent, so no session is started just to count them
+func (app *application) searcherKey(r *http.Request) string {
+	if id := app.contextGetTokenID(r); id != 0 {
+		return fmt.Sprintf("token:%d", id)
+	}
+	if key := app.sessionManager.GetString(r.Context(), "sessionKey"); key != "" {
+		return "session:" + key
+	}
+	return "client:" + clientIP(r) + " " + r.UserAgent()
+}
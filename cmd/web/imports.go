@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+const (
+	importKindBeans    = "beans"
+	importKindRoasters = "roasters"
+)
+
+// bean import page
+func (app *application) beanImport(w http.ResponseWriter, r *http.Request) {
+	app.importPage(w, r, importKindBeans)
+}
+
+// roaster import page
+func (app *application) roasterImport(w http.ResponseWriter, r *http.Request) {
+	app.importPage(w, r, importKindRoasters)
+}
+
+// bean import preview hx
+func (app *application) beanImportPreviewPost(w http.ResponseWriter, r *http.Request) {
+	app.importPost(w, r, importKindBeans, true)
+}
+
+// bean import commit hx
+func (app *application) beanImportPost(w http.ResponseWriter, r *http.Request) {
+	app.importPost(w, r, importKindBeans, false)
+}
+
+// roaster import preview hx
+func (app *application) roasterImportPreviewPost(w http.ResponseWriter, r *http.Request) {
+	app.importPost(w, r, importKindRoasters, true)
+}
+
+// roaster import commit hx
+func (app *application) roasterImportPost(w http.ResponseWriter, r *http.Request) {
+	app.importPost(w, r, importKindRoasters, false)
+}
+
+func (app *application) importPage(w http.ResponseWriter, r *http.Request, kind string) {
+	td := app.newTemplateData(r)
+	td.ImportKind = kind
+	td.Import = &model.ImportInput{}
+
+	app.render(w, r, http.StatusOK, "import.gohtml", "base", td)
+}
+
+// previews read the uploaded file; the commit re-sends the previewed data from a
+// hidden field, so nothing is kept on the server between the two steps
+func (app *application) importPost(w http.ResponseWriter, r *http.Request, kind string, dryRun bool) {
+	td := app.newTemplateData(r)
+	td.ImportKind = kind
+
+	var input *model.ImportInput
+	var err error
+	if dryRun {
+		input, err = app.readImportUpload(w, r)
+	} else {
+		input = &model.ImportInput{}
+		err = app.decodePostForm(r, input)
+	}
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid import upload: %s", err))
+		return
+	}
+	td.Import = input
+
+	result, err := app.runImport(r.Context(), kind, input, dryRun)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "import.gohtml", "preview", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.ImportResult = result
+
+	app.render(w, r, http.StatusOK, "import.gohtml", "preview", td)
+}
+
+func (app *application) runImport(ctx context.Context, kind string, input *model.ImportInput, dryRun bool) (*model.ImportResponse, error) {
+	switch kind {
+	case importKindBeans:
+		return app.services.Imports.Beans(ctx, input, dryRun)
+	case importKindRoasters:
+		return app.services.Imports.Roasters(ctx, input, dryRun)
+	default:
+		panic("unknown import kind " + kind)
+	}
+}
+
+// read the file of a multipart import form
+func (app *application) readImportUpload(w http.ResponseWriter, r *http.Request) (*model.ImportInput, error) {
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, model.ImportMaxBytes+64*1024)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, errors.New("the file is too large")
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, model.ImportMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ImportInput{
+		Format: model.DetectImportFormat(header.Filename, string(data)),
+		Data:   string(data),
+	}, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// run fn in a goroutine tracked by app.wg so graceful shutdown waits for it
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		// recover panics; a failing background task shouldn't take the server down
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// run job every interval until ctx is cancelled; a non-positive interval disables it
+func (app *application) periodic(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	if interval <= 0 {
+		app.logger.Info("background job disabled", "job", name)
+		return
+	}
+
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+				err := job(ctx)
+				if err != nil {
+					app.logger.Error(err.Error(), "job", name)
+					continue
+				}
+				app.logger.Debug("background job completed", "job", name, "duration", time.Since(start))
+			}
+		}
+	})
+}
+
+// start all periodic jobs; they stop when ctx is cancelled on shutdown
+func (app *application) startJobs(ctx context.Context) {
+	app.periodic(ctx, "saved searches", app.config.jobs.savedSearchInterval, app.runSavedSearches)
+	app.periodic(ctx, "search event pruning", app.config.jobs.searchPruneInterval, app.pruneSearchEvents)
+	app.periodic(ctx, "bean similarity", app.config.jobs.similarityInterval, app.services.Recommendations.RecomputeAll)
+	app.periodic(ctx, "webhook deliveries", app.config.jobs.webhookInterval, app.deliverWebhooks)
+	app.periodic(ctx, "user token pruning", app.config.jobs.tokenPruneInterval, app.pruneUserTokens)
+	app.periodic(ctx, "account deletion", app.config.jobs.accountDeleteInterval, app.deleteScheduledAccounts)
+	app.periodic(ctx, "session record pruning", app.config.jobs.sessionPruneInterval, app.pruneSessionRecords)
+}
+
+func (app *application) runSavedSearches(ctx context.Context) error {
+	sent, err := app.services.SavedSearches.RunAll(ctx)
+	app.logger.Info("saved searches checked", "notifications", sent)
+	return err
+}
+
+// delete accounts at the end of their grace period and sign them out; the
+// session store isn't tied to users in the database, so it doesn't cascade
+func (app *application) deleteScheduledAccounts(ctx context.Context) error {
+	ids, tokens, err := app.services.Users.DeleteScheduled(ctx)
+	if err != nil {
+		return err
+	}
+	app.logger.Info("scheduled accounts deleted", "deleted", len(ids))
+
+	// their roles aren't tied to users in the database either
+	for _, id := range ids {
+		_, err = app.rbacEnforcer.DeleteUser(model.RBACSubject(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.deleteStoredSessions(ctx, tokens)
+}
+
+func (app *application) pruneUserTokens(ctx context.Context) error {
+	n, err := app.services.Users.PruneTokens(ctx)
+	app.logger.Info("user tokens pruned", "deleted", n)
+	return err
+}
+
+// forget the records of sessions that expired from the session store
+func (app *application) pruneSessionRecords(ctx context.Context) error {
+	n, err := app.services.Sessions.Prune(ctx, app.sessionManager.Lifetime)
+	app.logger.Info("session records pruned", "deleted", n)
+	return err
+}
+
+func (app *application) pruneSearchEvents(ctx context.Context) error {
+	n, err := app.services.Searches.Prune(ctx, app.config.jobs.searchEventRetention)
+	app.logger.Info("search events pruned", "deleted", n)
+	return err
+}
+
+// number of webhook deliveries claimed per run
+const webhookBatchSize = 20
+
+// send due webhook deliveries, each in its own tracked goroutine so shutdown
+// waits for them to finish
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	jobs, err := app.services.Webhooks.Claim(ctx, webhookBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		job := job
+		app.background(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			err := app.services.Webhooks.Deliver(ctx, job)
+			if err != nil {
+				app.logger.Warn(err.Error(), "job", "webhook deliveries")
+			}
+		})
+	}
+
+	return nil
+}
+
+// send due webhook deliveries now instead of waiting for the next run
+func (app *application) kickWebhooks() {
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err := app.deliverWebhooks(ctx)
+		if err != nil {
+			app.logger.Error(err.Error(), "job", "webhook deliveries")
+		}
+	})
+}
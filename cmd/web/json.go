@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+type envelope map[string]any
+
+// api requests get json errors instead of plain text
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	// limit request body to 1MB
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case errors.As(err, &invalidUnmarshalError):
+			// if dst is invalid / nil pointer, panic
+			panic(err)
+		default:
+			return err
+		}
+	}
+
+	// body must only contain a single json value
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// json error body: {"error": {"code": ..., "message": ...}}
+func (app *application) apiErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := errs.ErrorCode(err), errs.ErrorMessage(err)
+
+	if code == errs.ERRINTERNAL {
+		app.logError(r, err)
+	}
+
+	body := envelope{"error": envelope{"code": code, "message": message}}
+
+	err = app.writeJSON(w, errorStatus(code), body, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// json validation error body; adds the field errors of the failed input
+func (app *application) apiValidationResponse(w http.ResponseWriter, r *http.Request, err error, v validator.Validator) {
+	fields := v.FieldErrors
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	nonField := v.NonFieldErrors
+	if nonField == nil {
+		nonField = []string{}
+	}
+
+	body := envelope{"error": envelope{
+		"code":       errs.ERRUNPROCESSABLE,
+		"message":    errs.ErrorMessage(err),
+		"fields":     fields,
+		"non_fields": nonField,
+	}}
+
+	err = app.writeJSON(w, http.StatusUnprocessableEntity, body, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// respond with a validation body for unprocessable errors, a plain json error otherwise
+func (app *application) apiServiceError(w http.ResponseWriter, r *http.Request, err error, v validator.Validator) {
+	if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+		app.apiValidationResponse(w, r, err, v)
+		return
+	}
+	app.apiErrorResponse(w, r, err)
+}
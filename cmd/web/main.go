@@ -14,6 +14,8 @@ import (
 	"github.com/alexedwards/scs/v2"
 	"github.com/casbin/casbin/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/mailer"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/service"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/vcs"
 )
@@ -21,12 +23,15 @@ import (
 var version = vcs.Version()
 
 type config struct {
-	env    string // dev, staging, prod
-	server struct {
-		port         int
-		idleTimeout  time.Duration
-		readTimeout  time.Duration
-		writeTimeout time.Duration
+	env     string // dev, staging, prod
+	baseURL string // public url of the site; derived from requests if empty, except for emailed links
+	server  struct {
+		port          int
+		idleTimeout   time.Duration
+		readTimeout   time.Duration
+		writeTimeout  time.Duration
+		exportTimeout time.Duration
+		maxExports    int // streamed exports running at once, each holding a db connection
 	}
 	db struct {
 		dsn          string
@@ -34,13 +39,36 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  time.Duration
 	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	mailDir              string        // where emails are written when no smtp host is set
+	oidcProviders        string        // json file listing single sign-on identity providers
+	accountDeletionGrace time.Duration // how long a deletion can be cancelled
+	loginThrottle        model.LoginThrottlePolicy
+	jobs                 struct {
+		savedSearchInterval   time.Duration
+		searchPruneInterval   time.Duration
+		searchEventRetention  time.Duration
+		similarityInterval    time.Duration
+		tokenPruneInterval    time.Duration
+		accountDeleteInterval time.Duration
+		webhookInterval       time.Duration
+		sessionPruneInterval  time.Duration
+	}
 }
 
 type application struct {
 	config         config
+	exportSlots    chan struct{} // one per running export
 	formDecoder    *form.Decoder
 	logger         *slog.Logger
-	rbacEnforcer   *casbin.Enforcer
+	oidcProviders  []*oidcProvider
+	rbacEnforcer   *casbin.SyncedEnforcer
 	services       *service.Services
 	sessionManager *scs.SessionManager
 	templateCache  map[string]*template.Template
@@ -51,17 +79,44 @@ func main() {
 	// parse commandline flags
 	var cfg config
 	flag.StringVar(&cfg.env, "env", "development", "environment (development|staging|production)")
+	flag.StringVar(&cfg.baseURL, "base-url", "", "public URL of the site for feeds and links, e.g. https://example.com (required with -smtp-host; derived from requests if empty)")
 
 	flag.IntVar(&cfg.server.port, "server-port", 4000, "server port")
 	flag.DurationVar(&cfg.server.idleTimeout, "server-idle-timeout", time.Minute, "server idle timeout")
 	flag.DurationVar(&cfg.server.readTimeout, "server-read-timeout", 5*time.Second, "server read timeout")
 	flag.DurationVar(&cfg.server.writeTimeout, "server-write-timeout", 10*time.Second, "server write timeout")
+	flag.DurationVar(&cfg.server.exportTimeout, "server-export-timeout", 5*time.Minute, "server write timeout for streamed exports")
+	flag.IntVar(&cfg.server.maxExports, "server-max-exports", 5, "streamed exports running at once; must be below -db-max-open-conns")
 
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open conections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle conections")
 	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
 
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host (emails are written to -mail-dir or logged if empty)")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "somethingsomethingcoffee <no-reply@somethingsomethingcoffee.com>", "SMTP sender")
+	flag.StringVar(&cfg.mailDir, "mail-dir", "", "directory to write emails to when no SMTP host is set (logged if empty)")
+
+	flag.StringVar(&cfg.oidcProviders, "oidc-providers", "", "JSON file listing OpenID Connect identity providers for single sign-on (none if empty)")
+
+	flag.DurationVar(&cfg.accountDeletionGrace, "account-deletion-grace", 14*24*time.Hour, "how long a requested account deletion can be cancelled before the account is deleted")
+
+	flag.IntVar(&cfg.loginThrottle.MaxAccountFailures, "login-max-account-failures", 10, "failed logins for an email before it is locked out")
+	flag.IntVar(&cfg.loginThrottle.MaxIPFailures, "login-max-ip-failures", 100, "failed logins from a client IP before it is locked out")
+	flag.DurationVar(&cfg.loginThrottle.Lockout, "login-lockout", 15*time.Minute, "how long a locked out email or client IP has to wait")
+
+	flag.DurationVar(&cfg.jobs.savedSearchInterval, "jobs-saved-search-interval", 15*time.Minute, "interval for re-running saved searches (0 to disable)")
+	flag.DurationVar(&cfg.jobs.searchPruneInterval, "jobs-search-prune-interval", time.Hour, "interval for pruning raw search analytics events (0 to disable)")
+	flag.DurationVar(&cfg.jobs.similarityInterval, "jobs-similarity-interval", 6*time.Hour, "interval for recomputing all bean similarity scores (0 to disable)")
+	flag.DurationVar(&cfg.jobs.tokenPruneInterval, "jobs-token-prune-interval", time.Hour, "interval for deleting expired activation and password reset tokens (0 to disable)")
+	flag.DurationVar(&cfg.jobs.accountDeleteInterval, "jobs-account-delete-interval", time.Hour, "interval for deleting accounts whose deletion grace period is over (0 to disable)")
+	flag.DurationVar(&cfg.jobs.sessionPruneInterval, "jobs-session-prune-interval", time.Hour, "interval for deleting records of expired sessions (0 to disable)")
+	flag.DurationVar(&cfg.jobs.webhookInterval, "jobs-webhook-interval", 10*time.Second, "interval for sending due webhook deliveries (0 to disable)")
+	flag.DurationVar(&cfg.jobs.searchEventRetention, "search-event-retention", 30*24*time.Hour, "how long raw search analytics events are kept")
+
 	displayVersion := flag.Bool("version", false, "display version and exit")
 
 	flag.Parse()
@@ -74,6 +129,18 @@ func main() {
 	// initialize structured lgr; writes to stdout
 	lgr := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	// every running export holds a db connection; leave some for everything else
+	if cfg.server.maxExports < 1 || (cfg.db.maxOpenConns > 0 && cfg.server.maxExports >= cfg.db.maxOpenConns) {
+		lgr.Error("-server-max-exports must be at least 1 and below -db-max-open-conns")
+		os.Exit(1)
+	}
+
+	// emailed links can't be derived from requests, whose Host header the client picks
+	if cfg.smtp.host != "" && cfg.baseURL == "" {
+		lgr.Error("-base-url is required when -smtp-host is set")
+		os.Exit(1)
+	}
+
 	// initialize db conn pool
 	db, err := openDB(cfg.db)
 	if err != nil {
@@ -83,8 +150,30 @@ func main() {
 	defer db.Close()
 	lgr.Info("database connection pool established")
 
-	// initialize services by providing db conn pool
-	svcs := service.NewServices(db)
+	// initialize mailer; without an smtp server emails end up in files or the log
+	var mlr mailer.Mailer
+	if cfg.smtp.host != "" {
+		mlr = mailer.NewSMTPMailer(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	} else {
+		mlr = mailer.NewFileMailer(cfg.mailDir, cfg.smtp.sender, lgr)
+	}
+
+	// initialize webauthn for passkeys
+	wa, err := newWebAuthn(cfg)
+	if err != nil {
+		lgr.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// initialize single sign-on identity providers
+	oidcps, err := loadOIDCProviders(cfg.oidcProviders)
+	if err != nil {
+		lgr.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// initialize services by providing db conn pool, mailer, webauthn and login limits
+	svcs := service.NewServices(db, lgr, mlr, wa, cfg.loginThrottle)
 
 	// initialize template cache
 	tmpls, err := newTemplateCache()
@@ -106,7 +195,7 @@ func main() {
 		lgr.Error(err.Error())
 		os.Exit(1)
 	}
-	cenf, err := casbin.NewEnforcer("rbac_model.conf", cada)
+	cenf, err := casbin.NewSyncedEnforcer("rbac_model.conf", cada)
 	if err != nil {
 		lgr.Error(err.Error())
 		os.Exit(1)
@@ -120,8 +209,10 @@ func main() {
 	// construct application
 	app := &application{
 		config:         cfg,
+		exportSlots:    make(chan struct{}, cfg.server.maxExports),
 		formDecoder:    fdcdr,
 		logger:         lgr,
+		oidcProviders:  oidcps,
 		rbacEnforcer:   cenf,
 		services:       svcs,
 		sessionManager: smgr,
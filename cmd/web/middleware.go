@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,8 +11,26 @@ import (
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
 )
 
+// robots.txt only stops crawling; the header also keeps pages that are linked
+// from elsewhere out of the index
+func (app *application) noIndex(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.indexable() {
+			w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// api tokens take precedence over the session, but only on api routes;
+		// pages and htmx endpoints are for signed-in browsers
+		if strings.HasPrefix(r.URL.Path, "/api/v1/") && r.Header.Get("Authorization") != "" {
+			app.authenticateToken(w, r, next)
+			return
+		}
+
 		// retrieve existing user id from session if it exists
 		id := app.sessionManager.GetInt64(r.Context(), "authenticatedUserID")
 		if id == 0 {
@@ -26,14 +45,37 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		if err != nil {
 			switch {
 			case errs.ErrorCode(err) == errs.ERRNOTFOUND:
-				// TODO: should i force a reset on the token?
-				app.errorResponse(w, r, errs.Errorf(errs.ERRNOTFOUND, "user associated with session token not found"))
+				// the account was deleted; drop its session and carry on anonymously
+				err = app.sessionManager.Destroy(r.Context())
+				if err != nil {
+					app.errorResponse(w, r, err)
+					return
+				}
+				r = app.contextSetUser(r, model.AnonymousUser)
+				next.ServeHTTP(w, r)
 			default:
 				app.errorResponse(w, r, err)
 			}
 			return
 		}
 
+		// sessions revoked from elsewhere end here
+		ok, err := app.sessionSeen(r, user.ID)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			err = app.sessionManager.Destroy(r.Context())
+			if err != nil {
+				app.errorResponse(w, r, err)
+				return
+			}
+			r = app.contextSetUser(r, model.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// add user to request context for use in other middleware
 		r = app.contextSetUser(r, user)
 
@@ -42,6 +84,34 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticate a request carrying an `Authorization: Bearer <token>` header
+func (app *application) authenticateToken(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	w.Header().Add("Vary", "Authorization")
+
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTAUTHORIZED, "invalid authorization header"))
+		return
+	}
+
+	auth, err := app.services.APITokens.Authenticate(r.Context(), token)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTAUTHORIZED {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// add user and token to request context
+	r = app.contextSetUser(r, auth.User)
+	r = app.contextSetTokenScopes(r, auth.Scopes)
+	r = app.contextSetTokenID(r, auth.TokenID)
+
+	next.ServeHTTP(w, r)
+}
+
 // TODO: how does this handle htmx requests?
 // should i redirect to login on failed authentication required?
 // should i send a HX-Redirect header?
@@ -85,9 +155,9 @@ func (app *application) requirePermission(code string) func(http.Handler) http.H
 				panic("permission codes should have a semicolon separator")
 			}
 
-			sub := app.contextGetUser(r).Name
+			user := app.contextGetUser(r)
 
-			ok, err := app.rbacEnforcer.Enforce(sub, obj, act)
+			ok, err := app.rbacEnforcer.Enforce(rbacSubject(user), obj, act)
 			if err != nil {
 				app.errorResponse(w, r, err)
 				return
@@ -97,11 +167,63 @@ func (app *application) requirePermission(code string) func(http.Handler) http.H
 				return
 			}
 
+			// roles can make 2fa mandatory; until it's set up, the permissions
+			// only they grant don't apply
+			if !user.TwoFactorEnabled {
+				required, err := app.requiresTwoFactor(user)
+				if err != nil {
+					app.errorResponse(w, r, err)
+					return
+				}
+				if required {
+					ok, err = app.permittedWithoutTwoFactor(user, obj, act)
+					if err != nil {
+						app.errorResponse(w, r, err)
+						return
+					}
+					if !ok {
+						app.twoFactorSetupRequired(w, r)
+						return
+					}
+				}
+			}
+
+			// api tokens are further limited to their scopes
+			if scopes := app.contextGetTokenScopes(r); scopes != nil && !slices.Contains(scopes, code) {
+				app.errorResponse(w, r, errs.Errorf(errs.ERRNOTAUTHORIZED, "api token does not have the %s scope", code))
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// twoFactorSetupRequired sends browsers to set up 2fa; api clients can't, so
+// they're told to
+func (app *application) twoFactorSetupRequired(w http.ResponseWriter, r *http.Request) {
+	if isAPIRequest(r) {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTAUTHORIZED, "your role requires two-factor authentication; set it up at /account/2fa"))
+		return
+	}
+
+	app.loginRedirect(w, r, "/account/2fa", "your role requires two-factor authentication; redirecting to two-factor setup")
+}
+
+// requireSessionUser keeps api tokens away from account management
+func (app *application) requireSessionUser(next http.Handler) http.Handler {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetTokenScopes(r) != nil {
+			app.errorResponse(w, r, errs.Errorf(errs.ERRNOTAUTHORIZED, "this action requires signing in"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
 func setTimeout(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second) // TODO: make timeout configurable
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"golang.org/x/oauth2"
+)
+
+// how long a single sign-on may take at the identity provider, and how long
+// calls to it may take
+const (
+	oidcLoginTTL     = 10 * time.Minute
+	oidcFetchTimeout = 10 * time.Second
+)
+
+var oidcNameRX = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// oidcProviderConfig is one identity provider in the -oidc-providers file
+type oidcProviderConfig struct {
+	Name         string   `json:"name"`         // used in urls and to link identities; don't change it
+	DisplayName  string   `json:"display_name"` // shown on the login button
+	Issuer       string   `json:"issuer"`       // discovery is done at issuer/.well-known/openid-configuration
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"` // empty for public clients
+	Scopes       []string `json:"scopes"`        // on top of openid, email and profile
+	// treat emails as verified without an email_verified claim, for providers
+	// that only hand out addresses they own
+	TrustEmail bool `json:"trust_email"`
+	// claim holding the user's groups, "groups" if empty, and the casbin role
+	// each group grants; without a mapping roles are left alone
+	GroupsClaim string            `json:"groups_claim"`
+	RoleMapping map[string]string `json:"role_mapping"`
+}
+
+// oidcProvider is a configured identity provider; its endpoints and keys are
+// discovered on first use, so the site starts even when the provider is down
+type oidcProvider struct {
+	config oidcProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// loadOIDCProviders reads the identity providers from a json file holding a
+// list of provider configs; no file means no single sign-on
+func loadOIDCProviders(path string) ([]*oidcProvider, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading oidc providers: %w", err)
+	}
+
+	var configs []oidcProviderConfig
+	err = json.Unmarshal(b, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing oidc providers: %w", err)
+	}
+
+	providers := []*oidcProvider{}
+	seen := map[string]bool{}
+	for _, c := range configs {
+		switch {
+		case !oidcNameRX.MatchString(c.Name):
+			return nil, fmt.Errorf("oidc provider name %q must be lowercase letters, digits and dashes", c.Name)
+		case seen[c.Name]:
+			return nil, fmt.Errorf("oidc provider name %q is used twice", c.Name)
+		case c.Issuer == "" || c.ClientID == "":
+			return nil, fmt.Errorf("oidc provider %q needs an issuer and a client id", c.Name)
+		}
+		seen[c.Name] = true
+
+		if c.DisplayName == "" {
+			c.DisplayName = c.Name
+		}
+		if c.GroupsClaim == "" {
+			c.GroupsClaim = "groups"
+		}
+
+		providers = append(providers, &oidcProvider{
+			config: c,
+			client: &http.Client{Timeout: oidcFetchTimeout},
+		})
+	}
+
+	return providers, nil
+}
+
+// discover fetches the provider's metadata, once it succeeds
+func (p *oidcProvider) discover() (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	// the provider keeps the context for fetching signing keys later on
+	provider, err := oidc.NewProvider(p.context(context.Background()), p.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.config.Name, err)
+	}
+	p.provider = provider
+
+	return provider, nil
+}
+
+// context makes calls to the provider use its client
+func (p *oidcProvider) context(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, p.client)
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       append([]string{oidc.ScopeOpenID, "email", "profile"}, p.config.Scopes...),
+	}
+}
+
+// ssoProvider is a login button
+type ssoProvider struct {
+	Name        string
+	DisplayName string
+}
+
+func (app *application) ssoProviders() []ssoProvider {
+	links := []ssoProvider{}
+	for _, p := range app.oidcProviders {
+		links = append(links, ssoProvider{Name: p.config.Name, DisplayName: p.config.DisplayName})
+	}
+	return links
+}
+
+func (app *application) oidcProvider(r *http.Request) *oidcProvider {
+	name := flow.Param(r.Context(), "provider")
+	for _, p := range app.oidcProviders {
+		if p.config.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// oidcLoginState is what the callback has to match; kept in the session
+// while the user is at the identity provider
+type oidcLoginState struct {
+	Provider string    `json:"provider"`
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"` // pkce
+	Expiry   time.Time `json:"expiry"`
+	// the signed-in user confirming it's them, instead of a login
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+func randomOIDCValue() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// single sign-on start; sends the browser to the identity provider
+func (app *application) userLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	p := app.oidcProvider(r)
+	if p == nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTFOUND, "unknown identity provider"))
+		return
+	}
+
+	provider, err := p.discover()
+	if err != nil {
+		app.logError(r, err)
+		app.oidcLoginFailed(w, r, fmt.Sprintf("%s can't be reached right now; try again later", p.config.DisplayName))
+		return
+	}
+
+	app.redirectToOIDC(w, r, p, provider, 0)
+}
+
+// redirectToOIDC keeps what the callback has to match in the session and
+// sends the browser to the identity provider. A user id makes it a fresh
+// sign-in of that signed-in user instead of a login
+func (app *application) redirectToOIDC(w http.ResponseWriter, r *http.Request, p *oidcProvider, provider *oidc.Provider, userID int64) {
+	state := oidcLoginState{
+		Provider: p.config.Name,
+		Verifier: oauth2.GenerateVerifier(),
+		Expiry:   time.Now().Add(oidcLoginTTL),
+		UserID:   userID,
+	}
+
+	var err error
+	state.State, err = randomOIDCValue()
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	state.Nonce, err = randomOIDCValue()
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "oidcLogin", string(b))
+
+	opts := []oauth2.AuthCodeOption{oidc.Nonce(state.Nonce), oauth2.S256ChallengeOption(state.Verifier)}
+	if userID != 0 {
+		// have the user enter their credentials even if signed in there
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", "login"), oauth2.SetAuthURLParam("max_age", "0"))
+	}
+
+	cfg := p.oauth2Config(provider, app.oidcRedirectURL(r, p))
+	authURL := cfg.AuthCodeURL(state.State, opts...)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+func (app *application) oidcRedirectURL(r *http.Request, p *oidcProvider) string {
+	return app.absoluteURL(r, "/user/login/oidc/"+p.config.Name+"/callback")
+}
+
+// single sign-on callback; the identity provider sends the browser back here
+// with a code to exchange for the id token
+func (app *application) userLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	p := app.oidcProvider(r)
+	if p == nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTFOUND, "unknown identity provider"))
+		return
+	}
+
+	// the state is single use, and has to come back unchanged
+	var state oidcLoginState
+	err := json.Unmarshal([]byte(app.sessionManager.PopString(r.Context(), "oidcLogin")), &state)
+	if err != nil || state.Provider != p.config.Name || state.State != r.URL.Query().Get("state") || time.Now().After(state.Expiry) {
+		app.oidcLoginFailed(w, r, "your sign-in expired; try again")
+		return
+	}
+
+	// signing in again goes back to the settings page when it fails
+	failed := app.oidcLoginFailed
+	if state.UserID != 0 {
+		failed = app.accountReauthFailed
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		app.logger.Info("oidc login refused", "provider", p.config.Name, "error", e, "description", r.URL.Query().Get("error_description"))
+		failed(w, r, fmt.Sprintf("%s didn't sign you in", p.config.DisplayName))
+		return
+	}
+
+	input, groups, err := app.oidcExchange(r, p, state)
+	if err != nil {
+		app.logError(r, err)
+		failed(w, r, fmt.Sprintf("your sign-in with %s couldn't be verified; try again", p.config.DisplayName))
+		return
+	}
+
+	if state.UserID != 0 {
+		app.accountReauthOIDCCallback(w, r, p, state, input)
+		return
+	}
+
+	login, err := app.services.OIDC.Login(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.oidcLoginFailed(w, r, input.NonFieldErrors...)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	user := login.User
+
+	// a replaced unactivated account loses its roles; its sessions end on their
+	// next request, when authenticate finds the account gone
+	if login.ReplacedUserID != 0 {
+		_, err = app.rbacEnforcer.DeleteUser(model.RBACSubject(login.ReplacedUserID))
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+
+	// users signed up by their first sign-in
+	if login.Created {
+		app.loadInitialRole(r, user)
+	}
+
+	if len(p.config.RoleMapping) > 0 {
+		err = app.syncMappedRoles(user, p.config.RoleMapping, groups)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.startLogin(w, r, user)
+}
+
+// oidcExchange trades the code for tokens and checks the id token's
+// signature, issuer, audience, expiry and nonce
+func (app *application) oidcExchange(r *http.Request, p *oidcProvider, state oidcLoginState) (*model.OIDCLoginInput, []string, error) {
+	provider, err := p.discover()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := p.context(r.Context())
+	cfg := p.oauth2Config(provider, app.oidcRedirectURL(r, p))
+
+	token, err := cfg.Exchange(ctx, r.URL.Query().Get("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc code exchange with %s: %w", p.config.Name, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("oidc token response of %s has no id token", p.config.Name)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc id token of %s: %w", p.config.Name, err)
+	}
+	if idToken.Nonce != state.Nonce {
+		return nil, nil, fmt.Errorf("oidc id token of %s has the wrong nonce", p.config.Name)
+	}
+
+	claims := map[string]any{}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// some providers leave the email or groups out of the id token and only
+	// hand them out from the userinfo endpoint
+	_, hasGroups := claims[p.config.GroupsClaim]
+	if claims["email"] == nil || (len(p.config.RoleMapping) > 0 && !hasGroups) {
+		info, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc userinfo of %s: %w", p.config.Name, err)
+		}
+		if info.Subject != idToken.Subject {
+			return nil, nil, fmt.Errorf("oidc userinfo of %s is for another subject", p.config.Name)
+		}
+
+		more := map[string]any{}
+		err = info.Claims(&more)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range more {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	input := &model.OIDCLoginInput{
+		Provider:      p.config.Name,
+		Subject:       idToken.Subject,
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: p.config.TrustEmail || boolClaim(claims, "email_verified"),
+		Name:          stringClaim(claims, "name"),
+	}
+	if input.Name == "" {
+		input.Name = stringClaim(claims, "preferred_username")
+	}
+	if t, ok := claims["auth_time"].(float64); ok {
+		input.AuthTime = time.Unix(int64(t), 0)
+	}
+
+	return input, stringsClaim(claims, p.config.GroupsClaim), nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// boolClaim reads a boolean claim; some providers send it as a string
+func boolClaim(claims map[string]any, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// stringsClaim reads a claim that is a list of strings, or a single string
+func stringsClaim(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		ss := []string{}
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+// oidcLoginFailed shows the login page with why single sign-on didn't work
+func (app *application) oidcLoginFailed(w http.ResponseWriter, r *http.Request, messages ...string) {
+	td := app.newTemplateData(r)
+
+	td.UserLogin = &model.UserLoginInput{}
+	td.PasskeyLogin = &model.PasskeyLoginInput{}
+	td.OIDCLogin = &model.OIDCLoginInput{}
+	for _, m := range messages {
+		td.OIDCLogin.AddNonFieldError(m)
+	}
+	td.SSOProviders = app.ssoProviders()
+
+	app.render(w, r, http.StatusUnauthorized, "login.gohtml", "base", td)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/alexedwards/scs/v2"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// mockIdP is an identity provider serving discovery, keys, the token endpoint
+// and userinfo; it hands out an id token with the claims set by the test
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	code     string
+	verifier string // pkce verifier the code was issued for
+
+	idToken  map[string]any // claims on top of iss, aud, exp and iat
+	userinfo map[string]any
+	signer   *rsa.PrivateKey // signs the id token; key if nil
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{key: key, clientID: "coffee", code: "the-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"userinfo_endpoint":                     idp.server.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{"keys": []any{map[string]any{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil || r.PostForm.Get("grant_type") != "authorization_code" ||
+			r.PostForm.Get("code") != idp.code || r.PostForm.Get("code_verifier") != idp.verifier {
+			writeTestJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+			return
+		}
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"access_token": "the-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.signIDToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer the-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeTestJSON(w, http.StatusOK, idp.userinfo)
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (idp *mockIdP) signIDToken(t *testing.T) string {
+	claims := map[string]any{
+		"iss": idp.server.URL,
+		"aud": idp.clientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range idp.idToken {
+		claims[k] = v
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Error(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	signer := idp.signer
+	if signer == nil {
+		signer = idp.key
+	}
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (idp *mockIdP) provider(c oidcProviderConfig) *oidcProvider {
+	c.Name = "mock"
+	c.DisplayName = "Mock"
+	c.Issuer = idp.server.URL
+	c.ClientID = idp.clientID
+	c.ClientSecret = "secret"
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	return &oidcProvider{config: c, client: idp.server.Client()}
+}
+
+func newOIDCTestApp() *application {
+	var cfg config
+	cfg.baseURL = "https://coffee.example"
+
+	return &application{
+		config:         cfg,
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		sessionManager: scs.New(),
+	}
+}
+
+func TestOIDCLoginStart(t *testing.T) {
+	idp := newMockIdP(t)
+	app := newOIDCTestApp()
+	app.oidcProviders = []*oidcProvider{idp.provider(oidcProviderConfig{})}
+
+	mux := flow.New()
+	mux.Use(app.sessionManager.LoadAndSave)
+	mux.HandleFunc("/user/login/oidc/:provider", app.userLoginOIDC, http.MethodGet)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/user/login/oidc/mock", nil))
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("status %d; want %d", rr.Code, http.StatusSeeOther)
+	}
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != idp.server.URL+"/authorize" {
+		t.Errorf("redirected to %s; want the authorization endpoint", got)
+	}
+
+	q := loc.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             idp.clientID,
+		"redirect_uri":          "https://coffee.example/user/login/oidc/mock/callback",
+		"scope":                 "openid email profile",
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q; want %q", k, q.Get(k), v)
+		}
+	}
+	for _, k := range []string{"state", "nonce", "code_challenge"} {
+		if q.Get(k) == "" {
+			t.Errorf("%s missing", k)
+		}
+	}
+
+	// the state has to be kept for the callback
+	if len(rr.Result().Cookies()) == 0 {
+		t.Error("no session cookie set")
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/user/login/oidc/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown provider status %d; want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestOIDCReauthStart(t *testing.T) {
+	idp := newMockIdP(t)
+	app := newOIDCTestApp()
+	app.oidcProviders = []*oidcProvider{idp.provider(oidcProviderConfig{})}
+
+	mux := flow.New()
+	mux.Use(app.sessionManager.LoadAndSave)
+	mux.HandleFunc("/account/reauth/oidc/:provider", func(w http.ResponseWriter, r *http.Request) {
+		app.accountReauthOIDC(w, app.contextSetUser(r, &model.UserResponse{ID: 7}))
+	}, http.MethodGet)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/account/reauth/oidc/mock", nil))
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("status %d; want %d", rr.Code, http.StatusSeeOther)
+	}
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a sign-in still open at the provider mustn't be reused, and it comes
+	// back to the login callback registered with the provider
+	q := loc.Query()
+	want := map[string]string{
+		"prompt":       "login",
+		"max_age":      "0",
+		"redirect_uri": "https://coffee.example/user/login/oidc/mock/callback",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q; want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     oidcProviderConfig
+		idToken    map[string]any
+		userinfo   map[string]any
+		want       *model.OIDCLoginInput
+		wantGroups []string
+	}{
+		{
+			name:    "claims in id token",
+			idToken: map[string]any{"sub": "u1", "email": "alice@example.com", "email_verified": true, "name": "Alice"},
+			want:    &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"},
+		},
+		{
+			name:    "unverified email",
+			idToken: map[string]any{"sub": "u1", "email": "alice@example.com", "name": "Alice"},
+			want:    &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", Name: "Alice"},
+		},
+		{
+			name:    "verified as a string",
+			idToken: map[string]any{"sub": "u1", "email": "alice@example.com", "email_verified": "true", "preferred_username": "alice"},
+			want:    &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", EmailVerified: true, Name: "alice"},
+		},
+		{
+			name:    "trusted email",
+			config:  oidcProviderConfig{TrustEmail: true},
+			idToken: map[string]any{"sub": "u1", "email": "alice@example.com"},
+			want:    &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name:     "email from userinfo",
+			idToken:  map[string]any{"sub": "u1"},
+			userinfo: map[string]any{"sub": "u1", "email": "alice@example.com", "email_verified": true},
+			want:     &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name:    "auth time",
+			idToken: map[string]any{"sub": "u1", "email": "alice@example.com", "auth_time": 1700000000},
+			want:    &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", AuthTime: time.Unix(1700000000, 0)},
+		},
+		{
+			name:       "groups from userinfo",
+			config:     oidcProviderConfig{RoleMapping: map[string]string{"staff": model.RoleModerator}},
+			idToken:    map[string]any{"sub": "u1", "email": "alice@example.com", "email_verified": true},
+			userinfo:   map[string]any{"sub": "u1", "groups": []string{"staff", "other"}},
+			want:       &model.OIDCLoginInput{Provider: "mock", Subject: "u1", Email: "alice@example.com", EmailVerified: true},
+			wantGroups: []string{"staff", "other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.idToken = tt.idToken
+			idp.userinfo = tt.userinfo
+
+			input, groups, err := exchangeWithMockIdP(t, idp, idp.provider(tt.config), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(input, tt.want) {
+				t.Errorf("input %+v; want %+v", input, tt.want)
+			}
+			if !reflect.DeepEqual(groups, tt.wantGroups) {
+				t.Errorf("groups %v; want %v", groups, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeRejected(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		before func(idp *mockIdP, state *oidcLoginState)
+		want   string // in the error
+	}{
+		{
+			name:   "wrong nonce",
+			before: func(idp *mockIdP, state *oidcLoginState) { state.Nonce = "another-nonce" },
+			want:   "wrong nonce",
+		},
+		{
+			name:   "wrong pkce verifier",
+			before: func(idp *mockIdP, state *oidcLoginState) { state.Verifier = "another-verifier" },
+			want:   "code exchange",
+		},
+		{
+			name:   "other audience",
+			before: func(idp *mockIdP, state *oidcLoginState) { idp.idToken["aud"] = "someone-else" },
+			want:   "id token",
+		},
+		{
+			name:   "other issuer",
+			before: func(idp *mockIdP, state *oidcLoginState) { idp.idToken["iss"] = "https://evil.example" },
+			want:   "id token",
+		},
+		{
+			name:   "expired",
+			before: func(idp *mockIdP, state *oidcLoginState) { idp.idToken["exp"] = time.Now().Add(-time.Hour).Unix() },
+			want:   "id token",
+		},
+		{
+			name:   "signed by another key",
+			before: func(idp *mockIdP, state *oidcLoginState) { idp.signer = otherKey },
+			want:   "id token",
+		},
+		{
+			name: "userinfo of another subject",
+			before: func(idp *mockIdP, state *oidcLoginState) {
+				delete(idp.idToken, "email")
+				idp.userinfo = map[string]any{"sub": "u2", "email": "mallory@example.com", "email_verified": true}
+			},
+			want: "another subject",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.idToken = map[string]any{"sub": "u1", "email": "alice@example.com", "email_verified": true}
+
+			_, _, err := exchangeWithMockIdP(t, idp, idp.provider(oidcProviderConfig{}), tt.before)
+			if err == nil {
+				t.Fatal("exchange accepted; want rejected")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q; want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// exchangeWithMockIdP runs the callback's exchange as if the identity provider
+// had sent the browser back with its code
+func exchangeWithMockIdP(t *testing.T, idp *mockIdP, p *oidcProvider, before func(idp *mockIdP, state *oidcLoginState)) (*model.OIDCLoginInput, []string, error) {
+	t.Helper()
+
+	app := newOIDCTestApp()
+	app.oidcProviders = []*oidcProvider{p}
+
+	state := oidcLoginState{Provider: "mock", State: "the-state", Nonce: "the-nonce", Verifier: "the-verifier-of-at-least-forty-three-characters", Expiry: time.Now().Add(oidcLoginTTL)}
+	idp.verifier = state.Verifier
+	if idp.idToken == nil {
+		idp.idToken = map[string]any{}
+	}
+	idp.idToken["nonce"] = state.Nonce
+	if before != nil {
+		before(idp, &state)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/user/login/oidc/mock/callback?code="+idp.code+"&state="+state.State, nil)
+	return app.oidcExchange(r, p, state)
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// documented api operation; every route registered under /api/v1 must have one
+type apiOperation struct {
+	method     string
+	path       string // flow pattern, e.g. /api/v1/beans/:id
+	tag        string
+	summary    string
+	permission string // casbin obj:act code; "auth" for any signed-in user; "" for public
+	query      []apiParam
+	request    string // component schema name of the json body
+	upload     bool   // body is a csv file or a json array of request objects
+	download   bool   // response is a csv, json or ndjson file of schema rows
+	etag       bool   // reads answer If-None-Match, writes check If-Match
+	throttled  bool   // failed attempts are limited per email and client ip
+	twoFactor  bool   // users with 2fa on get 202 and finish at /api/v1/users/login/2fa
+	pending    bool   // needs the login pending 2fa in the session
+	status     int
+	response   string // envelope key of the response body; "" for no body
+	schema     string // component schema name of the response value
+	list       bool
+}
+
+type apiParam struct {
+	name        string
+	typ         string // json schema type; string if empty
+	description string
+	enum        []string
+}
+
+var beanFilterParams = []apiParam{
+	{name: "term", description: "search query, e.g. `roast:light -roaster:\"acme\" geisha`; the qualifiers are `name:`, `roast:` with a roast level and `roaster:`. Beans don't record their origin, so `origin:` is rejected"},
+	{name: "sort", enum: model.BeanSortBys()},
+}
+
+var roasterFilterParams = []apiParam{
+	{name: "term", description: "search query matched against roaster names"},
+	{name: "sort", enum: model.RoasterSortBys()},
+}
+
+var importParams = []apiParam{
+	{name: "dry_run", typ: "boolean", description: "only validate the rows and report what would change"},
+}
+
+var exportFormatParam = apiParam{name: "format", description: "file format; csv if empty", enum: model.ExportFormats()}
+
+var apiOperations = []apiOperation{
+	// beans
+	{method: http.MethodGet, path: "/api/v1/beans", tag: "beans", summary: "List beans", permission: "beans:read", query: beanFilterParams, etag: true, status: http.StatusOK, response: "beans", schema: "Bean", list: true},
+	{method: http.MethodPost, path: "/api/v1/beans", tag: "beans", summary: "Create a bean", permission: "beans:write", request: "BeanCreate", status: http.StatusCreated, response: "bean", schema: "Bean"},
+	{method: http.MethodGet, path: "/api/v1/beans/:id", tag: "beans", summary: "Get a bean", permission: "beans:read", etag: true, status: http.StatusOK, response: "bean", schema: "Bean"},
+	{method: http.MethodPut, path: "/api/v1/beans/:id", tag: "beans", summary: "Update a bean", permission: "beans:write", request: "BeanEdit", etag: true, status: http.StatusOK, response: "bean", schema: "Bean"},
+	{method: http.MethodDelete, path: "/api/v1/beans/:id", tag: "beans", summary: "Delete a bean", permission: "beans:write", etag: true, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/api/v1/beans/export", tag: "beans", summary: "Export the filtered beans", permission: "beans:read", query: append(slices.Clone(beanFilterParams), exportFormatParam), download: true, status: http.StatusOK, schema: "BeanExportRow"},
+	{method: http.MethodPost, path: "/api/v1/beans/import", tag: "beans", summary: "Import beans from CSV or JSON", permission: "beans:write", query: importParams, request: "BeanImportRow", upload: true, status: http.StatusOK, response: "import", schema: "ImportResult"},
+
+	// roasters
+	{method: http.MethodGet, path: "/api/v1/roasters", tag: "roasters", summary: "List roasters", permission: "roasters:read", query: roasterFilterParams, etag: true, status: http.StatusOK, response: "roasters", schema: "Roaster", list: true},
+	{method: http.MethodPost, path: "/api/v1/roasters", tag: "roasters", summary: "Create a roaster", permission: "roasters:write", request: "RoasterCreate", status: http.StatusCreated, response: "roaster", schema: "Roaster"},
+	{method: http.MethodGet, path: "/api/v1/roasters/:id", tag: "roasters", summary: "Get a roaster", permission: "roasters:read", etag: true, status: http.StatusOK, response: "roaster", schema: "Roaster"},
+	{method: http.MethodPut, path: "/api/v1/roasters/:id", tag: "roasters", summary: "Update a roaster", permission: "roasters:write", request: "RoasterEdit", etag: true, status: http.StatusOK, response: "roaster", schema: "Roaster"},
+	{method: http.MethodDelete, path: "/api/v1/roasters/:id", tag: "roasters", summary: "Delete a roaster", permission: "roasters:write", etag: true, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/api/v1/roasters/export", tag: "roasters", summary: "Export the filtered roasters", permission: "roasters:read", query: append(slices.Clone(roasterFilterParams), exportFormatParam), download: true, status: http.StatusOK, schema: "RoasterExportRow"},
+	{method: http.MethodPost, path: "/api/v1/roasters/import", tag: "roasters", summary: "Import roasters from CSV or JSON", permission: "roasters:write", query: importParams, request: "RoasterImportRow", upload: true, status: http.StatusOK, response: "import", schema: "ImportResult"},
+
+	// users
+	{method: http.MethodPost, path: "/api/v1/users", tag: "users", summary: "Sign up", request: "UserCreate", status: http.StatusCreated, response: "user", schema: "User"},
+	{method: http.MethodPost, path: "/api/v1/users/activate", tag: "users", summary: "Activate an account with the emailed token", request: "UserActivate", status: http.StatusOK, response: "user", schema: "User"},
+	{method: http.MethodPost, path: "/api/v1/users/password/forgot", tag: "users", summary: "Email a password reset link; accepted whether or not the email is registered", request: "UserPasswordForgot", status: http.StatusAccepted},
+	{method: http.MethodPost, path: "/api/v1/users/password/reset", tag: "users", summary: "Set a new password with the emailed token and sign out all sessions", request: "UserPasswordReset", status: http.StatusOK, response: "user", schema: "User"},
+	{method: http.MethodPost, path: "/api/v1/users/login", tag: "users", summary: "Log in and start a session", request: "UserLogin", throttled: true, twoFactor: true, status: http.StatusOK, response: "user", schema: "User"},
+	{method: http.MethodPost, path: "/api/v1/users/login/2fa", tag: "users", summary: "Finish a login pending two-factor authentication with an authenticator or recovery code", request: "UserLoginTwoFactor", pending: true, throttled: true, status: http.StatusOK, response: "user", schema: "User"},
+	{method: http.MethodPost, path: "/api/v1/users/logout", tag: "users", summary: "Log out of the current session", status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/api/v1/users/me", tag: "users", summary: "Get the signed-in user", permission: "auth", status: http.StatusOK, response: "user", schema: "User"},
+}
+
+// component schemas and the model types they are derived from
+var apiSchemaTypes = map[string]any{
+	"Bean":               model.BeanResponse{},
+	"BeanCreate":         model.BeanCreateInput{},
+	"BeanEdit":           model.BeanEditInput{},
+	"Roaster":            model.RoasterResponse{},
+	"RoasterCreate":      model.RoasterCreateInput{},
+	"RoasterEdit":        model.RoasterEditInput{},
+	"User":               model.UserResponse{},
+	"UserCreate":         model.UserCreateInput{},
+	"UserLogin":          model.UserLoginInput{},
+	"UserLoginTwoFactor": model.TwoFactorLoginInput{},
+	"UserActivate":       model.UserActivateInput{},
+	"UserPasswordForgot": model.UserPasswordForgotInput{},
+	"UserPasswordReset":  model.UserPasswordResetInput{},
+	"ImportResult":       model.ImportResponse{},
+	"BeanExportRow":      model.BeanExportRow{},
+	"RoasterExportRow":   model.RoasterExportRow{},
+}
+
+// validation rules from the inputs' Validate methods, keyed by schema then json field;
+// openapi_test.go checks them against what Validate rejects
+var apiSchemaConstraints = map[string]map[string]envelope{
+	"BeanCreate": {
+		"name":       {"minLength": 1},
+		"roaster_id": {"minimum": 1},
+	},
+	"BeanEdit": {
+		"name":       {"minLength": 1},
+		"roaster_id": {"minimum": 1},
+	},
+	"RoasterCreate": {
+		"name":        {"minLength": 1, "maxLength": 50},
+		"description": {"maxLength": 300},
+		"website":     {"format": "uri"},
+		"location":    {"minLength": 1},
+	},
+	"RoasterEdit": {
+		"name":        {"minLength": 1, "maxLength": 50},
+		"description": {"maxLength": 300},
+		"website":     {"format": "uri"},
+		"location":    {"minLength": 1},
+	},
+	"UserCreate": {
+		"name":     {"minLength": 1, "maxLength": 20},
+		"email":    {"format": "email"},
+		"password": {"minLength": 8, "maxLength": 30, "format": "password"},
+	},
+	"UserLogin": {
+		"email":    {"format": "email"},
+		"password": {"minLength": 8, "maxLength": 30, "format": "password"},
+	},
+	"UserLoginTwoFactor": {
+		"code": {"minLength": 1, "maxLength": 20},
+	},
+	"UserActivate": {
+		"token": {"minLength": 1, "maxLength": 100},
+	},
+	"UserPasswordForgot": {
+		"email": {"format": "email"},
+	},
+	"UserPasswordReset": {
+		"token":    {"minLength": 1, "maxLength": 100},
+		"password": {"minLength": 8, "maxLength": 30, "format": "password"},
+	},
+}
+
+// fields that Validate rejects when blank
+var apiSchemaRequired = map[string][]string{
+	"BeanCreate":         {"name", "roast_level", "roaster_id"},
+	"BeanEdit":           {"name", "roast_level", "roaster_id"},
+	"RoasterCreate":      {"name", "website", "location"},
+	"RoasterEdit":        {"name", "website", "location"},
+	"UserCreate":         {"name", "email", "password"},
+	"UserLogin":          {"email", "password"},
+	"UserLoginTwoFactor": {"code"},
+	"UserActivate":       {"token"},
+	"UserPasswordForgot": {"email"},
+	"UserPasswordReset":  {"token", "password"},
+}
+
+// named types that are referenced instead of inlined
+var apiSchemaRefs = map[reflect.Type]string{
+	reflect.TypeOf(model.RoastLevelEnum("")): "RoastLevel",
+	reflect.TypeOf(model.BeanResponse{}):     "Bean",
+	reflect.TypeOf(model.RoasterResponse{}):  "Roaster",
+}
+
+func ref(name string) envelope {
+	return envelope{"$ref": "#/components/schemas/" + name}
+}
+
+// json schema for a model type, following its json tags
+func schemaOf(t reflect.Type) envelope {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Slice:
+		return envelope{"type": "array", "items": fieldSchemaOf(t.Elem())}
+	case reflect.String:
+		return envelope{"type": "string"}
+	case reflect.Bool:
+		return envelope{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return envelope{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return envelope{"type": "integer", "format": "int64"}
+	case reflect.Float64:
+		return envelope{"type": "number"}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return envelope{"type": "string", "format": "date-time"}
+		}
+
+		props := envelope{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = fieldSchemaOf(f.Type)
+		}
+		return envelope{"type": "object", "properties": props}
+	default:
+		panic(fmt.Sprintf("openapi: no schema for %s", t))
+	}
+}
+
+func fieldSchemaOf(t reflect.Type) envelope {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if name, ok := apiSchemaRefs[t]; ok {
+		return ref(name)
+	}
+	return schemaOf(t)
+}
+
+func componentSchemas() envelope {
+	schemas := envelope{}
+
+	for name, v := range apiSchemaTypes {
+		s := schemaOf(reflect.TypeOf(v))
+
+		props := s["properties"].(envelope)
+		for field, c := range apiSchemaConstraints[name] {
+			p, ok := props[field].(envelope)
+			if !ok {
+				panic(fmt.Sprintf("openapi: constraint on unknown field %s.%s", name, field))
+			}
+			// merge into the field schema; refs can't carry siblings in every tool, so wrap them
+			if _, isRef := p["$ref"]; isRef {
+				p = envelope{"allOf": []any{p}}
+			}
+			for k, v := range c {
+				p[k] = v
+			}
+			props[field] = p
+		}
+		// request bodies are decoded with unknown fields disallowed
+		if required, ok := apiSchemaRequired[name]; ok {
+			for _, field := range required {
+				if _, ok := props[field]; !ok {
+					panic(fmt.Sprintf("openapi: required unknown field %s.%s", name, field))
+				}
+			}
+			s["required"] = required
+			s["additionalProperties"] = false
+		}
+		schemas[name] = s
+	}
+
+	roastLevels := []string{}
+	for _, rl := range model.RoastLevels() {
+		roastLevels = append(roastLevels, string(rl))
+	}
+	schemas["RoastLevel"] = envelope{"type": "string", "enum": roastLevels}
+
+	schemas["BeanImportRow"] = importRowSchema(model.BeanImportColumns(), "roaster_id")
+	schemas["RoasterImportRow"] = importRowSchema(model.RoasterImportColumns())
+	schemas["ImportValidationError"] = envelope{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": envelope{
+			"error": envelope{
+				"type":     "object",
+				"required": []string{"code", "message", "fields", "rows"},
+				"properties": envelope{
+					"code":    envelope{"type": "string", "const": "unprocessable"},
+					"message": envelope{"type": "string"},
+					"fields":  envelope{"type": "object", "additionalProperties": envelope{"type": "string"}},
+					"rows": envelope{"type": "array", "items": envelope{
+						"type": "object",
+						"properties": envelope{
+							"line":         envelope{"type": "integer"},
+							"external_ref": envelope{"type": "string"},
+							"fields":       envelope{"type": "object", "additionalProperties": envelope{"type": "string"}},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	schemas["Error"] = envelope{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": envelope{
+			"error": envelope{
+				"type":     "object",
+				"required": []string{"code", "message"},
+				"properties": envelope{
+					"code":    envelope{"type": "string"},
+					"message": envelope{"type": "string"},
+				},
+			},
+		},
+	}
+	schemas["ValidationError"] = envelope{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": envelope{
+			"error": envelope{
+				"type":     "object",
+				"required": []string{"code", "message", "fields", "non_fields"},
+				"properties": envelope{
+					"code":       envelope{"type": "string", "const": "unprocessable"},
+					"message":    envelope{"type": "string"},
+					"fields":     envelope{"type": "object", "additionalProperties": envelope{"type": "string"}},
+					"non_fields": envelope{"type": "array", "items": envelope{"type": "string"}},
+				},
+			},
+		},
+	}
+
+	return schemas
+}
+
+func headerParam(name string, description string) envelope {
+	return envelope{"name": name, "in": "header", "description": description, "schema": envelope{"type": "string"}}
+}
+
+// a row of an import file; every column is a string except the integer ones
+func importRowSchema(columns []string, integers ...string) envelope {
+	props := envelope{}
+	for _, col := range columns {
+		props[col] = envelope{"type": "string"}
+		if slices.Contains(integers, col) {
+			props[col] = envelope{"type": "integer", "format": "int64"}
+		}
+	}
+	return envelope{
+		"type":                 "object",
+		"required":             []string{"external_ref"},
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// flow pattern to openapi path template, e.g. /beans/:id -> /beans/{id}
+func openAPIPath(pattern string) string {
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func errorResponseRef(description string) envelope {
+	return envelope{
+		"description": description,
+		"content":     envelope{"application/json": envelope{"schema": ref("Error")}},
+	}
+}
+
+func (op apiOperation) spec() envelope {
+	params := []any{}
+	for _, seg := range strings.Split(op.path, "/") {
+		if strings.HasPrefix(seg, ":") {
+			params = append(params, envelope{
+				"name":     seg[1:],
+				"in":       "path",
+				"required": true,
+				"schema":   envelope{"type": "integer", "format": "int64", "minimum": 1},
+			})
+		}
+	}
+	for _, p := range op.query {
+		s := envelope{"type": "string"}
+		if p.typ != "" {
+			s["type"] = p.typ
+		}
+		if p.enum != nil {
+			s["enum"] = p.enum
+		}
+		param := envelope{"name": p.name, "in": "query", "schema": s}
+		if p.description != "" {
+			param["description"] = p.description
+		}
+		params = append(params, param)
+	}
+
+	responses := envelope{
+		"400": errorResponseRef("Malformed request"),
+		"500": errorResponseRef("Internal error"),
+	}
+	ok := envelope{"description": http.StatusText(op.status)}
+	switch {
+	case op.download:
+		ok["content"] = envelope{
+			"text/csv":             envelope{"schema": envelope{"type": "string", "description": "header row with the " + op.schema + " property names"}},
+			"application/json":     envelope{"schema": envelope{"type": "array", "items": ref(op.schema)}},
+			"application/x-ndjson": envelope{"schema": ref(op.schema)},
+		}
+		ok["headers"] = envelope{"Content-Disposition": envelope{
+			"description": "attachment with a dated file name",
+			"schema":      envelope{"type": "string"},
+		}}
+	case op.response != "":
+		value := ref(op.schema)
+		if op.list {
+			value = envelope{"type": "array", "items": value}
+		}
+		ok["content"] = envelope{"application/json": envelope{"schema": envelope{
+			"type":       "object",
+			"required":   []string{op.response},
+			"properties": envelope{op.response: value},
+		}}}
+	}
+	if op.status == http.StatusCreated {
+		ok["headers"] = envelope{"Location": envelope{
+			"description": "URL of the created resource",
+			"schema":      envelope{"type": "string"},
+		}}
+	}
+	if op.etag {
+		switch op.method {
+		case http.MethodGet:
+			params = append(params, headerParam("If-None-Match", "answer with 304 if the ETag still matches"))
+			responses["304"] = envelope{"description": "Not modified"}
+		default:
+			params = append(params, headerParam("If-Match", "only write if the resource still has this ETag"))
+			responses["412"] = errorResponseRef("The resource changed since the given ETag was read")
+		}
+		if op.response != "" {
+			headers, _ := ok["headers"].(envelope)
+			if headers == nil {
+				headers = envelope{}
+			}
+			headers["ETag"] = envelope{
+				"description": "version of the returned representation",
+				"schema":      envelope{"type": "string"},
+			}
+			ok["headers"] = headers
+		}
+	}
+	responses[fmt.Sprint(op.status)] = ok
+
+	if strings.Contains(op.path, "/:") {
+		responses["404"] = errorResponseRef("Not found")
+	}
+	if op.request != "" || op.query != nil {
+		validation := "ValidationError"
+		if op.upload {
+			validation = "ImportValidationError"
+		}
+		responses["422"] = envelope{
+			"description": "Validation failed",
+			"content":     envelope{"application/json": envelope{"schema": ref(validation)}},
+		}
+	}
+	if op.method == http.MethodPost || op.method == http.MethodPut || op.method == http.MethodDelete {
+		if strings.Contains(op.path, "/:") || (op.request != "" && !op.upload) {
+			responses["409"] = errorResponseRef("Conflict with the current state of the resource")
+		}
+	}
+	if op.throttled {
+		responses["429"] = errorResponseRef("Too many failed attempts; try again later")
+	}
+	if op.download {
+		responses["429"] = errorResponseRef("Too many exports running; try again after the Retry-After seconds")
+	}
+	if op.twoFactor {
+		responses["202"] = envelope{
+			"description": "Password verified; the login is pending a two-factor code",
+			"content": envelope{"application/json": envelope{"schema": envelope{
+				"type":       "object",
+				"required":   []string{"two_factor_required"},
+				"properties": envelope{"two_factor_required": envelope{"type": "boolean", "const": true}},
+			}}},
+		}
+	}
+	if op.pending {
+		responses["401"] = errorResponseRef("No login pending two-factor authentication, or too many wrong codes")
+	}
+	if op.permission != "" {
+		responses["401"] = errorResponseRef("Not signed in or missing permission")
+		if strings.HasSuffix(op.permission, ":write") {
+			responses["401"] = errorResponseRef("Not signed in, account not activated or missing permission")
+		}
+	}
+
+	s := envelope{
+		"operationId": operationID(op),
+		"tags":        []string{op.tag},
+		"summary":     op.summary,
+		"responses":   responses,
+	}
+	if len(params) > 0 {
+		s["parameters"] = params
+	}
+	switch {
+	case op.upload:
+		s["requestBody"] = envelope{
+			"required": true,
+			"content": envelope{
+				"text/csv":         envelope{"schema": envelope{"type": "string", "description": "header row with the " + op.request + " property names"}},
+				"application/json": envelope{"schema": envelope{"type": "array", "items": ref(op.request)}},
+			},
+		}
+	case op.request != "":
+		s["requestBody"] = envelope{
+			"required": true,
+			"content":  envelope{"application/json": envelope{"schema": ref(op.request)}},
+		}
+	}
+	switch op.permission {
+	case "":
+		s["security"] = []any{}
+	case "auth":
+		s["security"] = []any{envelope{"session": []string{}}, envelope{"token": []string{}}}
+	default:
+		s["security"] = []any{envelope{"session": []string{}}, envelope{"token": []string{op.permission}}}
+		s["x-permission"] = op.permission
+	}
+	return s
+}
+
+// e.g. GET /api/v1/beans/:id -> getBeansByID
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.method))
+	for _, seg := range strings.Split(strings.TrimPrefix(op.path, "/api/v1/"), "/") {
+		if strings.HasPrefix(seg, ":") {
+			b.WriteString("By" + strings.ToUpper(seg[1:]))
+			continue
+		}
+		b.WriteString(strings.ToUpper(seg[:1]) + seg[1:])
+	}
+	return b.String()
+}
+
+func openAPISpec() envelope {
+	paths := envelope{}
+	for _, op := range apiOperations {
+		p := openAPIPath(op.path)
+		item, ok := paths[p].(envelope)
+		if !ok {
+			item = envelope{}
+			paths[p] = item
+		}
+		item[strings.ToLower(op.method)] = op.spec()
+	}
+
+	return envelope{
+		"openapi": "3.1.0",
+		"info": envelope{
+			"title":   "somethingsomethingcoffee API",
+			"version": "v1",
+			"description": "JSON API for beans, roasters and users. Errors use the `Error` body; " +
+				"validation failures use `ValidationError` with per-field messages. " +
+				"`x-permission` names the permission an operation requires, which is also the token scope it needs.",
+		},
+		"servers": []any{envelope{"url": "/"}},
+		"tags": []any{
+			envelope{"name": "beans"},
+			envelope{"name": "roasters"},
+			envelope{"name": "users"},
+		},
+		"paths": paths,
+		"components": envelope{
+			"schemas": componentSchemas(),
+			"securitySchemes": envelope{
+				"session": envelope{"type": "apiKey", "in": "cookie", "name": "session"},
+				"token": envelope{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Personal access token created on the account page; limited to its scopes.",
+				},
+			},
+		},
+	}
+}
+
+// openapi document
+func (app *application) apiSpec(w http.ResponseWriter, r *http.Request) {
+	app.writeJSONResponse(w, r, http.StatusOK, openAPISpec(), nil)
+}
+
+// api docs page
+func (app *application) apiDocs(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	app.render(w, r, http.StatusOK, "apidocs.gohtml", "base", td)
+}
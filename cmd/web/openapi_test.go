@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/flow"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+func TestAPIRoutesDocumented(t *testing.T) {
+	app := &application{}
+	registered := app.apiRoutes(flow.New())
+
+	documented := []string{}
+	for _, op := range apiOperations {
+		documented = append(documented, op.method+" "+op.path)
+	}
+
+	for _, route := range registered {
+		if !slices.Contains(documented, route) {
+			t.Errorf("undocumented route %s", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(registered, route) {
+			t.Errorf("documented route not registered %s", route)
+		}
+	}
+}
+
+// inputs that pass Validate, keyed by schema then json field
+var validAPIInputs = map[string]map[string]any{
+	"BeanCreate":         {"name": "Geisha", "roast_level": model.RLLight, "roaster_id": int64(1)},
+	"BeanEdit":           {"name": "Geisha", "roast_level": model.RLLight, "roaster_id": int64(1)},
+	"RoasterCreate":      {"name": "Sey", "description": "Roasted in Brooklyn", "website": "https://example.com", "location": "Brooklyn, NY"},
+	"RoasterEdit":        {"name": "Sey", "description": "Roasted in Brooklyn", "website": "https://example.com", "location": "Brooklyn, NY"},
+	"UserCreate":         {"name": "alice", "email": "alice@example.com", "password": "pa55word"},
+	"UserLogin":          {"email": "alice@example.com", "password": "pa55word"},
+	"UserLoginTwoFactor": {"code": "123456"},
+	"UserActivate":       {"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	"UserPasswordForgot": {"email": "alice@example.com"},
+	"UserPasswordReset":  {"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "password": "pa55word"},
+}
+
+// validate builds the schema's input from the valid values with field set to
+// value, and returns the field errors Validate reports
+func validate(t *testing.T, schema string, field string, value any) map[string]string {
+	t.Helper()
+
+	typ := reflect.TypeOf(apiSchemaTypes[schema])
+	input := reflect.New(typ)
+
+	// edit inputs take their id from the url
+	if id := input.Elem().FieldByName("ID"); id.IsValid() {
+		id.SetInt(1)
+	}
+
+	values := map[string]any{}
+	for k, v := range validAPIInputs[schema] {
+		values[k] = v
+	}
+	if field != "" {
+		values[field] = value
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		f := input.Elem().Field(i)
+		f.Set(reflect.ValueOf(v).Convert(f.Type()))
+	}
+
+	input.MethodByName("Validate").Call(nil)
+	return input.Elem().FieldByName("Validator").Interface().(validator.Validator).FieldErrors
+}
+
+func TestAPISchemaConstraints(t *testing.T) {
+	for schema := range validAPIInputs {
+		if errs := validate(t, schema, "", nil); len(errs) > 0 {
+			t.Fatalf("%s: valid input rejected: %v", schema, errs)
+		}
+	}
+
+	for schema, fields := range apiSchemaConstraints {
+		if _, ok := validAPIInputs[schema]; !ok {
+			t.Errorf("%s: no valid input to check the constraints with", schema)
+			continue
+		}
+
+		for field, c := range fields {
+			// the value Validate must reject and the closest one it must accept
+			type check struct {
+				rule     string
+				rejected any
+				accepted any
+			}
+			var checks []check
+			for rule, limit := range c {
+				switch rule {
+				case "minLength":
+					n := limit.(int)
+					checks = append(checks, check{rule, strings.Repeat("a", n-1), strings.Repeat("a", n)})
+				case "maxLength":
+					n := limit.(int)
+					checks = append(checks, check{rule, strings.Repeat("a", n+1), strings.Repeat("a", n)})
+				case "minimum":
+					n := int64(limit.(int))
+					checks = append(checks, check{rule, n - 1, n})
+				case "format":
+					switch limit {
+					case "email":
+						checks = append(checks, check{rule, "alice", "bob@example.com"})
+					case "uri":
+						checks = append(checks, check{rule, "example.com", "http://example.org/roasters"})
+					case "password":
+						// only hides the value in docs
+					default:
+						t.Errorf("%s.%s: unchecked format %v", schema, field, limit)
+					}
+				default:
+					t.Errorf("%s.%s: unchecked rule %s", schema, field, rule)
+				}
+			}
+
+			for _, ch := range checks {
+				if _, ok := validate(t, schema, field, ch.rejected)[field]; !ok {
+					t.Errorf("%s.%s: %s documented but Validate accepts %q", schema, field, ch.rule, ch.rejected)
+				}
+				if msg, ok := validate(t, schema, field, ch.accepted)[field]; ok {
+					t.Errorf("%s.%s: Validate rejects %q (%s), stricter than the documented %s", schema, field, ch.accepted, msg, ch.rule)
+				}
+			}
+		}
+	}
+}
+
+func TestAPISchemaUndocumentedRules(t *testing.T) {
+	for schema, values := range validAPIInputs {
+		for field, v := range values {
+			// roast levels are a documented enum
+			if _, ok := v.(string); !ok {
+				continue
+			}
+			c := apiSchemaConstraints[schema][field]
+
+			// long values are only rejected with a documented maxLength
+			if _, ok := c["maxLength"]; !ok && c["format"] == nil {
+				if msg, ok := validate(t, schema, field, strings.Repeat("a", 1000))[field]; ok {
+					t.Errorf("%s.%s: Validate rejects long values (%s) without a documented maxLength", schema, field, msg)
+				}
+			}
+
+			// blank values are only rejected for required fields
+			if _, ok := validate(t, schema, field, "")[field]; ok != slices.Contains(apiSchemaRequired[schema], field) {
+				t.Errorf("%s.%s: Validate rejecting blank values is %t, documented required is %t", schema, field, ok, !ok)
+			}
+		}
+	}
+}
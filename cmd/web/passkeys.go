@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// newWebAuthn configures the relying party passkeys are bound to. Passkeys
+// need a fixed origin, so without -base-url they only work on localhost
+func newWebAuthn(cfg config) (*webauthn.WebAuthn, error) {
+	origin := cfg.baseURL
+	if origin == "" {
+		origin = fmt.Sprintf("http://localhost:%d", cfg.server.port)
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url for webauthn: %w", err)
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: "somethingsomethingcoffee",
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+}
+
+// putPasskeySession keeps a ceremony's challenge in the session until the
+// browser answers
+func (app *application) putPasskeySession(r *http.Request, key string, session *webauthn.SessionData) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), key, string(b))
+	return nil
+}
+
+// popPasskeySession takes a ceremony's challenge out of the session, so each
+// challenge is answered only once; nil if there is none
+func (app *application) popPasskeySession(r *http.Request, key string) *webauthn.SessionData {
+	b := app.sessionManager.PopString(r.Context(), key)
+	if b == "" {
+		return nil
+	}
+
+	var session webauthn.SessionData
+	err := json.Unmarshal([]byte(b), &session)
+	if err != nil {
+		return nil
+	}
+	return &session
+}
+
+// passkey registration options; the browser passes them to the authenticator
+func (app *application) passkeyCreateOptionsPost(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := app.services.Passkeys.BeginRegistration(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.putPasskeySession(r, "passkeyRegistration", ceremony.Session)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"publicKey": ceremony.Options}, nil)
+	if err != nil {
+		app.errorResponse(w, r, err)
+	}
+}
+
+// passkey create hx; takes the authenticator's answer to the options
+func (app *application) passkeyCreatePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.PasskeyCreateInput{
+		UserID:  app.contextGetUser(r).ID,
+		Session: app.popPasskeySession(r, "passkeyRegistration"),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.PasskeyCreate = input
+
+	// verify and store
+	passkey, err := app.services.Passkeys.FinishRegistration(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "account.gohtml", "passkeycreate", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.Passkey = passkey
+
+	// add the passkey to the list with a cleared form
+	td.PasskeyCreate = &model.PasskeyCreateInput{}
+	td.Result = true
+	app.render(w, r, http.StatusOK, "account.gohtml", "passkeycreate", td)
+}
+
+// passkey remove hx
+func (app *application) passkeyRemove(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	err = app.services.Passkeys.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// 200 ok default response
+}
+
+// passkey login options; any passkey registered here will do
+func (app *application) userLoginPasskeyOptionsPost(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := app.services.Passkeys.BeginLogin(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.putPasskeySession(r, "passkeyLogin", ceremony.Session)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"publicKey": ceremony.Options}, nil)
+	if err != nil {
+		app.errorResponse(w, r, err)
+	}
+}
+
+// passkey login hx; takes the authenticator's answer to the options
+func (app *application) userLoginPasskeyPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.PasskeyLoginInput{
+		Session: app.popPasskeySession(r, "passkeyLogin"),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.PasskeyLogin = input
+
+	login, err := app.services.Passkeys.FinishLogin(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "login.gohtml", "passkeyform", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	// a passkey unlocked with a fingerprint or PIN is two factors already;
+	// otherwise it only stands in for the password
+	if login.UserVerified {
+		app.completeLogin(w, r, login.User)
+	} else {
+		app.startLogin(w, r, login.User)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// personal data export; a zip with one json file per kind of record
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	export, err := app.services.Users.Export(r.Context(), user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	sessions, err := app.services.Sessions.ListForUser(r.Context(), user.ID, app.sessionManager.GetString(r.Context(), "sessionKey"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, &model.AccountExportSession{
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			LastSeenAt: s.LastSeenAt,
+			CreatedAt:  s.CreatedAt,
+			Expiry:     s.CreatedAt.Add(app.sessionManager.Lifetime),
+			Current:    s.Current,
+		})
+	}
+
+	// build the zip in memory so failures can still get an error response
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, f := range export.Files() {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(f.Data)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("somethingsomethingcoffee-account-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// account deletion hx; the account is deleted by a background job once the
+// grace period is over
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.AccountDeleteInput{
+		ID:              app.contextGetUser(r).ID,
+		Reauthenticated: app.reauthenticated(r),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.AccountDelete = input
+	td.Reauthenticated = input.Reauthenticated
+	td.User = app.contextGetUser(r)
+
+	user, err := app.services.Users.ScheduleDeletion(r.Context(), input, app.config.accountDeletionGrace)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "settings.gohtml", "deleteform", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.User = user
+	td.AccountDelete = &model.AccountDeleteInput{Reauthenticated: input.Reauthenticated}
+	td.Reauthenticated = input.Reauthenticated
+	td.Result = true
+
+	app.render(w, r, http.StatusOK, "settings.gohtml", "deleteform", td)
+}
+
+// cancel account deletion hx
+func (app *application) accountDeleteCancelPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	user, err := app.services.Users.CancelDeletion(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.User = user
+	td.Reauthenticated = app.reauthenticated(r)
+	td.AccountDelete = &model.AccountDeleteInput{Reauthenticated: td.Reauthenticated}
+	td.Result = true
+
+	app.render(w, r, http.StatusOK, "settings.gohtml", "deleteform", td)
+}
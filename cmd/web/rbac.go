@@ -1,4 +1,98 @@
 package main
 
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
 func initRBAC() {
 }
+
+// requiresTwoFactor reports whether one of the user's roles makes two-factor
+// authentication mandatory
+func (app *application) requiresTwoFactor(user *model.UserResponse) (bool, error) {
+	if user.IsAnonymous() {
+		return false, nil
+	}
+
+	obj, act, _ := strings.Cut(model.PermissionRequireTwoFactor, ":")
+	return app.rbacEnforcer.Enforce(rbacSubject(user), obj, act)
+}
+
+// permittedWithoutTwoFactor reports whether the permission comes from one of
+// the user's roles that don't make two-factor authentication mandatory, or is
+// one guests have; those apply before 2fa is set up
+func (app *application) permittedWithoutTwoFactor(user *model.UserResponse, obj string, act string) (bool, error) {
+	roles, err := app.rbacEnforcer.GetImplicitRolesForUser(rbacSubject(user))
+	if err != nil {
+		return false, err
+	}
+
+	tfaObj, tfaAct, _ := strings.Cut(model.PermissionRequireTwoFactor, ":")
+	for _, role := range append(roles, model.RoleGuest) {
+		required, err := app.rbacEnforcer.Enforce(role, tfaObj, tfaAct)
+		if err != nil {
+			return false, err
+		}
+		if required {
+			continue
+		}
+
+		ok, err := app.rbacEnforcer.Enforce(role, obj, act)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// rbacSubject is who casbin knows the user as; anonymous users are guests
+func rbacSubject(user *model.UserResponse) string {
+	return model.RBACSubject(user.ID)
+}
+
+// loadInitialRole has the enforcer see the role a new account was created
+// with. Adding the rule through the enforcer would save it a second time, so
+// the policy is loaded again; if that fails the role is still stored, and the
+// next load picks it up
+func (app *application) loadInitialRole(r *http.Request, user *model.UserResponse) {
+	err := app.rbacEnforcer.LoadPolicy()
+	if err != nil {
+		app.logError(r, fmt.Errorf("loading the initial role of user %d: %w", user.ID, err))
+	}
+}
+
+// syncMappedRoles gives the user the roles their identity provider groups map
+// to, and takes away mapped roles of groups they have left. Roles the mapping
+// doesn't mention are left alone
+func (app *application) syncMappedRoles(user *model.UserResponse, mapping map[string]string, groups []string) error {
+	granted := map[string]bool{}
+	for _, group := range groups {
+		if role, ok := mapping[group]; ok {
+			granted[role] = true
+		}
+	}
+
+	sub := rbacSubject(user)
+	for _, role := range mapping {
+		var changed bool
+		var err error
+		if granted[role] {
+			changed, err = app.rbacEnforcer.AddRoleForUser(sub, role)
+		} else {
+			changed, err = app.rbacEnforcer.DeleteRoleForUser(sub, role)
+		}
+		if err != nil {
+			return err
+		}
+		if changed {
+			app.logger.Info("role changed by identity provider groups", "user_id", user.ID, "role", role, "granted", granted[role])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// newRBACTestApp has the role policies of the permissions migration, kept in
+// memory
+func newRBACTestApp(t *testing.T) *application {
+	t.Helper()
+
+	enforcer, err := casbin.NewSyncedEnforcer("../../rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = enforcer.AddPolicies([][]string{
+		{model.RoleGuest, "beans", "read"},
+		{model.RoleUser, "beans", "read"},
+		{model.RoleModerator, "beans", "read"},
+		{model.RoleModerator, "beans", "write"},
+		{model.RoleModerator, "2fa", "require"},
+		{model.RoleAdmin, "beans", "read"},
+		{model.RoleAdmin, "users", "write"},
+		{model.RoleAdmin, "2fa", "require"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &application{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		rbacEnforcer: enforcer,
+	}
+}
+
+func TestRequirePermissionTwoFactor(t *testing.T) {
+	app := newRBACTestApp(t)
+
+	for id, roles := range map[int64][]string{
+		1: {model.RoleUser},
+		2: {model.RoleUser, model.RoleModerator},
+		3: {model.RoleAdmin},
+	} {
+		for _, role := range roles {
+			_, err := app.rbacEnforcer.AddRoleForUser(model.RBACSubject(id), role)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		user       *model.UserResponse
+		code       string
+		path       string
+		htmx       bool
+		wantStatus int
+		wantTo     string // redirect location, for browsers
+	}{
+		{"user", &model.UserResponse{ID: 1}, "beans:read", "/beans", false, http.StatusOK, ""},
+		{"user without the permission", &model.UserResponse{ID: 1}, "beans:write", "/beans/create", false, http.StatusUnauthorized, ""},
+		{"moderator with 2fa", &model.UserResponse{ID: 2, TwoFactorEnabled: true}, "beans:write", "/beans/create", false, http.StatusOK, ""},
+		{"moderator without 2fa keeps the user role's permissions", &model.UserResponse{ID: 2}, "beans:read", "/beans", false, http.StatusOK, ""},
+		{"moderator without 2fa", &model.UserResponse{ID: 2}, "beans:write", "/beans/create", false, http.StatusSeeOther, "/account/2fa"},
+		{"moderator without 2fa htmx", &model.UserResponse{ID: 2}, "beans:write", "/hx/beans", true, http.StatusOK, "/account/2fa"},
+		{"moderator without 2fa api", &model.UserResponse{ID: 2}, "beans:write", "/api/v1/beans", false, http.StatusUnauthorized, ""},
+		{"admin without 2fa keeps the guest permissions", &model.UserResponse{ID: 3}, "beans:read", "/beans", false, http.StatusOK, ""},
+		{"admin without 2fa", &model.UserResponse{ID: 3}, "users:write", "/admin/users", false, http.StatusSeeOther, "/account/2fa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			handler := app.requirePermission(tt.code)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			r = app.contextSetUser(r, tt.user)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if called != (tt.wantStatus == http.StatusOK && tt.wantTo == "") {
+				t.Errorf("handler called %t", called)
+			}
+
+			to := rr.Header().Get("Location")
+			if tt.htmx {
+				to = rr.Header().Get("HX-Redirect")
+			}
+			if to != tt.wantTo {
+				t.Errorf("redirected to %q; want %q", to, tt.wantTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// how long signing in again stands in for the current password; accounts
+// made by single sign-on have a random password nobody knows
+const reauthTTL = 5 * time.Minute
+
+// reauthenticated reports whether the user signed in again with an identity
+// provider or passkey within reauthTTL
+func (app *application) reauthenticated(r *http.Request) bool {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() || app.sessionManager.GetInt64(r.Context(), "reauthenticatedUserID") != user.ID {
+		return false
+	}
+	return time.Since(app.sessionManager.GetTime(r.Context(), "reauthenticatedAt")) < reauthTTL
+}
+
+func (app *application) markReauthenticated(r *http.Request, userID int64) {
+	app.sessionManager.Put(r.Context(), "reauthenticatedUserID", userID)
+	app.sessionManager.Put(r.Context(), "reauthenticatedAt", time.Now())
+}
+
+// sign in again with an identity provider; it's asked to have the user enter
+// their credentials even if they're still signed in there
+func (app *application) accountReauthOIDC(w http.ResponseWriter, r *http.Request) {
+	p := app.oidcProvider(r)
+	if p == nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTFOUND, "unknown identity provider"))
+		return
+	}
+
+	provider, err := p.discover()
+	if err != nil {
+		app.logError(r, err)
+		app.accountReauthFailed(w, r, fmt.Sprintf("%s can't be reached right now; try again later", p.config.DisplayName))
+		return
+	}
+
+	app.redirectToOIDC(w, r, p, provider, app.contextGetUser(r).ID)
+}
+
+// finishes signing in again once the callback verified the id token
+func (app *application) accountReauthOIDCCallback(w http.ResponseWriter, r *http.Request, p *oidcProvider, state oidcLoginState, input *model.OIDCLoginInput) {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	if user.ID != state.UserID {
+		app.accountReauthFailed(w, r, "you signed in as someone else since you started; try again")
+		return
+	}
+
+	// the provider may have skipped the sign-in for a user still signed in there
+	if input.AuthTime.IsZero() || time.Since(input.AuthTime) > reauthTTL {
+		app.accountReauthFailed(w, r, fmt.Sprintf("%s didn't ask you to sign in again; sign out there and try again", p.config.DisplayName))
+		return
+	}
+
+	err := app.services.OIDC.Reauthenticate(r.Context(), input, user.ID)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.accountReauthFailed(w, r, input.NonFieldErrors...)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.markReauthenticated(r, user.ID)
+	http.Redirect(w, r, "/account/settings", http.StatusSeeOther)
+}
+
+// sign in again with a passkey hx; the options are the login ones
+func (app *application) accountReauthPasskeyPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.PasskeyLoginInput{
+		Session: app.popPasskeySession(r, "passkeyLogin"),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.PasskeyLogin = input
+
+	user := app.contextGetUser(r)
+	login, err := app.services.Passkeys.FinishLogin(r.Context(), input)
+	if err == nil && login.User.ID != user.ID {
+		input.AddFieldError("credential", "this passkey belongs to another account")
+		err = errs.Errorf(errs.ERRUNPROCESSABLE, "passkey of user %d used to reauthenticate user %d", login.User.ID, user.ID)
+	}
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "settings.gohtml", "reauthpasskeyform", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.markReauthenticated(r, user.ID)
+	w.Header().Add("HX-Redirect", "/account/settings")
+	w.Write([]byte("signed in again; reloading settings"))
+}
+
+// accountReauthFailed shows the settings page with why signing in again
+// didn't work
+func (app *application) accountReauthFailed(w http.ResponseWriter, r *http.Request, messages ...string) {
+	td, err := app.settingsTemplateData(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	for _, m := range messages {
+		td.OIDCLogin.AddNonFieldError(m)
+	}
+
+	app.render(w, r, http.StatusUnauthorized, "settings.gohtml", "base", td)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
@@ -32,6 +33,12 @@ func (app *application) roasterView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	td.Roaster = roaster
+	td.Feeds = feedLinks("New beans from "+roaster.Name, fmt.Sprintf("/roasters/%d/feed", roaster.ID), "")
+
+	// answer revalidations of an unchanged page
+	if app.notModified(w, r, app.pageETag(r, roasterETagParts(roaster))) {
+		return
+	}
 
 	// render template response
 	app.render(w, r, http.StatusOK, "roasterview.gohtml", "base", td)
@@ -51,6 +58,7 @@ func (app *application) roasterList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	td.RoasterFilter = input
+	td.Feeds = feedLinks("New beans", "/beans/feed", "")
 
 	// read roasters from service
 	roasters, err := app.services.Roasters.Find(r.Context(), input)
@@ -65,6 +73,8 @@ func (app *application) roasterList(w http.ResponseWriter, r *http.Request) {
 	}
 	td.Roasters = roasters
 
+	app.recordSearch(r, model.SearchKindRoasters, input.Term, len(roasters))
+
 	// render template response
 	app.render(w, r, http.StatusOK, "roasterlist.gohtml", "base", td)
 }
@@ -73,7 +83,9 @@ func (app *application) roasterList(w http.ResponseWriter, r *http.Request) {
 func (app *application) roasterSearch(w http.ResponseWriter, r *http.Request) {
 	td := app.newTemplateData(r)
 
-	var input *model.RoasterFilterInput
+	input := &model.RoasterFilterInput{
+		Sort: "id_asc",
+	}
 	err := app.decodeURLQuery(r, input)
 	if err != nil {
 		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
@@ -96,6 +108,28 @@ func (app *application) roasterSearch(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "roasterresults.gohtml", "roasterresults", td)
 }
 
+// roaster picker suggestions hx
+func (app *application) roasterSuggest(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	input := &model.RoasterSuggestInput{}
+	err := app.decodeURLQuery(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid url query format"))
+		return
+	}
+
+	// read matching roasters from service; invalid terms just yield no suggestions
+	roasters, err := app.services.Roasters.Suggest(r.Context(), input)
+	if err != nil && errs.ErrorCode(err) != errs.ERRUNPROCESSABLE {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.Roasters = roasters
+
+	app.render(w, r, http.StatusOK, "roastersuggestions.gohtml", "roastersuggestions", td)
+}
+
 // roaster create page
 func (app *application) roasterCreate(w http.ResponseWriter, r *http.Request) {
 	td := app.newTemplateData(r)
@@ -178,15 +212,27 @@ func (app *application) roasterEditPut(w http.ResponseWriter, r *http.Request) {
 	// update roaster
 	roaster, err := app.services.Roasters.Update(r.Context(), input)
 	if err != nil {
-		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+		switch errs.ErrorCode(err) {
+		case errs.ERRUNPROCESSABLE:
 			td.RoasterEdit = input // only re-populate input form if validation error
-			app.render(w, r, http.StatusUnprocessableEntity, "beanedit.gohtml", "form", td)
-		} else {
+			app.render(w, r, http.StatusUnprocessableEntity, "roasteredit.gohtml", "form", td)
+		case errs.ERRCONFLICT:
+			// edited by someone else since the form was loaded; show both sides
+			current, err := app.services.Roasters.Get(r.Context(), id)
+			if err != nil {
+				app.errorResponse(w, r, err)
+				return
+			}
+			td.EditConflict = input.Conflict(current)
+			td.RoasterEdit = input
+			app.render(w, r, http.StatusConflict, "roasteredit.gohtml", "form", td)
+		default:
 			app.errorResponse(w, r, err)
 		}
 		return
 	}
 	td.Roaster = roaster
+	td.RoasterEdit = roaster.ToEditInput()
 
 	// display success
 	td.Result = true
@@ -10,6 +10,9 @@ import (
 func (app *application) routes() http.Handler {
 	mux := flow.New()
 
+	// keep non-production copies of the site out of search indexes
+	mux.Use(app.noIndex)
+
 	// static
 	fileServer := http.FileServer(http.FS(ui.Files))
 	mux.Handle("/static/...", fileServer, http.MethodGet)
@@ -23,63 +26,252 @@ func (app *application) routes() http.Handler {
 	// home
 	mux.HandleFunc("/", app.home, http.MethodGet)
 
+	// crawlers
+	mux.HandleFunc("/robots.txt", app.robotsTxt, http.MethodGet)
+	mux.HandleFunc("/sitemap.xml", app.sitemapIndex, http.MethodGet)
+	mux.HandleFunc("/sitemaps/pages.xml", app.sitemapStatic, http.MethodGet)
+	mux.HandleFunc("/sitemaps/:file", app.sitemapPage, http.MethodGet)
+
 	// roasters
 	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
 		mux.Use(app.requirePermission("roasters:write"))
 
 		// pages
 		mux.HandleFunc("/roasters/new", app.roasterCreate, http.MethodGet)
 		mux.HandleFunc("/roasters/:id/edit", app.roasterEdit, http.MethodGet)
+		mux.HandleFunc("/roasters/import", app.roasterImport, http.MethodGet)
 
 		// htmx
 		mux.HandleFunc("/hx/roasters", app.roasterCreatePost, http.MethodPost)
 		mux.HandleFunc("/hx/roasters/:id", app.roasterEditPut, http.MethodPatch)
 		mux.HandleFunc("/hx/roasters/:id", app.roasterRemove, http.MethodDelete)
+		mux.HandleFunc("/hx/roasters/import/preview", app.roasterImportPreviewPost, http.MethodPost)
+		mux.HandleFunc("/hx/roasters/import", app.roasterImportPost, http.MethodPost)
 	})
 	mux.Group(func(mux *flow.Mux) {
 		mux.Use(app.requirePermission("roasters:read"))
 
 		// pages
 		mux.HandleFunc("/roasters", app.roasterList, http.MethodGet)
+		mux.HandleFunc("/roasters/export", app.roasterExport, http.MethodGet)
 		mux.HandleFunc("/roasters/:id", app.roasterView, http.MethodGet)
+		mux.HandleFunc("/roasters/:id/feed.atom", app.roasterFeedAtom, http.MethodGet)
+		mux.HandleFunc("/roasters/:id/feed.rss", app.roasterFeedRSS, http.MethodGet)
 
 		// htmx
 		mux.HandleFunc("/hx/roasters/search", app.roasterSearch, http.MethodGet)
+		mux.HandleFunc("/hx/roasters/suggest", app.roasterSuggest, http.MethodGet)
 	})
 
 	// beans
 	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
 		mux.Use(app.requirePermission("beans:write"))
 
 		// pages
 		mux.HandleFunc("/beans/new", app.beanCreate, http.MethodGet)
 		mux.HandleFunc("/beans/:id/edit", app.beanEdit, http.MethodGet)
+		mux.HandleFunc("/beans/import", app.beanImport, http.MethodGet)
 
 		// htmx
 		mux.HandleFunc("/hx/beans", app.beanCreatePost, http.MethodPost)
 		mux.HandleFunc("/hx/beans/:id", app.beanEditPut, http.MethodPut)
 		mux.HandleFunc("/hx/beans/:id", app.beanRemove, http.MethodDelete)
+		mux.HandleFunc("/hx/beans/import/preview", app.beanImportPreviewPost, http.MethodPost)
+		mux.HandleFunc("/hx/beans/import", app.beanImportPost, http.MethodPost)
 	})
 	mux.Group(func(mux *flow.Mux) {
 		mux.Use(app.requirePermission("beans:read"))
 
 		// pages
 		mux.HandleFunc("/beans", app.beanList, http.MethodGet)
+		mux.HandleFunc("/beans/export", app.beanExport, http.MethodGet)
+		mux.HandleFunc("/beans/feed.atom", app.beanFeedAtom, http.MethodGet)
+		mux.HandleFunc("/beans/feed.rss", app.beanFeedRSS, http.MethodGet)
 		mux.HandleFunc("/beans/:id", app.beanView, http.MethodGet)
 
 		// htmx
 		mux.HandleFunc("/hx/beans/search", app.beanSearch, http.MethodGet)
 	})
 
+	// saved searches and notifications
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
+
+		// htmx
+		mux.HandleFunc("/hx/searches", app.savedSearchCreatePost, http.MethodPost)
+		mux.HandleFunc("/hx/searches/:id", app.savedSearchEditPut, http.MethodPut)
+		mux.HandleFunc("/hx/searches/:id", app.savedSearchRemove, http.MethodDelete)
+		mux.HandleFunc("/hx/notifications/:id/read", app.notificationReadPost, http.MethodPost)
+	})
+
+	// api tokens
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireSessionUser)
+		mux.Use(app.requireActivatedUser)
+
+		// htmx
+		mux.HandleFunc("/hx/tokens", app.apiTokenCreatePost, http.MethodPost)
+		mux.HandleFunc("/hx/tokens/:id", app.apiTokenRevoke, http.MethodDelete)
+	})
+
+	// admin
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requirePermission("analytics:read"))
+
+		// pages
+		mux.HandleFunc("/admin/searches", app.adminSearchAnalytics, http.MethodGet)
+	})
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
+		mux.Use(app.requirePermission("users:write"))
+
+		// pages
+		mux.HandleFunc("/admin/lockouts", app.adminLockouts, http.MethodGet)
+		mux.HandleFunc("/admin/sessions", app.adminSessions, http.MethodGet)
+
+		// htmx
+		mux.HandleFunc("/hx/lockouts/unlock", app.lockoutUnlockPost, http.MethodPost)
+		mux.HandleFunc("/hx/users/:id/sessions/revoke", app.userSessionsRevokePost, http.MethodPost)
+	})
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
+		mux.Use(app.requirePermission("webhooks:write"))
+
+		// pages
+		mux.HandleFunc("/admin/webhooks", app.adminWebhookList, http.MethodGet)
+		mux.HandleFunc("/admin/webhooks/:id", app.adminWebhookView, http.MethodGet)
+
+		// htmx
+		mux.HandleFunc("/hx/webhooks", app.webhookCreatePost, http.MethodPost)
+		mux.HandleFunc("/hx/webhooks/:id", app.webhookEditPut, http.MethodPut)
+		mux.HandleFunc("/hx/webhooks/:id", app.webhookRemove, http.MethodDelete)
+		mux.HandleFunc("/hx/webhooks/:id/deliveries/:delivery/redeliver", app.webhookRedeliverPost, http.MethodPost)
+	})
+
+	// api
+	app.apiRoutes(mux)
+
+	// api docs
+	mux.HandleFunc("/api/openapi.json", app.apiSpec, http.MethodGet)
+	mux.HandleFunc("/api/docs", app.apiDocs, http.MethodGet)
+
 	// user pages
 	mux.HandleFunc("/user/signup", app.userSignup, http.MethodGet)
 	mux.HandleFunc("/user/login", app.userLogin, http.MethodGet)
+	mux.HandleFunc("/user/login/2fa", app.userLoginTwoFactor, http.MethodGet)
+	mux.HandleFunc("/user/login/oidc/:provider", app.userLoginOIDC, http.MethodGet)
+	mux.HandleFunc("/user/login/oidc/:provider/callback", app.userLoginOIDCCallback, http.MethodGet)
+	mux.HandleFunc("/user/activate", app.userActivate, http.MethodGet)
+	mux.HandleFunc("/user/password/forgot", app.userPasswordForgot, http.MethodGet)
+	mux.HandleFunc("/user/password/reset", app.userPasswordReset, http.MethodGet)
 	mux.HandleFunc("/account", app.userAccountView, http.MethodGet)
+	mux.HandleFunc("/account/email/confirm", app.accountEmailConfirm, http.MethodGet)
 
 	// user htmx
 	mux.HandleFunc("/hx/user/signup", app.userSignupPost, http.MethodPost)
 	mux.HandleFunc("/hx/user/login", app.userLoginPost, http.MethodPost)
+	mux.HandleFunc("/hx/user/login/2fa", app.userLoginTwoFactorPost, http.MethodPost)
+	mux.HandleFunc("/user/login/passkey/options", app.userLoginPasskeyOptionsPost, http.MethodPost)
+	mux.HandleFunc("/hx/user/login/passkey", app.userLoginPasskeyPost, http.MethodPost)
 	mux.HandleFunc("/hx/user/logout", app.userLogoutPost, http.MethodPost)
+	mux.HandleFunc("/hx/user/activate", app.userActivatePost, http.MethodPost)
+	mux.HandleFunc("/hx/user/password/forgot", app.userPasswordForgotPost, http.MethodPost)
+	mux.HandleFunc("/hx/user/password/reset", app.userPasswordResetPost, http.MethodPost)
+	mux.HandleFunc("/hx/account/email/confirm", app.accountEmailConfirmPost, http.MethodPost)
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireSessionUser)
+
+		mux.HandleFunc("/hx/user/activation", app.userActivationResendPost, http.MethodPost)
+
+		// account settings
+		mux.HandleFunc("/account/settings", app.accountSettings, http.MethodGet)
+		mux.HandleFunc("/hx/account/name", app.accountNamePut, http.MethodPut)
+		mux.HandleFunc("/hx/account/email", app.accountEmailPut, http.MethodPut)
+		mux.HandleFunc("/hx/account/password", app.accountPasswordPut, http.MethodPut)
+
+		// signing in again instead of entering the current password
+		mux.HandleFunc("/account/reauth/oidc/:provider", app.accountReauthOIDC, http.MethodGet)
+		mux.HandleFunc("/hx/account/reauth/passkey", app.accountReauthPasskeyPost, http.MethodPost)
+
+		// personal data
+		mux.HandleFunc("/account/export", app.accountExport, http.MethodGet)
+		mux.HandleFunc("/hx/account/delete", app.accountDeletePost, http.MethodPost)
+		mux.HandleFunc("/hx/account/delete/cancel", app.accountDeleteCancelPost, http.MethodPost)
+
+		// two-factor authentication
+		mux.HandleFunc("/account/2fa", app.accountTwoFactor, http.MethodGet)
+		mux.HandleFunc("/account/2fa/qr.png", app.accountTwoFactorQR, http.MethodGet)
+		mux.HandleFunc("/hx/account/2fa", app.accountTwoFactorEnablePost, http.MethodPost)
+		mux.HandleFunc("/hx/account/2fa/disable", app.accountTwoFactorDisablePost, http.MethodPost)
+		mux.HandleFunc("/hx/account/2fa/recovery-codes", app.accountRecoveryCodesPost, http.MethodPost)
+
+		// passkeys
+		mux.HandleFunc("/account/passkeys/options", app.passkeyCreateOptionsPost, http.MethodPost)
+		mux.HandleFunc("/hx/passkeys", app.passkeyCreatePost, http.MethodPost)
+		mux.HandleFunc("/hx/passkeys/:id", app.passkeyRemove, http.MethodDelete)
+
+		// sessions
+		mux.HandleFunc("/hx/account/sessions/others", app.accountSessionsOthersPost, http.MethodPost)
+		mux.HandleFunc("/hx/account/sessions/:id", app.accountSessionRemove, http.MethodDelete)
+	})
 
 	return mux
 }
+
+// apiRoutes registers the /api/v1 routes and returns them as "METHOD pattern";
+// openapi_test.go checks them against the documented operations
+func (app *application) apiRoutes(mux *flow.Mux) []string {
+	var registered []string
+	apiHandleFunc := func(mux *flow.Mux, pattern string, handler http.HandlerFunc, method string) {
+		registered = append(registered, method+" "+pattern)
+		mux.HandleFunc(pattern, handler, method)
+	}
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
+		mux.Use(app.requirePermission("roasters:write"))
+
+		apiHandleFunc(mux, "/api/v1/roasters", app.apiRoasterCreate, http.MethodPost)
+		apiHandleFunc(mux, "/api/v1/roasters/:id", app.apiRoasterUpdate, http.MethodPut)
+		apiHandleFunc(mux, "/api/v1/roasters/:id", app.apiRoasterDelete, http.MethodDelete)
+		apiHandleFunc(mux, "/api/v1/roasters/import", app.apiRoasterImport, http.MethodPost)
+	})
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requirePermission("roasters:read"))
+
+		apiHandleFunc(mux, "/api/v1/roasters", app.apiRoasterList, http.MethodGet)
+		apiHandleFunc(mux, "/api/v1/roasters/export", app.roasterExport, http.MethodGet)
+		apiHandleFunc(mux, "/api/v1/roasters/:id", app.apiRoasterView, http.MethodGet)
+	})
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireActivatedUser)
+		mux.Use(app.requirePermission("beans:write"))
+
+		apiHandleFunc(mux, "/api/v1/beans", app.apiBeanCreate, http.MethodPost)
+		apiHandleFunc(mux, "/api/v1/beans/:id", app.apiBeanUpdate, http.MethodPut)
+		apiHandleFunc(mux, "/api/v1/beans/:id", app.apiBeanDelete, http.MethodDelete)
+		apiHandleFunc(mux, "/api/v1/beans/import", app.apiBeanImport, http.MethodPost)
+	})
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requirePermission("beans:read"))
+
+		apiHandleFunc(mux, "/api/v1/beans", app.apiBeanList, http.MethodGet)
+		apiHandleFunc(mux, "/api/v1/beans/export", app.beanExport, http.MethodGet)
+		apiHandleFunc(mux, "/api/v1/beans/:id", app.apiBeanView, http.MethodGet)
+	})
+	apiHandleFunc(mux, "/api/v1/users", app.apiUserCreate, http.MethodPost)
+	apiHandleFunc(mux, "/api/v1/users/activate", app.apiUserActivate, http.MethodPost)
+	apiHandleFunc(mux, "/api/v1/users/password/forgot", app.apiUserPasswordForgot, http.MethodPost)
+	apiHandleFunc(mux, "/api/v1/users/password/reset", app.apiUserPasswordReset, http.MethodPost)
+	apiHandleFunc(mux, "/api/v1/users/login", app.apiUserLogin, http.MethodPost)
+	apiHandleFunc(mux, "/api/v1/users/login/2fa", app.apiUserLoginTwoFactor, http.MethodPost)
+	apiHandleFunc(mux, "/api/v1/users/logout", app.apiUserLogout, http.MethodPost)
+	mux.Group(func(mux *flow.Mux) {
+		mux.Use(app.requireAuthenticatedUser)
+
+		apiHandleFunc(mux, "/api/v1/users/me", app.apiUserMe, http.MethodGet)
+	})
+
+	return registered
+}
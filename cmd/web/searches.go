@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// saved search create hx
+func (app *application) savedSearchCreatePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form; the bean filter fields are included from the filter form
+	input := &model.SavedSearchCreateInput{
+		UserID: app.contextGetUser(r).ID,
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	filter := &model.BeanFilterInput{}
+	err = app.decodePostForm(r, filter)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	input.Query = filter.Query()
+	td.SavedSearchCreate = input
+
+	// try to insert
+	search, err := app.services.SavedSearches.Create(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "beanlist.gohtml", "savesearch", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.SavedSearch = search
+
+	// display success message with a cleared form
+	td.SavedSearchCreate = &model.SavedSearchCreateInput{}
+	td.Result = true
+	app.render(w, r, http.StatusOK, "beanlist.gohtml", "savesearch", td)
+}
+
+// saved search edit hx
+func (app *application) savedSearchEditPut(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// read id from path
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	// decode input form
+	input := &model.SavedSearchEditInput{
+		ID:     id,
+		UserID: app.contextGetUser(r).ID,
+	}
+	err = app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+
+	// update saved search
+	search, err := app.services.SavedSearches.Update(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			td.SavedSearchEdit = input // only re-populate input form if validation error
+			app.render(w, r, http.StatusUnprocessableEntity, "account.gohtml", "savedsearchrow", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.SavedSearchEdit = search.ToEditInput()
+
+	// display updated row
+	app.render(w, r, http.StatusOK, "account.gohtml", "savedsearchrow", td)
+}
+
+// saved search remove hx
+func (app *application) savedSearchRemove(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	err = app.services.SavedSearches.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// 200 ok default response
+}
+
+// notification mark read hx
+func (app *application) notificationReadPost(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	err = app.services.Notifications.MarkRead(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// 200 ok default response
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// only production is crawled; staging and development copies of the site must
+// never show up in search results
+func (app *application) indexable() bool {
+	return app.config.env == "production"
+}
+
+// robots.txt
+func (app *application) robotsTxt(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if app.indexable() {
+		b.WriteString("Disallow: /hx/\n")
+		b.WriteString("Disallow: /api/\n")
+		b.WriteString("Disallow: /admin/\n")
+		b.WriteString("Disallow: /account\n")
+		b.WriteString("Disallow: /user/\n")
+		b.WriteString("\n")
+		b.WriteString("Sitemap: " + app.absoluteURL(r, "/sitemap.xml") + "\n")
+	} else {
+		b.WriteString("Disallow: /\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
+
+// sitemaps, https://www.sitemaps.org/protocol.html
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	NS       string         `xml:"xmlns,attr"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+// pages that aren't backed by a table
+var sitemapStaticPaths = []string{"/", "/beans", "/roasters"}
+
+// path of one sitemap file, e.g. /sitemaps/beans-1.xml
+func sitemapPath(kind string, page int) string {
+	return fmt.Sprintf("/sitemaps/%s-%d.xml", kind, page)
+}
+
+// parse a sitemap file name like beans-1.xml
+func parseSitemapFile(file string) (*model.SitemapPageInput, bool) {
+	name, ok := strings.CutSuffix(file, ".xml")
+	if !ok {
+		return nil, false
+	}
+	kind, page, ok := strings.Cut(name, "-")
+	if !ok {
+		return nil, false
+	}
+	n, err := strconv.Atoi(page)
+	if err != nil {
+		return nil, false
+	}
+	return &model.SitemapPageInput{Kind: kind, Page: n}, true
+}
+
+// sitemap index listing the static pages and every page of beans and roasters
+func (app *application) sitemapIndex(w http.ResponseWriter, r *http.Request) {
+	index, err := app.services.Sitemaps.Index(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	doc := &sitemapIndex{
+		NS:       sitemapNS,
+		Sitemaps: []sitemapEntry{{Loc: app.absoluteURL(r, "/sitemaps/pages.xml")}},
+	}
+	for _, kind := range model.SitemapKinds() {
+		for page := 1; page <= index.Pages[kind]; page++ {
+			doc.Sitemaps = append(doc.Sitemaps, sitemapEntry{Loc: app.absoluteURL(r, sitemapPath(kind, page))})
+		}
+	}
+
+	app.writeSitemap(w, r, doc)
+}
+
+// sitemap of the static pages
+func (app *application) sitemapStatic(w http.ResponseWriter, r *http.Request) {
+	doc := &urlSet{NS: sitemapNS}
+	for _, path := range sitemapStaticPaths {
+		doc.URLs = append(doc.URLs, sitemapURL{Loc: app.absoluteURL(r, path)})
+	}
+
+	app.writeSitemap(w, r, doc)
+}
+
+// one page of bean or roaster urls
+func (app *application) sitemapPage(w http.ResponseWriter, r *http.Request) {
+	input, ok := parseSitemapFile(flow.Param(r.Context(), "file"))
+	if !ok {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTFOUND, "sitemap not found"))
+		return
+	}
+
+	page, err := app.services.Sitemaps.Page(r.Context(), input)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	doc := &urlSet{NS: sitemapNS}
+	for _, id := range page.IDs {
+		doc.URLs = append(doc.URLs, sitemapURL{Loc: app.absoluteURL(r, fmt.Sprintf("/%s/%d", page.Kind, id))})
+	}
+
+	app.writeSitemap(w, r, doc)
+}
+
+func (app *application) writeSitemap(w http.ResponseWriter, r *http.Request, doc any) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
+
+// structured data, https://schema.org
+
+type ldOrganization struct {
+	Context     string     `json:"@context,omitempty"`
+	Type        string     `json:"@type"`
+	ID          string     `json:"@id,omitempty"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	SameAs      string     `json:"sameAs,omitempty"`
+	Address     *ldAddress `json:"address,omitempty"`
+}
+
+type ldAddress struct {
+	Type            string `json:"@type"`
+	AddressLocality string `json:"addressLocality"`
+}
+
+type ldProduct struct {
+	Context            string             `json:"@context"`
+	Type               string             `json:"@type"`
+	ID                 string             `json:"@id"`
+	Name               string             `json:"name"`
+	URL                string             `json:"url"`
+	Category           string             `json:"category"`
+	AdditionalProperty []ldPropertyValue  `json:"additionalProperty,omitempty"`
+	Brand              *ldOrganization    `json:"brand,omitempty"`
+	AggregateRating    *ldAggregateRating `json:"aggregateRating,omitempty"`
+}
+
+type ldPropertyValue struct {
+	Type  string `json:"@type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// beans have no ratings yet; left nil so it's omitted until they do
+type ldAggregateRating struct {
+	Type        string  `json:"@type"`
+	RatingValue float64 `json:"ratingValue"`
+	RatingCount int     `json:"ratingCount"`
+}
+
+// roasters with a known location are local businesses, others just organizations
+func roasterLD(ro *model.RoasterResponse, baseURL string) *ldOrganization {
+	url := fmt.Sprintf("%s/roasters/%d", baseURL, ro.ID)
+	o := &ldOrganization{
+		Type:        "Organization",
+		ID:          url + "#roaster",
+		Name:        ro.Name,
+		Description: ro.Description,
+		URL:         url,
+		SameAs:      ro.Website,
+	}
+	if ro.Location != "" {
+		o.Type = "LocalBusiness"
+		o.Address = &ldAddress{Type: "PostalAddress", AddressLocality: ro.Location}
+	}
+	return o
+}
+
+// structured data for a roaster page
+func roasterPageLD(ro *model.RoasterResponse, baseURL string) *ldOrganization {
+	o := roasterLD(ro, baseURL)
+	o.Context = "https://schema.org"
+	return o
+}
+
+// structured data for a bean page
+func beanPageLD(b *model.BeanResponse, baseURL string) *ldProduct {
+	url := fmt.Sprintf("%s/beans/%d", baseURL, b.ID)
+	p := &ldProduct{
+		Context:  "https://schema.org",
+		Type:     "Product",
+		ID:       url + "#product",
+		Name:     b.Name,
+		URL:      url,
+		Category: "Coffee beans",
+		AdditionalProperty: []ldPropertyValue{
+			{Type: "PropertyValue", Name: "Roast level", Value: string(b.RoastLevel)},
+		},
+	}
+	if b.Roaster != nil {
+		p.Brand = roasterLD(b.Roaster, baseURL)
+	}
+	return p
+}
+
+// JSON for a <script type='application/ld+json'> element; json.Marshal escapes
+// <, > and &, so names can't close the script
+func jsonLD(v any) (template.JS, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(out), nil
+}
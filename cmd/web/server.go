@@ -23,6 +23,11 @@ func (app *application) serve() error {
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	// start periodic background jobs; cancelled once the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.startJobs(jobsCtx)
+
 	// define chan to receive errors returned by Shutdown()
 	shutdownError := make(chan error)
 
@@ -49,8 +54,9 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
-		// wait for any background tasks to finish
+		// stop periodic jobs and wait for any background tasks to finish
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
+		stopJobs()
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// deleteStoredSessions deletes sessions from the session store by token, for
+// sessions ended from another request. Sessions whose token was renewed since
+// it was recorded are missed, but end on their next request as their record is
+// gone
+func (app *application) deleteStoredSessions(ctx context.Context, tokens []string) error {
+	for _, token := range tokens {
+		var err error
+		if store, ok := app.sessionManager.Store.(scs.CtxStore); ok {
+			err = store.DeleteCtx(ctx, token)
+		} else {
+			err = app.sessionManager.Store.Delete(token)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeUserSessions ends every session of the user, wherever it is, except
+// the current one when keepCurrent is set
+func (app *application) revokeUserSessions(r *http.Request, userID int64, keepCurrent bool) error {
+	keepKey := ""
+	if keepCurrent {
+		keepKey = app.sessionManager.GetString(r.Context(), "sessionKey")
+	}
+
+	tokens, err := app.services.Sessions.RevokeAll(r.Context(), userID, keepKey)
+	if err != nil {
+		return err
+	}
+
+	return app.deleteStoredSessions(r.Context(), tokens)
+}
+
+// signOutEverywhere ends the current session and every other session of the
+// user, e.g. after their password was reset
+func (app *application) signOutEverywhere(r *http.Request, userID int64) error {
+	err := app.sessionManager.Destroy(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return app.revokeUserSessions(r, userID, false)
+}
+
+// signOutOtherSessions keeps the user signed in under a new session token and
+// ends all their other sessions, e.g. after they changed their password
+func (app *application) signOutOtherSessions(r *http.Request, userID int64) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return app.revokeUserSessions(r, userID, true)
+}
+
+// signIn puts the user in the session and records where it was started from.
+// The session token should be renewed first
+func (app *application) signIn(r *http.Request, userID int64) error {
+	// a session signed in again replaces its record
+	err := app.signOut(r)
+	if err != nil {
+		return err
+	}
+
+	key, err := model.NewSessionKey()
+	if err != nil {
+		return err
+	}
+
+	err = app.services.Sessions.Start(r.Context(), &model.UserSessionParams{
+		UserID:    userID,
+		Key:       key,
+		Token:     app.sessionManager.Token(r.Context()),
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+	app.sessionManager.Put(r.Context(), "sessionKey", key)
+
+	return nil
+}
+
+// signOut takes the user out of the session and forgets its record
+func (app *application) signOut(r *http.Request) error {
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	key := app.sessionManager.PopString(r.Context(), "sessionKey")
+	if key == "" {
+		return nil
+	}
+
+	return app.services.Sessions.End(r.Context(), key)
+}
+
+// sessionSeen records the signed-in session being used. False means it was
+// revoked and should be ended
+func (app *application) sessionSeen(r *http.Request, userID int64) (bool, error) {
+	key := app.sessionManager.GetString(r.Context(), "sessionKey")
+
+	// sessions signed in before they were recorded get a record now
+	if key == "" {
+		return true, app.signIn(r, userID)
+	}
+
+	return app.services.Sessions.Seen(r.Context(), &model.UserSessionParams{
+		UserID:    userID,
+		Key:       key,
+		Token:     app.sessionManager.Token(r.Context()),
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+}
+
+// how long the second login step may take, and how many codes it may try,
+// before the password has to be entered again
+const (
+	pendingTwoFactorTTL      = 5 * time.Minute
+	pendingTwoFactorAttempts = 5
+)
+
+// startLogin is called once the password checks out. Users with 2fa on are
+// parked in a "password verified, pending 2fa" state that doesn't sign them in;
+// everyone else is signed in straight away
+func (app *application) startLogin(w http.ResponseWriter, r *http.Request, user *model.UserResponse) {
+	if !user.TwoFactorEnabled {
+		app.completeLogin(w, r, user)
+		return
+	}
+
+	err := app.startPendingTwoFactor(r, user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.loginRedirect(w, r, "/user/login/2fa", "password verified; redirecting to two-factor authentication")
+}
+
+// startPendingTwoFactor parks the user in the session until the second login
+// step; shared by browser and api logins
+func (app *application) startPendingTwoFactor(r *http.Request, userID int64) error {
+	// change session token to avoid session fixation
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "pendingTwoFactorUserID", userID)
+	app.sessionManager.Put(r.Context(), "pendingTwoFactorExpiry", time.Now().Add(pendingTwoFactorTTL))
+	app.sessionManager.Put(r.Context(), "pendingTwoFactorAttempts", 0)
+
+	return nil
+}
+
+// completeLogin signs the user in
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *model.UserResponse) {
+	// change session token to avoid session fixation
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.clearPendingTwoFactor(r)
+
+	// add user id to session
+	err = app.signIn(r, user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// send users whose role requires 2fa to set it up first
+	required, err := app.requiresTwoFactor(user)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if required && !user.TwoFactorEnabled {
+		app.loginRedirect(w, r, "/account/2fa", "successfully logged in; redirecting to two-factor setup")
+		return
+	}
+
+	// redirect to home
+	app.loginRedirect(w, r, "/", "successfully logged in; redirecting to home")
+}
+
+// loginRedirect sends the browser on after a login step; htmx requests are
+// told to redirect, plain page loads like a single sign-on callback redirected
+func (app *application) loginRedirect(w http.ResponseWriter, r *http.Request, url string, message string) {
+	if r.Header.Get("HX-Request") == "" {
+		http.Redirect(w, r, url, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", url)
+	w.Write([]byte(message))
+}
+
+// pendingTwoFactorUserID returns the user waiting on the second login step, or
+// 0 if there is none or it took too long
+func (app *application) pendingTwoFactorUserID(r *http.Request) int64 {
+	userID := app.sessionManager.GetInt64(r.Context(), "pendingTwoFactorUserID")
+	if userID == 0 {
+		return 0
+	}
+
+	if time.Now().After(app.sessionManager.GetTime(r.Context(), "pendingTwoFactorExpiry")) {
+		app.clearPendingTwoFactor(r)
+		return 0
+	}
+
+	return userID
+}
+
+// failedTwoFactorAttempt counts a wrong code against the pending login and
+// ends the login once too many were tried; reports whether it ended
+func (app *application) failedTwoFactorAttempt(r *http.Request) bool {
+	attempts := app.sessionManager.GetInt(r.Context(), "pendingTwoFactorAttempts") + 1
+	if attempts >= pendingTwoFactorAttempts {
+		app.clearPendingTwoFactor(r)
+		return true
+	}
+	app.sessionManager.Put(r.Context(), "pendingTwoFactorAttempts", attempts)
+	return false
+}
+
+func (app *application) clearPendingTwoFactor(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "pendingTwoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "pendingTwoFactorExpiry")
+	app.sessionManager.Remove(r.Context(), "pendingTwoFactorAttempts")
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// account settings page
+func (app *application) accountSettings(w http.ResponseWriter, r *http.Request) {
+	td, err := app.settingsTemplateData(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "settings.gohtml", "base", td)
+}
+
+// settingsTemplateData fills the settings forms with current values, and the
+// ways the user can sign in again instead of entering their password
+func (app *application) settingsTemplateData(r *http.Request) (*templateData, error) {
+	td := app.newTemplateData(r)
+
+	user := app.contextGetUser(r)
+	td.User = user
+
+	// render forms with current values
+	td.Reauthenticated = app.reauthenticated(r)
+	td.UserNameEdit = user.ToNameEditInput()
+	td.UserEmailEdit = user.ToEmailEditInput()
+	td.UserPasswordEdit = user.ToPasswordEditInput()
+	td.UserPasswordEdit.Reauthenticated = td.Reauthenticated
+	td.AccountDelete = &model.AccountDeleteInput{Reauthenticated: td.Reauthenticated}
+
+	// identity providers linked to the account that are still configured
+	linked, err := app.services.OIDC.LinkedProviders(r.Context(), user.ID)
+	if err != nil {
+		return td, err
+	}
+	td.SSOProviders = []ssoProvider{}
+	for _, p := range app.ssoProviders() {
+		if slices.Contains(linked, p.Name) {
+			td.SSOProviders = append(td.SSOProviders, p)
+		}
+	}
+
+	td.Passkeys, err = app.services.Passkeys.ListForUser(r.Context(), user.ID)
+	if err != nil {
+		return td, err
+	}
+	td.PasskeyLogin = &model.PasskeyLoginInput{}
+	td.OIDCLogin = &model.OIDCLoginInput{}
+
+	return td, nil
+}
+
+// settings forms share a version input; a 409 asks the user to reload instead of
+// overwriting a change made elsewhere
+const settingsConflictMessage = "your account was changed somewhere else since this page was loaded; reload it and try again"
+
+// account name edit hx
+func (app *application) accountNamePut(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.UserNameEditInput{
+		ID: app.contextGetUser(r).ID,
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserNameEdit = input
+
+	// update name
+	user, err := app.services.Users.ChangeName(r.Context(), input)
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRUNPROCESSABLE:
+			app.render(w, r, http.StatusUnprocessableEntity, "settings.gohtml", "nameform", td)
+		case errs.ERRCONFLICT:
+			input.AddNonFieldError(settingsConflictMessage)
+			app.render(w, r, http.StatusConflict, "settings.gohtml", "nameform", td)
+		default:
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.User = user
+	td.UserNameEdit = user.ToNameEditInput()
+
+	// display success
+	td.Result = true
+	app.render(w, r, http.StatusOK, "settings.gohtml", "nameform", td)
+}
+
+// account email edit hx
+func (app *application) accountEmailPut(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.UserEmailEditInput{
+		ID: app.contextGetUser(r).ID,
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserEmailEdit = input
+	td.User = app.contextGetUser(r)
+
+	// store the pending email and send it the confirmation link
+	user, err := app.services.Users.ChangeEmail(r.Context(), input, app.emailURL("/account/email/confirm"))
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRUNPROCESSABLE:
+			app.render(w, r, http.StatusUnprocessableEntity, "settings.gohtml", "emailform", td)
+		case errs.ERRCONFLICT:
+			input.AddNonFieldError(settingsConflictMessage)
+			app.render(w, r, http.StatusConflict, "settings.gohtml", "emailform", td)
+		default:
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.User = user
+	td.UserEmailEdit = user.ToEmailEditInput()
+
+	// display success
+	td.Result = true
+	app.render(w, r, http.StatusOK, "settings.gohtml", "emailform", td)
+}
+
+// account password edit hx
+func (app *application) accountPasswordPut(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.UserPasswordEditInput{
+		ID:              app.contextGetUser(r).ID,
+		Reauthenticated: app.reauthenticated(r),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserPasswordEdit = input
+	td.Reauthenticated = input.Reauthenticated
+
+	// check the current password, unless the user signed in again, and update
+	user, err := app.services.Users.ChangePassword(r.Context(), input)
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRUNPROCESSABLE:
+			app.render(w, r, http.StatusUnprocessableEntity, "settings.gohtml", "passwordform", td)
+		case errs.ERRCONFLICT:
+			input.AddNonFieldError(settingsConflictMessage)
+			app.render(w, r, http.StatusConflict, "settings.gohtml", "passwordform", td)
+		default:
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.User = user
+	td.UserPasswordEdit = user.ToPasswordEditInput()
+	td.UserPasswordEdit.Reauthenticated = input.Reauthenticated
+
+	// new session token for this browser; everywhere else is signed out
+	err = app.signOutOtherSessions(r, user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// display success
+	td.Result = true
+	app.render(w, r, http.StatusOK, "settings.gohtml", "passwordform", td)
+}
+
+// email change confirmation page; like activation, only submitting the form
+// uses up the token
+func (app *application) accountEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	td.UserEmailConfirm = &model.UserEmailConfirmInput{Token: r.URL.Query().Get("token")}
+	app.render(w, r, http.StatusOK, "emailconfirm.gohtml", "base", td)
+}
+
+// email change confirmation hx
+func (app *application) accountEmailConfirmPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.UserEmailConfirmInput{}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserEmailConfirm = input
+
+	user, err := app.services.Users.ConfirmEmail(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "emailconfirm.gohtml", "form", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.User = user
+
+	// display success
+	td.Result = true
+	app.render(w, r, http.StatusOK, "emailconfirm.gohtml", "form", td)
+}
+
+// sign out a session hx; revoking the current one signs this browser out
+func (app *application) accountSessionRemove(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	key, token, err := app.services.Sessions.Revoke(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if key == app.sessionManager.GetString(r.Context(), "sessionKey") {
+		err = app.sessionManager.Destroy(r.Context())
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		w.Header().Add("HX-Redirect", "/user/login")
+		w.Write([]byte("signed out; redirecting to login"))
+		return
+	}
+
+	err = app.deleteStoredSessions(r.Context(), []string{token})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// 200 ok default response
+}
+
+// sign out everywhere else hx
+func (app *application) accountSessionsOthersPost(w http.ResponseWriter, r *http.Request) {
+	err := app.signOutOtherSessions(r, app.contextGetUser(r).ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// reload the account page, only this session is left on it
+	w.Header().Add("HX-Redirect", "/account")
+	w.Write([]byte("signed out everywhere else; reloading account"))
+}
@@ -13,29 +13,98 @@ import (
 )
 
 type templateData struct {
-	Bean          *model.BeanResponse
-	Beans         []*model.BeanResponse
-	BeanCreate    *model.BeanCreateInput
-	BeanEdit      *model.BeanEditInput
-	BeanFilter    *model.BeanFilterInput
-	Roaster       *model.RoasterResponse
-	Roasters      []*model.RoasterResponse
-	RoasterCreate *model.RoasterCreateInput
-	RoasterEdit   *model.RoasterEditInput
-	RoasterFilter *model.RoasterFilterInput
-	User          *model.UserResponse
-	UserCreate    *model.UserCreateInput
-	UserLogin     *model.UserLoginInput
+	Bean                    *model.BeanResponse
+	Beans                   []*model.BeanResponse
+	BeanCreate              *model.BeanCreateInput
+	BeanEdit                *model.BeanEditInput
+	BeanFilter              *model.BeanFilterInput
+	SimilarBeans            []*model.BeanSimilarityResponse
+	Roaster                 *model.RoasterResponse
+	Roasters                []*model.RoasterResponse
+	RoasterCreate           *model.RoasterCreateInput
+	RoasterEdit             *model.RoasterEditInput
+	RoasterFilter           *model.RoasterFilterInput
+	EditConflict            *model.EditConflict
+	Import                  *model.ImportInput
+	ImportKind              string
+	ImportResult            *model.ImportResponse
+	Notifications           []*model.NotificationResponse
+	SavedSearch             *model.SavedSearchResponse
+	SavedSearches           []*model.SavedSearchResponse
+	SavedSearchCreate       *model.SavedSearchCreateInput
+	SavedSearchEdit         *model.SavedSearchEditInput
+	SearchAnalytics         *model.SearchAnalyticsResponse
+	SearchAnalyticsFilter   *model.SearchAnalyticsInput
+	User                    *model.UserResponse
+	APIToken                *model.APITokenResponse
+	APITokens               []*model.APITokenResponse
+	APITokenCreate          *model.APITokenCreateInput
+	UserCreate              *model.UserCreateInput
+	UserLogin               *model.UserLoginInput
+	UserActivate            *model.UserActivateInput
+	UserPasswordForgot      *model.UserPasswordForgotInput
+	UserPasswordReset       *model.UserPasswordResetInput
+	UserNameEdit            *model.UserNameEditInput
+	UserEmailEdit           *model.UserEmailEditInput
+	UserEmailConfirm        *model.UserEmailConfirmInput
+	UserPasswordEdit        *model.UserPasswordEditInput
+	AccountDelete           *model.AccountDeleteInput
+	TwoFactor               *model.TwoFactorResponse
+	TwoFactorRequired       bool
+	TwoFactorEnable         *model.TwoFactorEnableInput
+	TwoFactorDisable        *model.TwoFactorPasswordInput
+	TwoFactorLogin          *model.TwoFactorLoginInput
+	TOTPSecret              string
+	RecoveryCodes           *model.RecoveryCodesResponse
+	RecoveryCodesRegenerate *model.TwoFactorPasswordInput
+	Passkey                 *model.PasskeyResponse
+	Passkeys                []*model.PasskeyResponse
+	PasskeyCreate           *model.PasskeyCreateInput
+	PasskeyLogin            *model.PasskeyLoginInput
+	LoginThrottles          []*model.LoginThrottleResponse
+	UserSessions            []*model.UserSessionResponse
+	OIDCLogin               *model.OIDCLoginInput
+	SSOProviders            []ssoProvider
+	Reauthenticated         bool // signed in again recently, so no current password is needed
+	Webhook                 *model.WebhookResponse
+	Webhooks                []*model.WebhookResponse
+	WebhookCreate           *model.WebhookCreateInput
+	WebhookEdit             *model.WebhookEditInput
+	WebhookDelivery         *model.WebhookDeliveryResponse
+	WebhookDeliveries       []*model.WebhookDeliveryResponse
 	// User            *model.User
+	Feeds           []feedLink
+	BaseURL         string
 	Result          bool
 	IsAuthenticated bool
 }
 
-var functions = template.FuncMap{}
+var functions = template.FuncMap{
+	"beanListURL":   beanListURL,
+	"beanPageLD":    beanPageLD,
+	"jsonLD":        jsonLD,
+	"percent":       percent,
+	"roastLevels":   model.RoastLevels,
+	"roasterPageLD": roasterPageLD,
+}
+
+// share of n in total as a whole percentage, e.g. for bar widths
+func percent(n int, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	return n * 100 / total
+}
+
+// link to the bean list page filtered by a url query string
+func beanListURL(query string) string {
+	return "/beans?" + query
+}
 
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
 		IsAuthenticated: app.isAuthenticated(r),
+		BaseURL:         app.absoluteURL(r, ""),
 	}
 }
 
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"github.com/pquerna/otp"
+)
+
+// size of the enrollment QR code in pixels
+const totpQRSize = 200
+
+// two-factor settings page; while 2fa is off it shows a QR code for a new secret
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	user := app.contextGetUser(r)
+	td.User = user
+
+	status, err := app.services.TwoFactor.Status(r.Context(), user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.TwoFactor = status
+
+	td.TwoFactorRequired, err = app.requiresTwoFactor(user)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if !status.Enabled {
+		// keep the secret across reloads so an already scanned code stays valid
+		key, err := app.totpEnrollKey(r)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		td.TOTPSecret = key.Secret()
+	}
+
+	// render forms with empty models
+	td.TwoFactorEnable = &model.TwoFactorEnableInput{}
+	td.TwoFactorDisable = &model.TwoFactorPasswordInput{}
+	td.RecoveryCodesRegenerate = &model.TwoFactorPasswordInput{}
+	app.render(w, r, http.StatusOK, "twofactor.gohtml", "base", td)
+}
+
+// totpEnrollKey returns the secret being enrolled, generating one if the
+// session has none yet. It lives in the session, not the database, until the
+// user proves their app has it
+func (app *application) totpEnrollKey(r *http.Request) (*otp.Key, error) {
+	if keyURL := app.sessionManager.GetString(r.Context(), "totpEnrollURL"); keyURL != "" {
+		return otp.NewKeyFromURL(keyURL)
+	}
+
+	key, err := model.NewTOTPKey(app.contextGetUser(r).Email)
+	if err != nil {
+		return nil, err
+	}
+	app.sessionManager.Put(r.Context(), "totpEnrollURL", key.URL())
+
+	return key, nil
+}
+
+// enrollment QR code, rendered as png so the secret never leaves the server
+// for a third party
+func (app *application) accountTwoFactorQR(w http.ResponseWriter, r *http.Request) {
+	keyURL := app.sessionManager.GetString(r.Context(), "totpEnrollURL")
+	if keyURL == "" {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRNOTFOUND, "no two-factor setup in progress"))
+		return
+	}
+
+	key, err := otp.NewKeyFromURL(keyURL)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	img, err := key.Image(totpQRSize, totpQRSize)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err = png.Encode(buf, img)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// enable 2fa hx
+func (app *application) accountTwoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.TwoFactorEnableInput{
+		ID:     app.contextGetUser(r).ID,
+		KeyURL: app.sessionManager.GetString(r.Context(), "totpEnrollURL"),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.TwoFactorEnable = input
+
+	// keep the key for manual entry on screen if the code is wrong
+	td.TOTPSecret, _ = input.Secret()
+
+	codes, err := app.services.TwoFactor.Enable(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "twofactor.gohtml", "enableform", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.RecoveryCodes = codes
+
+	app.sessionManager.Remove(r.Context(), "totpEnrollURL")
+
+	// other sessions never passed the second step
+	err = app.signOutOtherSessions(r, input.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// display recovery codes
+	td.Result = true
+	app.render(w, r, http.StatusOK, "twofactor.gohtml", "enableform", td)
+}
+
+// disable 2fa hx
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	user := app.contextGetUser(r)
+	input := &model.TwoFactorPasswordInput{
+		ID: user.ID,
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.TwoFactorDisable = input
+
+	required, err := app.requiresTwoFactor(user)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if required {
+		input.AddNonFieldError("your role requires two-factor authentication, so it can't be turned off")
+		app.render(w, r, http.StatusUnprocessableEntity, "twofactor.gohtml", "disableform", td)
+		return
+	}
+
+	err = app.services.TwoFactor.Disable(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "twofactor.gohtml", "disableform", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	// reload to show the setup again
+	w.Header().Add("HX-Redirect", "/account/2fa")
+	w.Write([]byte("two-factor authentication disabled; reloading"))
+}
+
+// regenerate recovery codes hx
+func (app *application) accountRecoveryCodesPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.TwoFactorPasswordInput{
+		ID: app.contextGetUser(r).ID,
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.RecoveryCodesRegenerate = input
+
+	codes, err := app.services.TwoFactor.RegenerateRecoveryCodes(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "twofactor.gohtml", "recoveryform", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.RecoveryCodes = codes
+	td.RecoveryCodesRegenerate = &model.TwoFactorPasswordInput{}
+
+	// display recovery codes
+	td.Result = true
+	app.render(w, r, http.StatusOK, "twofactor.gohtml", "recoveryform", td)
+}
+
+// second login step page
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUserID(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	td := app.newTemplateData(r)
+
+	// render form with empty model
+	td.TwoFactorLogin = &model.TwoFactorLoginInput{}
+	app.render(w, r, http.StatusOK, "logintwofactor.gohtml", "base", td)
+}
+
+// second login step hx
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.pendingTwoFactorUserID(r)
+	if userID == 0 {
+		w.Header().Add("HX-Redirect", "/user/login")
+		w.Write([]byte("login expired; redirecting to login"))
+		return
+	}
+
+	td := app.newTemplateData(r)
+
+	// decode input form
+	input := &model.TwoFactorLoginInput{
+		UserID: userID,
+		IP:     clientIP(r),
+	}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.TwoFactorLogin = input
+
+	user, err := app.services.TwoFactor.Verify(r.Context(), input)
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRTOOMANY:
+			// locked out; the password has to be entered again once it's over
+			app.logTwoFactorThrottled(input, err)
+			app.clearPendingTwoFactor(r)
+			app.render(w, r, http.StatusUnprocessableEntity, "logintwofactor.gohtml", "form", td)
+		case errs.ERRUNPROCESSABLE:
+			// too many wrong codes and the password has to be entered again
+			if app.failedTwoFactorAttempt(r) {
+				w.Header().Add("HX-Redirect", "/user/login")
+				w.Write([]byte("too many attempts; redirecting to login"))
+				return
+			}
+
+			app.render(w, r, http.StatusUnprocessableEntity, "logintwofactor.gohtml", "form", td)
+		default:
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// logTwoFactorThrottled records a second login step turned away for too many
+// failures, and lockouts more loudly
+func (app *application) logTwoFactorThrottled(input *model.TwoFactorLoginInput, err error) {
+	if input.LockedOut {
+		app.logger.Warn("login locked out at two-factor step", "user_id", input.UserID, "ip", input.IP, "lockout", app.config.loginThrottle.Lockout.String())
+		return
+	}
+	app.logger.Info("login throttled at two-factor step", "user_id", input.UserID, "ip", input.IP, "reason", errs.ErrorMessage(err))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
@@ -42,11 +44,169 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	}
 	td.User = user
 
-	// TODO: create registration token for user
+	app.loadInitialRole(r, user)
 
-	// redirect to login
-	w.Header().Add("HX-Redirect", "/user/login")
-	w.Write([]byte("user successfully registered; redirecting to login"))
+	// email the activation link
+	app.sendActivationEmail(r, user.ID)
+
+	// redirect to activation
+	w.Header().Add("HX-Redirect", "/user/activate")
+	w.Write([]byte("user successfully registered; redirecting to activation"))
+}
+
+// email a new activation link in the background; failures are only logged, the
+// user can ask for another link from their account page
+func (app *application) sendActivationEmail(r *http.Request, userID int64) {
+	activateURL := app.emailURL("/user/activate")
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err := app.services.Users.SendActivation(ctx, userID, activateURL)
+		if err != nil {
+			app.logger.Error(err.Error(), "user_id", userID)
+		}
+	})
+}
+
+// user activation page; emailed links carry the token in the query, but only
+// submitting the form uses it up, so link scanners can't
+func (app *application) userActivate(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	td.UserActivate = &model.UserActivateInput{Token: r.URL.Query().Get("token")}
+	app.render(w, r, http.StatusOK, "activate.gohtml", "base", td)
+}
+
+// user activation hx
+func (app *application) userActivatePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.UserActivateInput{}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserActivate = input
+
+	user, err := app.services.Users.Activate(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "activate.gohtml", "form", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.User = user
+
+	// display success
+	td.Result = true
+	app.render(w, r, http.StatusOK, "activate.gohtml", "form", td)
+}
+
+// resend activation email hx
+func (app *application) userActivationResendPost(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.services.Users.SendActivation(r.Context(), user.ID, app.emailURL("/user/activate"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.Write([]byte("activation email sent to " + user.Email))
+}
+
+// forgot password page
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// render form with empty model
+	td.UserPasswordForgot = &model.UserPasswordForgotInput{}
+	app.render(w, r, http.StatusOK, "passwordforgot.gohtml", "base", td)
+}
+
+// forgot password hx
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.UserPasswordForgotInput{}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserPasswordForgot = input
+
+	// email the reset link
+	app.sendPasswordResetEmail(r, input)
+
+	// the same answer whether or not the email is registered
+	td.Result = true
+	app.render(w, r, http.StatusOK, "passwordforgot.gohtml", "form", td)
+}
+
+// email a password reset link in the background, so the response takes as long
+// for registered emails as for unknown ones; failures are only logged
+func (app *application) sendPasswordResetEmail(r *http.Request, input *model.UserPasswordForgotInput) {
+	resetURL := app.emailURL("/user/password/reset")
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err := app.services.Users.SendPasswordReset(ctx, input, resetURL)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+}
+
+// reset password page; like activation, the token is only used up by the form
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	td.UserPasswordReset = &model.UserPasswordResetInput{Token: r.URL.Query().Get("token")}
+	app.render(w, r, http.StatusOK, "passwordreset.gohtml", "base", td)
+}
+
+// reset password hx
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.UserPasswordResetInput{}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.UserPasswordReset = input
+
+	user, err := app.services.Users.ResetPassword(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "passwordreset.gohtml", "form", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.signOutEverywhere(r, user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// display success
+	td.Result = true
+	app.render(w, r, http.StatusOK, "passwordreset.gohtml", "form", td)
 }
 
 // user login page
@@ -55,6 +215,8 @@ func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 
 	// render form with empty model
 	td.UserLogin = &model.UserLoginInput{}
+	td.PasskeyLogin = &model.PasskeyLoginInput{}
+	td.SSOProviders = app.ssoProviders()
 	app.render(w, r, http.StatusOK, "login.gohtml", "base", td)
 }
 
@@ -62,7 +224,9 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	td := app.newTemplateData(r)
 
 	// parse and decode form
-	input := &model.UserLoginInput{}
+	input := &model.UserLoginInput{
+		IP: clientIP(r),
+	}
 	err := app.decodePostForm(r, input)
 	if err != nil {
 		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
@@ -72,30 +236,31 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.services.Users.Login(r.Context(), input)
 	if err != nil {
-		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+		switch errs.ErrorCode(err) {
+		case errs.ERRTOOMANY:
+			app.logLoginThrottled(input, err)
 			app.render(w, r, http.StatusUnprocessableEntity, "login.gohtml", "form", td)
-		} else {
+		case errs.ERRUNPROCESSABLE:
+			app.render(w, r, http.StatusUnprocessableEntity, "login.gohtml", "form", td)
+		default:
 			app.errorResponse(w, r, err)
 		}
 		return
 	}
-	td.User = user
 
 	// TODO: should i move the session stuff to service?
 
-	// change session token to avoid session fixation
-	err = app.sessionManager.RenewToken(r.Context())
-	if err != nil {
-		app.errorResponse(w, r, err)
+	app.startLogin(w, r, user)
+}
+
+// logLoginThrottled records a login turned away for too many failures, and
+// lockouts more loudly
+func (app *application) logLoginThrottled(input *model.UserLoginInput, err error) {
+	if input.LockedOut {
+		app.logger.Warn("login locked out", "email", input.Email, "ip", input.IP, "lockout", app.config.loginThrottle.Lockout.String())
 		return
 	}
-
-	// add user id to session
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", user.ID)
-
-	// redirect to home
-	w.Header().Add("HX-Redirect", "/")
-	w.Write([]byte("successfully logged in; redirecting to home"))
+	app.logger.Info("login throttled", "email", input.Email, "ip", input.IP, "reason", errs.ErrorMessage(err))
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
@@ -107,7 +272,12 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// remove user id from session
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	err = app.signOut(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.clearPendingTwoFactor(r)
 
 	// redirect to home
 	w.Header().Add("HX-Redirect", "/")
@@ -125,5 +295,43 @@ func (app *application) userAccountView(w http.ResponseWriter, r *http.Request)
 	td := app.newTemplateData(r)
 	td.User = user
 
+	// read saved searches and latest notifications of user
+	searches, err := app.services.SavedSearches.ListForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.SavedSearches = searches
+
+	notifications, err := app.services.Notifications.ListForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.Notifications = notifications
+
+	tokens, err := app.services.APITokens.ListForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.APITokens = tokens
+	td.APITokenCreate = &model.APITokenCreateInput{}
+
+	passkeys, err := app.services.Passkeys.ListForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.Passkeys = passkeys
+	td.PasskeyCreate = &model.PasskeyCreateInput{}
+
+	sessions, err := app.services.Sessions.ListForUser(r.Context(), user.ID, app.sessionManager.GetString(r.Context(), "sessionKey"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.UserSessions = sessions
+
 	app.render(w, r, http.StatusOK, "account.gohtml", "base", td)
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// webhook list page
+func (app *application) adminWebhookList(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	webhooks, err := app.services.Webhooks.List(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.Webhooks = webhooks
+	td.WebhookCreate = &model.WebhookCreateInput{}
+
+	app.render(w, r, http.StatusOK, "adminwebhooks.gohtml", "base", td)
+}
+
+// webhook view page with delivery log
+func (app *application) adminWebhookView(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	webhook, err := app.services.Webhooks.Get(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.Webhook = webhook
+	td.WebhookEdit = webhook.ToEditInput()
+
+	deliveries, err := app.services.Webhooks.Deliveries(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.WebhookDeliveries = deliveries
+
+	app.render(w, r, http.StatusOK, "adminwebhook.gohtml", "base", td)
+}
+
+// webhook create hx
+func (app *application) webhookCreatePost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// parse and decode form
+	input := &model.WebhookCreateInput{}
+	err := app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+	td.WebhookCreate = input
+
+	// try to insert
+	webhook, err := app.services.Webhooks.Create(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			app.render(w, r, http.StatusUnprocessableEntity, "adminwebhooks.gohtml", "form", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+
+	// go to the new webhook to show its secret
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/admin/webhooks/%d", webhook.ID))
+}
+
+// webhook edit hx
+func (app *application) webhookEditPut(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	// read id from path
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	// decode input form
+	input := &model.WebhookEditInput{
+		ID: id,
+	}
+	err = app.decodePostForm(r, input)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid post form format"))
+		return
+	}
+
+	// update webhook
+	webhook, err := app.services.Webhooks.Update(r.Context(), input)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			td.WebhookEdit = input // only re-populate input form if validation error
+			app.render(w, r, http.StatusUnprocessableEntity, "adminwebhook.gohtml", "form", td)
+		} else {
+			app.errorResponse(w, r, err)
+		}
+		return
+	}
+	td.WebhookEdit = webhook.ToEditInput()
+
+	// display success message with the updated form
+	td.Result = true
+	app.render(w, r, http.StatusOK, "adminwebhook.gohtml", "form", td)
+}
+
+// webhook remove hx
+func (app *application) webhookRemove(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+
+	err = app.services.Webhooks.Delete(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", "/admin/webhooks")
+}
+
+// webhook redeliver hx
+func (app *application) webhookRedeliverPost(w http.ResponseWriter, r *http.Request) {
+	td := app.newTemplateData(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid id format"))
+		return
+	}
+	deliveryID, err := app.readInt64Param(r, "delivery")
+	if err != nil {
+		app.errorResponse(w, r, errs.Errorf(errs.ERRBAD, "invalid delivery id format"))
+		return
+	}
+
+	delivery, err := app.services.Webhooks.Redeliver(r.Context(), deliveryID, id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	td.WebhookDelivery = delivery
+
+	// send right away instead of waiting for the next run
+	app.kickWebhooks()
+
+	// display the queued delivery at the top of the log
+	app.render(w, r, http.StatusOK, "adminwebhook.gohtml", "deliveryrow", td)
+}
@@ -9,13 +9,30 @@ require (
 )
 
 require (
+	github.com/Blank-Xu/sql-adapter v1.0.0
 	github.com/alexedwards/scs/postgresstore v0.0.0-20231113091146-cef4b05350c8
 	github.com/alexedwards/scs/v2 v2.7.0
-	golang.org/x/crypto v0.14.0
+	github.com/casbin/casbin/v2 v2.87.1
+	github.com/coreos/go-oidc/v3 v3.9.0
+	github.com/go-webauthn/webauthn v0.9.4
+	github.com/pquerna/otp v1.4.0
+	golang.org/x/crypto v0.16.0
+	golang.org/x/oauth2 v0.15.0
 )
 
 require (
-	github.com/Blank-Xu/sql-adapter v1.0.0 // indirect
-	github.com/casbin/casbin/v2 v2.87.1 // indirect
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
 	github.com/casbin/govaluate v1.1.0 // indirect
+	github.com/fxamacker/cbor/v2 v2.5.0 // indirect
+	github.com/go-jose/go-jose/v3 v3.0.1 // indirect
+	github.com/go-webauthn/x v0.1.5 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/go-tpm v0.9.0 // indirect
+	github.com/google/uuid v1.4.0 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	google.golang.org/appengine v1.6.8 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
 )
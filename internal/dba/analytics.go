@@ -0,0 +1,146 @@
+package dba
+
+import (
+	"context"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// RecordSearch stores the raw search event and bumps the daily aggregate for its
+// term; a session is only counted once per term and day
+func RecordSearch(ctx context.Context, dbtx DBTX, p *model.SearchEventParams) error {
+	stmt := `
+	WITH seen AS (
+		SELECT EXISTS(
+			SELECT true FROM search_events
+			WHERE kind = $1 AND term = $2 AND session_hash = $4 AND created_at >= CURRENT_DATE
+		) AS before
+	), event AS (
+		INSERT INTO search_events (kind, term, results, session_hash)
+		VALUES ($1, $2, $3, $4)
+	)
+	INSERT INTO search_stats_daily (day, kind, term, searches, sessions, zero_results, last_results)
+	SELECT CURRENT_DATE, $1, $2, 1, CASE WHEN seen.before THEN 0 ELSE 1 END, CASE WHEN $3 = 0 THEN 1 ELSE 0 END, $3
+	FROM seen
+	ON CONFLICT (day, kind, term) DO UPDATE
+	SET searches = search_stats_daily.searches + 1,
+		sessions = search_stats_daily.sessions + EXCLUDED.sessions,
+		zero_results = search_stats_daily.zero_results + EXCLUDED.zero_results,
+		last_results = EXCLUDED.last_results
+	`
+
+	args := []any{p.Kind, p.Term, p.Results, p.SessionHash}
+
+	_, err := dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// GetTopSearchTerms returns the most searched terms since the given day
+func GetTopSearchTerms(ctx context.Context, dbtx DBTX, p *model.SearchAnalyticsParams) ([]*model.SearchTermStatDB, error) {
+	stmt := `
+	SELECT kind, term, SUM(searches), SUM(sessions), SUM(zero_results),
+		(ARRAY_AGG(last_results ORDER BY day DESC))[1]
+	FROM search_stats_daily
+	WHERE day >= $1::date
+	GROUP BY kind, term
+	ORDER BY SUM(searches) DESC, term ASC
+	LIMIT $2
+	`
+
+	return querySearchTermStats(ctx, dbtx, stmt, p.Since, p.Limit)
+}
+
+// GetZeroResultSearchTerms returns terms whose most recent search found nothing
+func GetZeroResultSearchTerms(ctx context.Context, dbtx DBTX, p *model.SearchAnalyticsParams) ([]*model.SearchTermStatDB, error) {
+	stmt := `
+	SELECT kind, term, searches, sessions, zero_results, last_results
+	FROM (
+		SELECT kind, term, SUM(searches) AS searches, SUM(sessions) AS sessions, SUM(zero_results) AS zero_results,
+			(ARRAY_AGG(last_results ORDER BY day DESC))[1] AS last_results
+		FROM search_stats_daily
+		WHERE day >= $1::date
+		GROUP BY kind, term
+	) AS stats
+	WHERE last_results = 0
+	ORDER BY zero_results DESC, term ASC
+	LIMIT $2
+	`
+
+	return querySearchTermStats(ctx, dbtx, stmt, p.Since, p.Limit)
+}
+
+func querySearchTermStats(ctx context.Context, dbtx DBTX, stmt string, args ...any) ([]*model.SearchTermStatDB, error) {
+	rows, err := dbtx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []*model.SearchTermStatDB{}
+	for rows.Next() {
+		var stat model.SearchTermStatDB
+
+		err := rows.Scan(&stat.Kind, &stat.Term, &stat.Searches, &stat.Sessions, &stat.ZeroResults, &stat.LastResults)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, &stat)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetSearchTrend returns the daily search totals since the given day, oldest first
+func GetSearchTrend(ctx context.Context, dbtx DBTX, p *model.SearchAnalyticsParams) ([]*model.SearchDayStatDB, error) {
+	stmt := `
+	SELECT day, SUM(searches), SUM(zero_results)
+	FROM search_stats_daily
+	WHERE day >= $1::date
+	GROUP BY day
+	ORDER BY day ASC
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, p.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []*model.SearchDayStatDB{}
+	for rows.Next() {
+		var stat model.SearchDayStatDB
+
+		err := rows.Scan(&stat.Day, &stat.Searches, &stat.ZeroResults)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, &stat)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// PruneSearchEvents deletes raw search events older than the cutoff; the daily
+// aggregates are kept
+func PruneSearchEvents(ctx context.Context, dbtx DBTX, before time.Time) (int64, error) {
+	stmt := `
+	DELETE FROM search_events
+	WHERE created_at < $1
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,132 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+func CreateAPIToken(ctx context.Context, dbtx DBTX, p *model.APITokenCreateParams) (*model.APITokenDB, error) {
+	stmt := `
+	INSERT INTO api_tokens (user_id, name, hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, expires_at, created_at
+	`
+
+	args := []any{p.UserID, p.Name, p.Hash, pq.Array(p.Scopes), p.ExpiresAt}
+
+	token := model.APITokenDB{
+		UserID: p.UserID,
+		Name:   p.Name,
+		Scopes: p.Scopes,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&token.ID, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// read
+
+func GetAPITokensForUser(ctx context.Context, dbtx DBTX, userID int64) ([]*model.APITokenDB, error) {
+	stmt := `
+	SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+	FROM api_tokens
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*model.APITokenDB{}
+	for rows.Next() {
+		var token model.APITokenDB
+
+		err := rows.Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenByHash only finds tokens that haven't expired
+func GetAPITokenByHash(ctx context.Context, dbtx DBTX, hash []byte) (*model.APITokenDB, error) {
+	stmt := `
+	SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+	FROM api_tokens
+	WHERE hash = $1 AND expires_at > NOW()
+	`
+
+	var token model.APITokenDB
+
+	err := dbtx.QueryRowContext(ctx, stmt, hash).Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("api_tokens", 0)
+		default:
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+// update
+
+// TouchAPIToken records a use of the token; at most once a minute to spare
+// writes on busy scripts
+func TouchAPIToken(ctx context.Context, dbtx DBTX, id int64) error {
+	stmt := `
+	UPDATE api_tokens
+	SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, id)
+	return err
+}
+
+// delete
+
+func DeleteAPIToken(ctx context.Context, dbtx DBTX, id int64, userID int64) error {
+	stmt := `
+	DELETE FROM api_tokens
+	WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errRecordNotFound("api_tokens", id)
+	}
+
+	return nil
+}
@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/lib/pq"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/query"
 )
 
 // crud
@@ -70,27 +70,16 @@ func GetBean(ctx context.Context, dbtx DBTX, id int64) (*model.BeanDB, error) {
 }
 
 func FindBeans(ctx context.Context, dbtx DBTX, p *model.BeanFilterParams) ([]*model.BeanDB, error) {
-	conditions := []string{}
-
-	// search term will match if all space-delimited words are in the concatenation of searchable columns
-	searchFields := []string{"name"}
-	termConditions := fmt.Sprintf(`(CONCAT(%s) ILIKE ALL($1) OR $1 = '{}')`, strings.Join(searchFields, ", ' ', "))
-	conditions = append(conditions, termConditions)
-
-	wrappedWords := []string{}
-	for _, w := range strings.Fields(p.SearchTerm) {
-		wrappedWords = append(wrappedWords, fmt.Sprintf("%%%s%%", w))
-	}
-	wordArray := pq.Array(wrappedWords)
+	wb := beanFilterWhere(p)
 
 	stmt := fmt.Sprintf(`
 		SELECT id, name, roast_level, roaster_id, created_at, version
 		FROM beans
 		WHERE %s
 		ORDER BY %s %s, id ASC
-	`, strings.Join(conditions, " AND "), p.SortField, p.SortDir)
+	`, wb.where(), p.SortField, p.SortDir)
 
-	args := []any{wordArray}
+	args := wb.args
 
 	rows, err := dbtx.QueryContext(ctx, stmt, args...)
 	if err != nil {
@@ -116,6 +105,69 @@ func FindBeans(ctx context.Context, dbtx DBTX, p *model.BeanFilterParams) ([]*mo
 	return beans, nil
 }
 
+// FindNewBeans returns the most recently added beans matching the feed params
+func FindNewBeans(ctx context.Context, dbtx DBTX, p *model.BeanFeedParams) ([]*model.BeanDB, error) {
+	wb := &whereBuilder{}
+	wb.addQuery(p.Query, beanTermCondition)
+	if p.RoasterID > 0 {
+		wb.add(fmt.Sprintf("beans.roaster_id = %s", wb.arg(p.RoasterID)))
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT id, name, roast_level, roaster_id, created_at, version
+		FROM beans
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT %s
+	`, wb.where(), wb.arg(p.Limit))
+
+	rows, err := dbtx.QueryContext(ctx, stmt, wb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beans := []*model.BeanDB{}
+	for rows.Next() {
+		var bean model.BeanDB
+
+		err := rows.Scan(&bean.ID, &bean.Name, &bean.RoastLevel, &bean.RoasterID, &bean.CreatedAt, &bean.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		beans = append(beans, &bean)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return beans, nil
+}
+
+// beanFilterWhere builds the conditions of a bean filter
+func beanFilterWhere(p *model.BeanFilterParams) *whereBuilder {
+	wb := &whereBuilder{}
+	wb.addQuery(p.Query, beanTermCondition)
+	if p.AfterID > 0 {
+		wb.add(fmt.Sprintf("beans.id > %s", wb.arg(p.AfterID)))
+	}
+	return wb
+}
+
+// beanTermCondition maps a search query term to a condition on the beans table
+func beanTermCondition(wb *whereBuilder, t query.Term) string {
+	switch t.Field {
+	case model.BeanQueryRoast:
+		return fmt.Sprintf("beans.roast_level::text = %s", wb.arg(strings.ToLower(t.Value)))
+	case model.BeanQueryRoaster:
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM roasters WHERE roasters.id = beans.roaster_id AND roasters.name ILIKE %s)", wb.arg(likeContains(t.Value)))
+	default:
+		// free text and name
+		return fmt.Sprintf("beans.name ILIKE %s", wb.arg(likeContains(t.Value)))
+	}
+}
+
 // update
 
 func UpdateBean(ctx context.Context, dbtx DBTX, p *model.BeanEditParams) (*model.BeanDB, error) {
@@ -124,6 +176,13 @@ func UpdateBean(ctx context.Context, dbtx DBTX, p *model.BeanEditParams) (*model
 		return nil, err
 	}
 
+	// check against the version the edit was based on; without one, the
+	// current version is used and the edit overwrites
+	version := p.Version
+	if version == 0 {
+		version = current.Version
+	}
+
 	stmt := `
 	UPDATE beans
 	SET name = $3, roast_level = $4, roaster_id = $5, version = version + 1
@@ -131,7 +190,7 @@ func UpdateBean(ctx context.Context, dbtx DBTX, p *model.BeanEditParams) (*model
 	RETURNING version
 	`
 
-	args := []any{current.ID, current.Version, p.Name, p.RoastLevel, p.RoasterID}
+	args := []any{current.ID, version, p.Name, p.RoastLevel, p.RoasterID}
 
 	bean := model.BeanDB{
 		ID:         current.ID,
@@ -0,0 +1,77 @@
+package dba
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// the export functions hand each row to fn as it is read from the result set,
+// so an export never holds more than one row in memory; the row is reused and
+// only valid during the call. An error from fn stops the export and is returned
+
+func ExportBeans(ctx context.Context, dbtx DBTX, p *model.BeanFilterParams, fn func(*model.BeanExportRow) error) error {
+	wb := beanFilterWhere(p)
+
+	stmt := fmt.Sprintf(`
+		SELECT beans.id, COALESCE(beans.external_ref, ''), beans.name, beans.roast_level, beans.roaster_id, roasters.name, beans.created_at
+		FROM beans
+		JOIN roasters ON roasters.id = beans.roaster_id
+		WHERE %s
+		ORDER BY beans.%s %s, beans.id ASC
+	`, wb.where(), p.SortField, p.SortDir)
+
+	rows, err := dbtx.QueryContext(ctx, stmt, wb.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var row model.BeanExportRow
+	for rows.Next() {
+		err := rows.Scan(&row.ID, &row.ExternalRef, &row.Name, &row.RoastLevel, &row.RoasterID, &row.Roaster, &row.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func ExportRoasters(ctx context.Context, dbtx DBTX, p *model.RoasterFilterParams, fn func(*model.RoasterExportRow) error) error {
+	where, args := roasterFilterWhere(p)
+
+	stmt := fmt.Sprintf(`
+		SELECT id, COALESCE(external_ref, ''), name, description, website, location, created_at
+		FROM roasters
+		WHERE %s
+		ORDER BY %s %s, id ASC
+	`, where, p.SortField, p.SortDir)
+
+	rows, err := dbtx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var row model.RoasterExportRow
+	for rows.Next() {
+		err := rows.Scan(&row.ID, &row.ExternalRef, &row.Name, &row.Description, &row.Website, &row.Location, &row.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
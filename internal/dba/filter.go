@@ -0,0 +1,54 @@
+package dba
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/query"
+)
+
+// collects sql conditions and their positional args for a WHERE clause
+type whereBuilder struct {
+	conditions []string
+	args       []any
+}
+
+// arg registers a value and returns its placeholder
+func (b *whereBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *whereBuilder) add(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// addQuery ANDs together the groups of a parsed search query; termCondition maps
+// a single term to its sql condition
+func (b *whereBuilder) addQuery(q query.Query, termCondition func(*whereBuilder, query.Term) string) {
+	for _, g := range q.Groups {
+		ors := []string{}
+		for _, t := range g {
+			c := termCondition(b, t)
+			if t.Negated {
+				c = fmt.Sprintf("NOT (%s)", c)
+			}
+			ors = append(ors, c)
+		}
+		b.add(fmt.Sprintf("(%s)", strings.Join(ors, " OR ")))
+	}
+}
+
+func (b *whereBuilder) where() string {
+	if len(b.conditions) == 0 {
+		return "true"
+	}
+	return strings.Join(b.conditions, " AND ")
+}
+
+// likeContains wraps a value for a substring match with LIKE/ILIKE, escaping wildcards
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func likeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
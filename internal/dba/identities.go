@@ -0,0 +1,102 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+// CreateUserIdentity links an identity provider's subject to the user
+func CreateUserIdentity(ctx context.Context, dbtx DBTX, p *model.UserIdentityParams) error {
+	stmt := `
+	INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+	VALUES ($1, $2, $3, $4, NOW())
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, p.UserID, p.Provider, p.Subject, p.Email)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_provider_subject_key"`:
+			return errs.Errorf(errs.ERRCONFLICT, "identity is already linked")
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// read
+
+// GetUserIDByIdentity finds the user linked to an identity provider's subject
+func GetUserIDByIdentity(ctx context.Context, dbtx DBTX, provider string, subject string) (int64, error) {
+	stmt := `
+	SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2
+	`
+
+	var id int64
+	err := dbtx.QueryRowContext(ctx, stmt, provider, subject).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, errs.Errorf(errs.ERRNOTFOUND, "identity %s of provider %s not found", subject, provider)
+		default:
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// GetUserIdentitiesForUser lists the identities linked to the user
+func GetUserIdentitiesForUser(ctx context.Context, dbtx DBTX, userID int64) ([]*model.UserIdentityDB, error) {
+	stmt := `
+	SELECT id, user_id, provider, subject, email, last_login_at, created_at
+	FROM user_identities
+	WHERE user_id = $1
+	ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uids := []*model.UserIdentityDB{}
+	for rows.Next() {
+		var uid model.UserIdentityDB
+
+		err := rows.Scan(&uid.ID, &uid.UserID, &uid.Provider, &uid.Subject, &uid.Email, &uid.LastLoginAt, &uid.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		uids = append(uids, &uid)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uids, nil
+}
+
+// update
+
+// TouchUserIdentity records a login with the identity and the email the
+// provider has for it now
+func TouchUserIdentity(ctx context.Context, dbtx DBTX, provider string, subject string, email string) error {
+	stmt := `
+	UPDATE user_identities
+	SET email = $3, last_login_at = NOW()
+	WHERE provider = $1 AND subject = $2
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, provider, subject, email)
+	return err
+}
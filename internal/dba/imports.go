@@ -0,0 +1,204 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// read
+
+// GetRoasterIDsByName maps lowercased roaster names to the ids of the roasters
+// with that name; names aren't unique, so a name can map to several ids
+func GetRoasterIDsByName(ctx context.Context, dbtx DBTX, names []string) (map[string][]int64, error) {
+	stmt := `
+	SELECT id, lower(name)
+	FROM roasters
+	WHERE lower(name) = ANY($1)
+	ORDER BY id ASC
+	`
+
+	lower := []string{}
+	for _, n := range names {
+		lower = append(lower, strings.ToLower(n))
+	}
+
+	rows, err := dbtx.QueryContext(ctx, stmt, pq.Array(lower))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string][]int64{}
+	for rows.Next() {
+		var id int64
+		var name string
+
+		err := rows.Scan(&id, &name)
+		if err != nil {
+			return nil, err
+		}
+
+		ids[name] = append(ids[name], id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetExistingRoasterIDs returns which of the ids belong to a roaster
+func GetExistingRoasterIDs(ctx context.Context, dbtx DBTX, ids []int64) (map[int64]bool, error) {
+	stmt := `
+	SELECT id
+	FROM roasters
+	WHERE id = ANY($1)
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		existing[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// GetExistingExternalRefs returns which of the external refs are already used in
+// the table, i.e. which rows an import will update
+func GetExistingExternalRefs(ctx context.Context, dbtx DBTX, table string, refs []string) (map[string]bool, error) {
+	if table != "beans" && table != "roasters" {
+		panic(fmt.Sprintf("external refs aren't supported on table %s", table))
+	}
+
+	stmt := fmt.Sprintf(`
+	SELECT external_ref
+	FROM %s
+	WHERE external_ref = ANY($1)
+	`, table)
+
+	rows, err := dbtx.QueryContext(ctx, stmt, pq.Array(refs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var ref string
+
+		err := rows.Scan(&ref)
+		if err != nil {
+			return nil, err
+		}
+
+		existing[ref] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// upsert
+
+// UpsertBean creates the bean or updates the one imported before with the same
+// external ref. Returns the import action taken; an unchanged bean is left alone,
+// keeping its version, and nil is returned for it
+func UpsertBean(ctx context.Context, dbtx DBTX, p *model.BeanImportParams) (*model.BeanDB, string, error) {
+	stmt := `
+	INSERT INTO beans (name, roast_level, roaster_id, external_ref)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (external_ref) DO UPDATE
+	SET name = EXCLUDED.name, roast_level = EXCLUDED.roast_level, roaster_id = EXCLUDED.roaster_id, version = beans.version + 1
+	WHERE (beans.name, beans.roast_level, beans.roaster_id) IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.roast_level, EXCLUDED.roaster_id)
+	RETURNING id, created_at, version, xmax = 0
+	`
+
+	args := []any{p.Name, p.RoastLevel, p.RoasterID, p.ExternalRef}
+
+	bean := model.BeanDB{
+		Name:       p.Name,
+		RoastLevel: p.RoastLevel,
+		RoasterID:  p.RoasterID,
+	}
+
+	var created bool
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&bean.ID, &bean.CreatedAt, &bean.Version, &created)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, model.ImportActionUnchanged, nil
+		case err.Error() == `pq: insert or update on table "beans" violates foreign key constraint "beans_roaster_id_fkey"`:
+			return nil, "", errInvalidFK("beans", "roaster_id", p.RoasterID)
+		default:
+			return nil, "", err
+		}
+	}
+
+	if created {
+		return &bean, model.ImportActionCreate, nil
+	}
+	return &bean, model.ImportActionUpdate, nil
+}
+
+// UpsertRoaster creates the roaster or updates the one imported before with the
+// same external ref. Returns the import action taken; an unchanged roaster is
+// left alone, keeping its version, and nil is returned for it
+func UpsertRoaster(ctx context.Context, dbtx DBTX, p *model.RoasterImportParams) (*model.RoasterDB, string, error) {
+	stmt := `
+	INSERT INTO roasters (name, description, website, location, external_ref)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (external_ref) DO UPDATE
+	SET name = EXCLUDED.name, description = EXCLUDED.description, website = EXCLUDED.website, location = EXCLUDED.location, version = roasters.version + 1
+	WHERE (roasters.name, roasters.description, roasters.website, roasters.location) IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.description, EXCLUDED.website, EXCLUDED.location)
+	RETURNING id, created_at, version, xmax = 0
+	`
+
+	args := []any{p.Name, p.Description, p.Website, p.Location, p.ExternalRef}
+
+	roaster := model.RoasterDB{
+		Name:        p.Name,
+		Description: p.Description,
+		Website:     p.Website,
+		Location:    p.Location,
+	}
+
+	var created bool
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&roaster.ID, &roaster.CreatedAt, &roaster.Version, &created)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, model.ImportActionUnchanged, nil
+		default:
+			return nil, "", err
+		}
+	}
+
+	if created {
+		return &roaster, model.ImportActionCreate, nil
+	}
+	return &roaster, model.ImportActionUpdate, nil
+}
@@ -0,0 +1,88 @@
+package dba
+
+import (
+	"context"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+func CreateNotification(ctx context.Context, dbtx DBTX, p *model.NotificationCreateParams) (*model.NotificationDB, error) {
+	stmt := `
+	INSERT INTO notifications (user_id, message, link)
+	VALUES ($1, $2, $3)
+	RETURNING id, read, created_at
+	`
+
+	args := []any{p.UserID, p.Message, p.Link}
+
+	notification := model.NotificationDB{
+		UserID:  p.UserID,
+		Message: p.Message,
+		Link:    p.Link,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&notification.ID, &notification.Read, &notification.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+// GetNotificationsForUser returns the latest notifications first; a limit of 0 returns all
+func GetNotificationsForUser(ctx context.Context, dbtx DBTX, userID int64, limit int) ([]*model.NotificationDB, error) {
+	stmt := `
+	SELECT id, user_id, message, link, read, created_at
+	FROM notifications
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	LIMIT NULLIF($2, 0)
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*model.NotificationDB{}
+	for rows.Next() {
+		var notification model.NotificationDB
+
+		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Message, &notification.Link, &notification.Read, &notification.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, &notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func MarkNotificationRead(ctx context.Context, dbtx DBTX, id int64, userID int64) error {
+	stmt := `
+	UPDATE notifications
+	SET read = true
+	WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errRecordNotFound("notifications", id)
+	}
+
+	return nil
+}
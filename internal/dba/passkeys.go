@@ -0,0 +1,168 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+func CreatePasskey(ctx context.Context, dbtx DBTX, p *model.PasskeyCreateParams) (*model.PasskeyDB, error) {
+	stmt := `
+	INSERT INTO passkeys (user_id, name, credential_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id, created_at
+	`
+
+	args := []any{p.UserID, p.Name, p.CredentialID, p.PublicKey, p.AttestationType, pq.Array(p.Transports), p.AAGUID, int64(p.SignCount), p.BackupEligible, p.BackupState}
+
+	pk := model.PasskeyDB{
+		UserID:          p.UserID,
+		Name:            p.Name,
+		CredentialID:    p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transports:      p.Transports,
+		AAGUID:          p.AAGUID,
+		SignCount:       p.SignCount,
+		BackupEligible:  p.BackupEligible,
+		BackupState:     p.BackupState,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&pk.ID, &pk.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "passkeys_credential_id_key"`:
+			return nil, errs.Errorf(errs.ERRCONFLICT, "passkey is already registered")
+		default:
+			return nil, err
+		}
+	}
+
+	return &pk, nil
+}
+
+// read
+
+func GetPasskeysForUser(ctx context.Context, dbtx DBTX, userID int64) ([]*model.PasskeyDB, error) {
+	stmt := `
+	SELECT id, user_id, name, credential_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, last_used_at, created_at
+	FROM passkeys
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pks := []*model.PasskeyDB{}
+	for rows.Next() {
+		var pk model.PasskeyDB
+		var signCount int64
+
+		err := rows.Scan(&pk.ID, &pk.UserID, &pk.Name, &pk.CredentialID, &pk.PublicKey, &pk.AttestationType, pq.Array(&pk.Transports), &pk.AAGUID, &signCount, &pk.BackupEligible, &pk.BackupState, &pk.LastUsedAt, &pk.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		pk.SignCount = uint32(signCount)
+
+		pks = append(pks, &pk)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pks, nil
+}
+
+// GetUserIDByWebAuthnHandle finds the user an authenticator knows by handle
+func GetUserIDByWebAuthnHandle(ctx context.Context, dbtx DBTX, handle []byte) (int64, error) {
+	stmt := `
+	SELECT id FROM users WHERE webauthn_handle = $1
+	`
+
+	var id int64
+	err := dbtx.QueryRowContext(ctx, stmt, handle).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, errRecordNotFound("users", 0)
+		default:
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// update
+
+// EnsureUserWebAuthnHandle gives the user the candidate handle unless they
+// already have one, and returns the handle they end up with
+func EnsureUserWebAuthnHandle(ctx context.Context, dbtx DBTX, userID int64, candidate []byte) ([]byte, error) {
+	stmt := `
+	UPDATE users
+	SET webauthn_handle = COALESCE(webauthn_handle, $2)
+	WHERE id = $1
+	RETURNING webauthn_handle
+	`
+
+	var handle []byte
+	err := dbtx.QueryRowContext(ctx, stmt, userID, candidate).Scan(&handle)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("users", userID)
+		default:
+			return nil, err
+		}
+	}
+
+	return handle, nil
+}
+
+// UpdatePasskeyUse records a login with the passkey and its new signature
+// counter
+func UpdatePasskeyUse(ctx context.Context, dbtx DBTX, id int64, signCount uint32, backupState bool) error {
+	stmt := `
+	UPDATE passkeys
+	SET sign_count = $2, backup_state = $3, last_used_at = NOW()
+	WHERE id = $1
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, id, int64(signCount), backupState)
+	return err
+}
+
+// delete
+
+func DeletePasskey(ctx context.Context, dbtx DBTX, id int64, userID int64) error {
+	stmt := `
+	DELETE FROM passkeys
+	WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errRecordNotFound("passkeys", id)
+	}
+
+	return nil
+}
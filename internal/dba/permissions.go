@@ -3,32 +3,45 @@ package dba
 import (
 	"context"
 
-	"github.com/lib/pq"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
 )
 
-// TODO: maybe write a setRolePermisisonsForUser() to set based on roles; define roles in model package
+// roles and permissions are the casbin policy in the casbin_rule table: 'p'
+// rules grant a subject an obj:act permission, 'g' rules give a user a role.
+// They are changed through the enforcer, which keeps its loaded copy in step,
+// except for the role of a new account, which is added with it
 
-func AddPermissionsForUser(ctx context.Context, dbtx DBTX, id int64, codes model.PermissionCodes) error {
+// create
+
+// AddRoleForUser gives the user a role, like the enforcer would. An enforcer
+// that already loaded the policy doesn't see it until it loads it again
+func AddRoleForUser(ctx context.Context, dbtx DBTX, id int64, role string) error {
 	stmt := `
-	INSERT INTO users_permissions
-	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	INSERT INTO casbin_rule (p_type, v0, v1)
+	SELECT 'g', $1, $2
+	WHERE NOT EXISTS (SELECT 1 FROM casbin_rule WHERE p_type = 'g' AND v0 = $1 AND v1 = $2)
 	`
 
-	_, err := dbtx.ExecContext(ctx, stmt, id, pq.Array(codes))
+	_, err := dbtx.ExecContext(ctx, stmt, model.RBACSubject(id), role)
 	return err
 }
 
+// read
+
+// GetPermissionsForUser lists the permissions granted to the user directly or
+// through their roles
 func GetPermissionsForUser(ctx context.Context, dbtx DBTX, id int64) (model.PermissionCodes, error) {
 	stmt := `
-	SELECT permissions.code
-	FROM permissions
-	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-	INNER JOIN users ON users_permissions.user_id = users.id
-	WHERE users.id = $1
+	SELECT DISTINCT p.v1 || ':' || p.v2
+	FROM casbin_rule p
+	WHERE p.p_type = 'p' AND (
+		p.v0 = $1
+		OR p.v0 IN (SELECT g.v1 FROM casbin_rule g WHERE g.p_type = 'g' AND g.v0 = $1)
+	)
+	ORDER BY 1
 	`
 
-	rows, err := dbtx.QueryContext(ctx, stmt, id)
+	rows, err := dbtx.QueryContext(ctx, stmt, model.RBACSubject(id))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,161 @@
+package dba
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// read
+
+func GetSimilarBeans(ctx context.Context, dbtx DBTX, beanID int64, limit int) ([]*model.BeanSimilarityDB, error) {
+	stmt := `
+	SELECT beans.id, beans.name, beans.roast_level, beans.roaster_id, beans.created_at, beans.version, bean_similarities.score
+	FROM bean_similarities
+	INNER JOIN beans ON beans.id = bean_similarities.similar_bean_id
+	WHERE bean_similarities.bean_id = $1
+	ORDER BY bean_similarities.score DESC, beans.id ASC
+	LIMIT $2
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, beanID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sims := []*model.BeanSimilarityDB{}
+	for rows.Next() {
+		var bean model.BeanDB
+		var sim model.BeanSimilarityDB
+
+		err := rows.Scan(&bean.ID, &bean.Name, &bean.RoastLevel, &bean.RoasterID, &bean.CreatedAt, &bean.Version, &sim.Score)
+		if err != nil {
+			return nil, err
+		}
+
+		sim.Bean = &bean
+		sims = append(sims, &sim)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sims, nil
+}
+
+// FindSimilarityCandidates finds the beans that may score high enough against
+// the bean to be recommended with it: those of the same roaster, those within
+// nearRoast roast levels, and those within farRoast levels whose name contains
+// one of the words
+func FindSimilarityCandidates(ctx context.Context, dbtx DBTX, bean *model.BeanDB, nearRoast int, farRoast int, words []string) ([]*model.BeanDB, error) {
+	distance := `ABS(array_position(enum_range(NULL::roast_level_enum), roast_level) - array_position(enum_range(NULL::roast_level_enum), $3::roast_level_enum))`
+
+	stmt := fmt.Sprintf(`
+	SELECT id, name, roast_level, roaster_id, created_at, version
+	FROM beans
+	WHERE id <> $1 AND (
+		roaster_id = $2
+		OR %[1]s <= $4
+		OR (%[1]s <= $5 AND name ILIKE ANY($6))
+	)
+	`, distance)
+
+	patterns := []string{}
+	for _, w := range words {
+		patterns = append(patterns, likeContains(w))
+	}
+
+	rows, err := dbtx.QueryContext(ctx, stmt, bean.ID, bean.RoasterID, bean.RoastLevel, nearRoast, farRoast, pq.Array(patterns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beans := []*model.BeanDB{}
+	for rows.Next() {
+		var b model.BeanDB
+		err := rows.Scan(&b.ID, &b.Name, &b.RoastLevel, &b.RoasterID, &b.CreatedAt, &b.Version)
+		if err != nil {
+			return nil, err
+		}
+		beans = append(beans, &b)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return beans, nil
+}
+
+// write
+
+// InsertBeanSimilarities bulk inserts scores, overwriting existing pairs
+func InsertBeanSimilarities(ctx context.Context, dbtx DBTX, ps []*model.BeanSimilarityParams) error {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	stmt := `
+	INSERT INTO bean_similarities (bean_id, similar_bean_id, score)
+	SELECT * FROM UNNEST($1::bigint[], $2::bigint[], $3::real[])
+	ON CONFLICT (bean_id, similar_bean_id) DO UPDATE
+	SET score = EXCLUDED.score, computed_at = NOW()
+	`
+
+	beanIDs := make([]int64, len(ps))
+	similarIDs := make([]int64, len(ps))
+	scores := make([]float64, len(ps))
+	for i, p := range ps {
+		beanIDs[i] = p.BeanID
+		similarIDs[i] = p.SimilarBeanID
+		scores[i] = p.Score
+	}
+
+	args := []any{pq.Array(beanIDs), pq.Array(similarIDs), pq.Array(scores)}
+
+	_, err := dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// DeleteBeanSimilarities removes every score involving the bean, in either direction
+func DeleteBeanSimilarities(ctx context.Context, dbtx DBTX, beanID int64) error {
+	stmt := `
+	DELETE FROM bean_similarities
+	WHERE bean_id = $1 OR similar_bean_id = $1
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, beanID)
+	return err
+}
+
+func DeleteAllBeanSimilarities(ctx context.Context, dbtx DBTX) error {
+	stmt := `
+	DELETE FROM bean_similarities
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt)
+	return err
+}
+
+// TrimBeanSimilarities keeps only the best scores of the given beans
+func TrimBeanSimilarities(ctx context.Context, dbtx DBTX, beanIDs []int64, keep int) error {
+	stmt := `
+	DELETE FROM bean_similarities
+	WHERE (bean_id, similar_bean_id) IN (
+		SELECT bean_id, similar_bean_id
+		FROM (
+			SELECT bean_id, similar_bean_id,
+				ROW_NUMBER() OVER (PARTITION BY bean_id ORDER BY score DESC, similar_bean_id ASC) AS rank
+			FROM bean_similarities
+			WHERE bean_id = ANY($1)
+		) AS ranked
+		WHERE rank > $2
+	)
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, pq.Array(beanIDs), keep)
+	return err
+}
@@ -66,6 +66,41 @@ func GetRoaster(ctx context.Context, dbtx DBTX, id int64) (*model.RoasterDB, err
 }
 
 func FindRoasters(ctx context.Context, dbtx DBTX, p *model.RoasterFilterParams) ([]*model.RoasterDB, error) {
+	where, args := roasterFilterWhere(p)
+
+	stmt := fmt.Sprintf(`
+		SELECT id, name, description, website, location, created_at, version
+		FROM roasters
+		WHERE %s
+		ORDER BY %s %s, id ASC
+	`, where, p.SortField, p.SortDir)
+
+	rows, err := dbtx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roasters := []*model.RoasterDB{}
+	for rows.Next() {
+		var roaster model.RoasterDB
+
+		err := rows.Scan(&roaster.ID, &roaster.Name, &roaster.Description, &roaster.Website, &roaster.Location, &roaster.CreatedAt, &roaster.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		roasters = append(roasters, &roaster)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roasters, nil
+}
+
+// roasterFilterWhere builds the conditions of a roaster filter and their args
+func roasterFilterWhere(p *model.RoasterFilterParams) (string, []any) {
 	conditions := []string{}
 
 	// search term will match if all space-delimited words are in the concatenation of searchable columns
@@ -79,14 +114,20 @@ func FindRoasters(ctx context.Context, dbtx DBTX, p *model.RoasterFilterParams)
 	}
 	wordArray := pq.Array(wrappedWords)
 
-	stmt := fmt.Sprintf(`
-		SELECT id, name, description, website, location, created_at, version
-		FROM roasters
-		WHERE %s
-		ORDER BY %s %s, id ASC
-	`, strings.Join(conditions, " AND "), p.SortField, p.SortDir)
+	return strings.Join(conditions, " AND "), []any{wordArray}
+}
 
-	args := []any{wordArray}
+// SuggestRoasters returns roasters whose name contains the term, prefix matches first
+func SuggestRoasters(ctx context.Context, dbtx DBTX, p *model.RoasterSuggestParams) ([]*model.RoasterDB, error) {
+	stmt := `
+	SELECT id, name, description, website, location, created_at, version
+	FROM roasters
+	WHERE name ILIKE $1
+	ORDER BY name ILIKE $2 DESC, name ASC, id ASC
+	LIMIT $3
+	`
+
+	args := []any{likeContains(p.Term), likeEscaper.Replace(p.Term) + "%", p.Limit}
 
 	rows, err := dbtx.QueryContext(ctx, stmt, args...)
 	if err != nil {
@@ -120,6 +161,13 @@ func UpdateRoaster(ctx context.Context, dbtx DBTX, p *model.RoasterEditParams) (
 		return nil, err
 	}
 
+	// check against the version the edit was based on; without one, the
+	// current version is used and the edit overwrites
+	version := p.Version
+	if version == 0 {
+		version = current.Version
+	}
+
 	stmt := `
 	UPDATE roasters
 	SET name = $3, description = $4, website = $5, location = $6, version = version + 1
@@ -127,7 +175,7 @@ func UpdateRoaster(ctx context.Context, dbtx DBTX, p *model.RoasterEditParams) (
 	RETURNING version
 	`
 
-	args := []any{current.ID, current.Version, p.Name, p.Description, p.Website, p.Location}
+	args := []any{current.ID, version, p.Name, p.Description, p.Website, p.Location}
 
 	roaster := model.RoasterDB{
 		ID:          current.ID,
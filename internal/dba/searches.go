@@ -0,0 +1,149 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+// CreateSavedSearch starts the search at the newest existing bean, so only beans
+// added afterwards are reported as new matches
+func CreateSavedSearch(ctx context.Context, dbtx DBTX, p *model.SavedSearchCreateParams) (*model.SavedSearchDB, error) {
+	stmt := `
+	INSERT INTO saved_searches (user_id, name, query, last_bean_id)
+	VALUES ($1, $2, $3, (SELECT COALESCE(MAX(id), 0) FROM beans))
+	RETURNING id, last_bean_id, last_run_at, created_at, version
+	`
+
+	args := []any{p.UserID, p.Name, p.Query}
+
+	search := model.SavedSearchDB{
+		UserID: p.UserID,
+		Name:   p.Name,
+		Query:  p.Query,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&search.ID, &search.LastBeanID, &search.LastRunAt, &search.CreatedAt, &search.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &search, nil
+}
+
+// read
+
+func GetSavedSearchesForUser(ctx context.Context, dbtx DBTX, userID int64) ([]*model.SavedSearchDB, error) {
+	stmt := `
+	SELECT id, user_id, name, query, last_bean_id, last_run_at, created_at, version
+	FROM saved_searches
+	WHERE user_id = $1
+	ORDER BY name ASC, id ASC
+	`
+
+	return querySavedSearches(ctx, dbtx, stmt, userID)
+}
+
+// GetAllSavedSearches is used by the background job that re-runs every search
+func GetAllSavedSearches(ctx context.Context, dbtx DBTX) ([]*model.SavedSearchDB, error) {
+	stmt := `
+	SELECT id, user_id, name, query, last_bean_id, last_run_at, created_at, version
+	FROM saved_searches
+	ORDER BY id ASC
+	`
+
+	return querySavedSearches(ctx, dbtx, stmt)
+}
+
+func querySavedSearches(ctx context.Context, dbtx DBTX, stmt string, args ...any) ([]*model.SavedSearchDB, error) {
+	rows, err := dbtx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []*model.SavedSearchDB{}
+	for rows.Next() {
+		var search model.SavedSearchDB
+
+		err := rows.Scan(&search.ID, &search.UserID, &search.Name, &search.Query, &search.LastBeanID, &search.LastRunAt, &search.CreatedAt, &search.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		searches = append(searches, &search)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return searches, nil
+}
+
+// update
+
+func UpdateSavedSearch(ctx context.Context, dbtx DBTX, p *model.SavedSearchEditParams) (*model.SavedSearchDB, error) {
+	stmt := `
+	UPDATE saved_searches
+	SET name = $3, query = $4, version = version + 1
+	WHERE id = $1 AND user_id = $2
+	RETURNING id, user_id, name, query, last_bean_id, last_run_at, created_at, version
+	`
+
+	args := []any{p.ID, p.UserID, p.Name, p.Query}
+
+	var search model.SavedSearchDB
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&search.ID, &search.UserID, &search.Name, &search.Query, &search.LastBeanID, &search.LastRunAt, &search.CreatedAt, &search.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("saved_searches", p.ID)
+		default:
+			return nil, err
+		}
+	}
+
+	return &search, nil
+}
+
+// SetSavedSearchRun records a run of the search and the newest bean it has reported
+func SetSavedSearchRun(ctx context.Context, dbtx DBTX, id int64, lastBeanID int64) error {
+	stmt := `
+	UPDATE saved_searches
+	SET last_bean_id = GREATEST(last_bean_id, $2), last_run_at = NOW()
+	WHERE id = $1
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, id, lastBeanID)
+	return err
+}
+
+// delete
+
+func DeleteSavedSearch(ctx context.Context, dbtx DBTX, id int64, userID int64) error {
+	stmt := `
+	DELETE FROM saved_searches
+	WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errRecordNotFound("saved_searches", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+func CreateUserSession(ctx context.Context, dbtx DBTX, p *model.UserSessionParams) (*model.UserSessionDB, error) {
+	stmt := `
+	INSERT INTO user_sessions (user_id, key, token, ip, user_agent)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, last_seen_at, created_at
+	`
+
+	s := model.UserSessionDB{
+		UserID:    p.UserID,
+		Key:       p.Key,
+		Token:     p.Token,
+		IP:        p.IP,
+		UserAgent: p.UserAgent,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, p.UserID, p.Key, p.Token, p.IP, p.UserAgent).Scan(&s.ID, &s.LastSeenAt, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// read
+
+// GetUserSession finds the record of the user's session by key
+func GetUserSession(ctx context.Context, dbtx DBTX, key string, userID int64) (*model.UserSessionDB, error) {
+	stmt := `
+	SELECT id, user_id, key, token, ip, user_agent, last_seen_at, created_at
+	FROM user_sessions
+	WHERE key = $1 AND user_id = $2
+	`
+
+	var s model.UserSessionDB
+	err := dbtx.QueryRowContext(ctx, stmt, key, userID).Scan(&s.ID, &s.UserID, &s.Key, &s.Token, &s.IP, &s.UserAgent, &s.LastSeenAt, &s.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("user_sessions", userID)
+		default:
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+func GetUserSessionsForUser(ctx context.Context, dbtx DBTX, userID int64) ([]*model.UserSessionDB, error) {
+	stmt := `
+	SELECT id, user_id, '', key, ip, user_agent, last_seen_at, created_at
+	FROM user_sessions
+	WHERE user_id = $1
+	ORDER BY last_seen_at DESC, id DESC
+	`
+
+	return queryUserSessions(ctx, dbtx, stmt, userID)
+}
+
+// GetRecentUserSessions lists the sessions of all users that were seen last
+func GetRecentUserSessions(ctx context.Context, dbtx DBTX, limit int) ([]*model.UserSessionDB, error) {
+	stmt := `
+	SELECT user_sessions.id, user_id, users.email, key, ip, user_agent, last_seen_at, user_sessions.created_at
+	FROM user_sessions
+	INNER JOIN users ON users.id = user_sessions.user_id
+	ORDER BY last_seen_at DESC, user_sessions.id DESC
+	LIMIT $1
+	`
+
+	return queryUserSessions(ctx, dbtx, stmt, limit)
+}
+
+func queryUserSessions(ctx context.Context, dbtx DBTX, stmt string, args ...any) ([]*model.UserSessionDB, error) {
+	rows, err := dbtx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ss := []*model.UserSessionDB{}
+	for rows.Next() {
+		var s model.UserSessionDB
+		err := rows.Scan(&s.ID, &s.UserID, &s.UserEmail, &s.Key, &s.IP, &s.UserAgent, &s.LastSeenAt, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// update
+
+// TouchUserSession records that the session was just used, from where and
+// under which session store token
+func TouchUserSession(ctx context.Context, dbtx DBTX, id int64, p *model.UserSessionParams) error {
+	stmt := `
+	UPDATE user_sessions
+	SET last_seen_at = NOW(), token = $2, ip = $3, user_agent = $4
+	WHERE id = $1
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, id, p.Token, p.IP, p.UserAgent)
+	return err
+}
+
+// delete
+
+// DeleteUserSession deletes the record of one of the user's sessions and
+// returns it
+func DeleteUserSession(ctx context.Context, dbtx DBTX, id int64, userID int64) (*model.UserSessionDB, error) {
+	stmt := `
+	DELETE FROM user_sessions
+	WHERE id = $1 AND user_id = $2
+	RETURNING key, token
+	`
+
+	s := model.UserSessionDB{
+		ID:     id,
+		UserID: userID,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, id, userID).Scan(&s.Key, &s.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("user_sessions", id)
+		default:
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+func DeleteUserSessionsByKey(ctx context.Context, dbtx DBTX, keys []string) error {
+	stmt := `
+	DELETE FROM user_sessions
+	WHERE key = ANY($1)
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, pq.Array(keys))
+	return err
+}
+
+// DeleteUserSessionsForUser deletes the records of all the user's sessions
+// except the one with keepKey, and returns their session store tokens
+func DeleteUserSessionsForUser(ctx context.Context, dbtx DBTX, userID int64, keepKey string) ([]string, error) {
+	stmt := `
+	DELETE FROM user_sessions
+	WHERE user_id = $1 AND key <> $2
+	RETURNING token
+	`
+
+	return queryUserSessionTokens(ctx, dbtx, stmt, userID, keepKey)
+}
+
+// DeleteUserSessionsForScheduledUsers deletes the records of the sessions of
+// users whose scheduled deletion is due, and returns their session store tokens
+func DeleteUserSessionsForScheduledUsers(ctx context.Context, dbtx DBTX) ([]string, error) {
+	stmt := `
+	DELETE FROM user_sessions
+	USING users
+	WHERE users.id = user_sessions.user_id AND users.deletion_scheduled_at <= NOW()
+	RETURNING user_sessions.token
+	`
+
+	return queryUserSessionTokens(ctx, dbtx, stmt)
+}
+
+// queryUserSessionTokens collects the tokens returned by stmt
+func queryUserSessionTokens(ctx context.Context, dbtx DBTX, stmt string, args ...any) ([]string, error) {
+	rows, err := dbtx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []string{}
+	for rows.Next() {
+		var token string
+		err := rows.Scan(&token)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteExpiredUserSessions deletes records of sessions started longer ago
+// than sessions live
+func DeleteExpiredUserSessions(ctx context.Context, dbtx DBTX, lifetime time.Duration) (int64, error) {
+	stmt := `
+	DELETE FROM user_sessions
+	WHERE created_at < NOW() - make_interval(secs => $1)
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, lifetime.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
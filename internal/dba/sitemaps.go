@@ -0,0 +1,65 @@
+package dba
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// tables behind each sitemap kind; kinds are validated before they get here
+var sitemapTables = map[string]string{
+	model.SitemapBeans:    "beans",
+	model.SitemapRoasters: "roasters",
+}
+
+// CountSitemapEntries returns the number of rows per sitemap kind
+func CountSitemapEntries(ctx context.Context, dbtx DBTX) (map[string]int, error) {
+	stmt := `
+		SELECT (SELECT count(*) FROM beans), (SELECT count(*) FROM roasters)
+	`
+
+	var beans, roasters int
+	err := dbtx.QueryRowContext(ctx, stmt).Scan(&beans, &roasters)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]int{
+		model.SitemapBeans:    beans,
+		model.SitemapRoasters: roasters,
+	}, nil
+}
+
+// FindSitemapIDs returns one page of ids, in id order so pages stay stable as rows are added
+func FindSitemapIDs(ctx context.Context, dbtx DBTX, p *model.SitemapPageParams) ([]int64, error) {
+	table, ok := sitemapTables[p.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown sitemap kind %q", p.Kind)
+	}
+
+	stmt := fmt.Sprintf(`
+		SELECT id
+		FROM %s
+		ORDER BY id ASC
+		LIMIT $1 OFFSET $2
+	`, table)
+
+	rows, err := dbtx.QueryContext(ctx, stmt, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
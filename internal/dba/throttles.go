@@ -0,0 +1,132 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// read
+
+// GetLoginThrottle reads the failed logins counted against the key; a key
+// without failures reads as an empty throttle
+func GetLoginThrottle(ctx context.Context, dbtx DBTX, scope string, key string) (*model.LoginThrottleDB, error) {
+	stmt := `
+	SELECT scope, key, failures, last_failure_at, locked_until
+	FROM login_throttles
+	WHERE scope = $1 AND key = $2
+	`
+
+	var t model.LoginThrottleDB
+	err := dbtx.QueryRowContext(ctx, stmt, scope, key).Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return &model.LoginThrottleDB{Scope: scope, Key: key}, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+func GetLockedLoginThrottles(ctx context.Context, dbtx DBTX) ([]*model.LoginThrottleDB, error) {
+	stmt := `
+	SELECT scope, key, failures, last_failure_at, locked_until
+	FROM login_throttles
+	WHERE locked_until > NOW()
+	ORDER BY locked_until DESC
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ts := []*model.LoginThrottleDB{}
+	for rows.Next() {
+		var t model.LoginThrottleDB
+		err := rows.Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// update
+
+// RecordLoginFailure counts a failed login against the key. Failures after a
+// quiet window, or after a lockout ran out, start counting from one again
+func RecordLoginFailure(ctx context.Context, dbtx DBTX, scope string, key string, window time.Duration) (*model.LoginThrottleDB, error) {
+	stmt := `
+	INSERT INTO login_throttles (scope, key, failures, last_failure_at)
+	VALUES ($1, $2, 1, NOW())
+	ON CONFLICT (scope, key) DO UPDATE
+	SET failures = CASE
+			WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => $3) OR login_throttles.locked_until <= NOW() THEN 1
+			ELSE login_throttles.failures + 1
+		END,
+		last_failure_at = NOW(),
+		locked_until = CASE WHEN login_throttles.locked_until > NOW() THEN login_throttles.locked_until END
+	RETURNING scope, key, failures, last_failure_at, locked_until
+	`
+
+	var t model.LoginThrottleDB
+	err := dbtx.QueryRowContext(ctx, stmt, scope, key, window.Seconds()).Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// LockLoginThrottle stops logins for the key until the given time
+func LockLoginThrottle(ctx context.Context, dbtx DBTX, scope string, key string, until time.Time) error {
+	stmt := `
+	UPDATE login_throttles
+	SET locked_until = $3
+	WHERE scope = $1 AND key = $2
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, scope, key, until)
+	return err
+}
+
+// delete
+
+// DeleteLoginThrottle forgets the failed logins counted against the key,
+// lifting any lockout
+func DeleteLoginThrottle(ctx context.Context, dbtx DBTX, scope string, key string) error {
+	stmt := `
+	DELETE FROM login_throttles
+	WHERE scope = $1 AND key = $2
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, scope, key)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errs.Errorf(errs.ERRNOTFOUND, "no failed logins for %s %s", scope, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for a new set
+func ReplaceRecoveryCodes(ctx context.Context, dbtx DBTX, userID int64, hashes [][]byte) error {
+	err := DeleteRecoveryCodes(ctx, dbtx, userID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+	INSERT INTO user_recovery_codes (hash, user_id)
+	SELECT unnest($2::bytea[]), $1
+	`
+
+	args := []any{userID, pq.Array(hashes)}
+
+	_, err = dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// read
+
+// GetUserTOTP reads the confirmed totp secret of the user
+func GetUserTOTP(ctx context.Context, dbtx DBTX, userID int64) (*model.UserTOTPDB, error) {
+	stmt := `
+	SELECT id, totp_secret, totp_last_step
+	FROM users
+	WHERE id = $1 AND totp_secret IS NOT NULL
+	`
+
+	args := []any{userID}
+
+	var t model.UserTOTPDB
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&t.UserID, &t.Secret, &t.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errs.Errorf(errs.ERRNOTFOUND, "two-factor authentication is not enabled for user %d", userID)
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+func CountRecoveryCodes(ctx context.Context, dbtx DBTX, userID int64) (int, error) {
+	stmt := `
+	SELECT count(*) FROM user_recovery_codes WHERE user_id = $1
+	`
+
+	args := []any{userID}
+
+	var n int
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&n)
+	return n, err
+}
+
+// update
+
+// SetUserTOTP sets the user's totp secret and the last time step used with
+// it; an empty secret turns totp off
+func SetUserTOTP(ctx context.Context, dbtx DBTX, userID int64, secret string, lastStep int64) error {
+	stmt := `
+	UPDATE users
+	SET totp_secret = NULLIF($2, ''), totp_last_step = $3, version = version + 1
+	WHERE id = $1
+	`
+
+	args := []any{userID, secret, lastStep}
+
+	result, err := dbtx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errRecordNotFound("users", userID)
+	}
+
+	return nil
+}
+
+// UseUserTOTPStep records a time step as used. It fails with ERRCONFLICT if
+// the step, or a later one, was used already; checking and recording in one
+// statement keeps two requests from both using the same code
+func UseUserTOTPStep(ctx context.Context, dbtx DBTX, userID int64, step int64) error {
+	stmt := `
+	UPDATE users
+	SET totp_last_step = $2
+	WHERE id = $1 AND totp_secret IS NOT NULL AND totp_last_step < $2
+	`
+
+	args := []any{userID, step}
+
+	result, err := dbtx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errs.Errorf(errs.ERRCONFLICT, "two-factor code for user %d was already used", userID)
+	}
+
+	return nil
+}
+
+// delete
+
+// ConsumeRecoveryCode deletes the matching recovery code of the user, so it
+// works only once
+func ConsumeRecoveryCode(ctx context.Context, dbtx DBTX, userID int64, hash []byte) error {
+	stmt := `
+	DELETE FROM user_recovery_codes
+	WHERE user_id = $1 AND hash = $2
+	`
+
+	args := []any{userID, hash}
+
+	result, err := dbtx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errs.Errorf(errs.ERRNOTFOUND, "recovery code not found for user %d", userID)
+	}
+
+	return nil
+}
+
+func DeleteRecoveryCodes(ctx context.Context, dbtx DBTX, userID int64) error {
+	stmt := `
+	DELETE FROM user_recovery_codes WHERE user_id = $1
+	`
+
+	args := []any{userID}
+
+	_, err := dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
@@ -4,11 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
 )
 
+// columns scanned by scanUser
+const userColumns = `id, name, email, COALESCE(pending_email, ''), password_hash, activated, deletion_scheduled_at, totp_secret IS NOT NULL, created_at, version`
+
+func scanUser(row *sql.Row, user *model.UserDB) error {
+	return row.Scan(&user.ID, &user.Name, &user.Email, &user.PendingEmail, &user.PasswordHash, &user.Activated, &user.DeletionScheduledAt, &user.TwoFactorEnabled, &user.CreatedAt, &user.Version)
+}
+
 func CreateUser(ctx context.Context, dbtx DBTX, p *model.UserCreateParams) (*model.UserDB, error) {
 	stmt := `
 	INSERT INTO users (name, email, password_hash, activated)
@@ -52,7 +60,7 @@ func UserExists(ctx context.Context, dbtx DBTX, id int64) (bool, error) {
 
 func GetUserByEmail(ctx context.Context, dbtx DBTX, email string) (*model.UserDB, error) {
 	stmt := `
-	SELECT id, name, email, password_hash, activated, created_at, version
+	SELECT ` + userColumns + `
 	FROM users
 	WHERE email = $1
 	`
@@ -60,7 +68,7 @@ func GetUserByEmail(ctx context.Context, dbtx DBTX, email string) (*model.UserDB
 	args := []any{email}
 
 	var user model.UserDB
-	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Activated, &user.CreatedAt, &user.Version)
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -75,7 +83,7 @@ func GetUserByEmail(ctx context.Context, dbtx DBTX, email string) (*model.UserDB
 
 func GetUser(ctx context.Context, dbtx DBTX, id int64) (*model.UserDB, error) {
 	stmt := `
-	SELECT id, name, email, password_hash, activated, created_at, version
+	SELECT ` + userColumns + `
 	FROM users
 	WHERE id = $1
 	`
@@ -83,7 +91,32 @@ func GetUser(ctx context.Context, dbtx DBTX, id int64) (*model.UserDB, error) {
 	args := []any{id}
 
 	var user model.UserDB
-	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Activated, &user.CreatedAt, &user.Version)
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("users", id)
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// update
+
+func ActivateUser(ctx context.Context, dbtx DBTX, id int64) (*model.UserDB, error) {
+	stmt := `
+	UPDATE users
+	SET activated = true, version = version + 1
+	WHERE id = $1
+	RETURNING ` + userColumns
+
+	args := []any{id}
+
+	var user model.UserDB
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -95,3 +128,181 @@ func GetUser(ctx context.Context, dbtx DBTX, id int64) (*model.UserDB, error) {
 
 	return &user, nil
 }
+
+// UpdateUserPassword sets a new password hash; a version of 0 overwrites
+// whatever version the user is at
+func UpdateUserPassword(ctx context.Context, dbtx DBTX, id int64, version int, hash []byte) (*model.UserDB, error) {
+	stmt := `
+	UPDATE users
+	SET password_hash = $3, version = version + 1
+	WHERE id = $1 AND ($2 = 0 OR version = $2)
+	RETURNING ` + userColumns
+
+	args := []any{id, version, hash}
+
+	var user model.UserDB
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, userUpdateError(ctx, dbtx, id)
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func UpdateUserName(ctx context.Context, dbtx DBTX, p *model.UserNameEditParams) (*model.UserDB, error) {
+	stmt := `
+	UPDATE users
+	SET name = $3, version = version + 1
+	WHERE id = $1 AND version = $2
+	RETURNING ` + userColumns
+
+	args := []any{p.ID, p.Version, p.Name}
+
+	var user model.UserDB
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, userUpdateError(ctx, dbtx, p.ID)
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// SetUserPendingEmail stores the email a user is switching to until it's confirmed
+func SetUserPendingEmail(ctx context.Context, dbtx DBTX, p *model.UserEmailEditParams) (*model.UserDB, error) {
+	stmt := `
+	UPDATE users
+	SET pending_email = $3, version = version + 1
+	WHERE id = $1 AND version = $2
+	RETURNING ` + userColumns
+
+	args := []any{p.ID, p.Version, p.Email}
+
+	var user model.UserDB
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, userUpdateError(ctx, dbtx, p.ID)
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// ConfirmUserPendingEmail switches a user to their pending email; confirming
+// it proves the user owns the address, so it also activates them
+func ConfirmUserPendingEmail(ctx context.Context, dbtx DBTX, id int64) (*model.UserDB, error) {
+	stmt := `
+	UPDATE users
+	SET email = pending_email, pending_email = NULL, activated = true, version = version + 1
+	WHERE id = $1 AND pending_email IS NOT NULL
+	RETURNING ` + userColumns
+
+	args := []any{id}
+
+	var user model.UserDB
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return nil, errs.Errorf(errs.ERRCONFLICT, "duplicate on table [users] for field [email]")
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("users", id)
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// ScheduleUserDeletion marks the user for deletion at the given time; a nil
+// time cancels a scheduled deletion
+func ScheduleUserDeletion(ctx context.Context, dbtx DBTX, id int64, at *time.Time) (*model.UserDB, error) {
+	stmt := `
+	UPDATE users
+	SET deletion_scheduled_at = $2, version = version + 1
+	WHERE id = $1
+	RETURNING ` + userColumns
+
+	args := []any{id, at}
+
+	var user model.UserDB
+	err := scanUser(dbtx.QueryRowContext(ctx, stmt, args...), &user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("users", id)
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// delete
+
+// DeleteScheduledUsers deletes users whose scheduled deletion is due and returns
+// their ids; everything they own goes with them through ON DELETE CASCADE
+func DeleteScheduledUsers(ctx context.Context, dbtx DBTX) ([]int64, error) {
+	stmt := `
+	DELETE FROM users
+	WHERE deletion_scheduled_at <= NOW()
+	RETURNING id
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// DeleteUnactivatedUser deletes the user unless they activated their account;
+// everything they own goes with them through ON DELETE CASCADE
+func DeleteUnactivatedUser(ctx context.Context, dbtx DBTX, id int64) error {
+	stmt := `
+	DELETE FROM users
+	WHERE id = $1 AND NOT activated
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, id)
+	return err
+}
+
+// a versioned update matching no row is a conflict if the user still exists
+func userUpdateError(ctx context.Context, dbtx DBTX, id int64) error {
+	exists, err := UserExists(ctx, dbtx, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errRecordNotFound("users", id)
+	}
+	return errEditConflict("users", id)
+}
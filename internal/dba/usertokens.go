@@ -0,0 +1,79 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+func CreateUserToken(ctx context.Context, dbtx DBTX, p *model.UserTokenParams) error {
+	stmt := `
+	INSERT INTO user_tokens (hash, user_id, scope, expires_at)
+	VALUES ($1, $2, $3, $4)
+	`
+
+	args := []any{p.Hash, p.UserID, p.Scope, p.ExpiresAt}
+
+	_, err := dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// delete
+
+// ConsumeUserToken deletes an unexpired token of the scope and returns its
+// user, so every token works once
+func ConsumeUserToken(ctx context.Context, dbtx DBTX, hash []byte, scope string) (int64, error) {
+	stmt := `
+	DELETE FROM user_tokens
+	WHERE hash = $1 AND scope = $2 AND expires_at > NOW()
+	RETURNING user_id
+	`
+
+	args := []any{hash, scope}
+
+	var userID int64
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, errs.Errorf(errs.ERRNOTFOUND, "%s token not found", scope)
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// DeleteUserTokens removes all tokens of the scope for a user
+func DeleteUserTokens(ctx context.Context, dbtx DBTX, userID int64, scope string) error {
+	stmt := `
+	DELETE FROM user_tokens
+	WHERE user_id = $1 AND scope = $2
+	`
+
+	args := []any{userID, scope}
+
+	_, err := dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// DeleteExpiredUserTokens removes tokens that can no longer be used
+func DeleteExpiredUserTokens(ctx context.Context, dbtx DBTX) (int64, error) {
+	stmt := `
+	DELETE FROM user_tokens
+	WHERE expires_at <= NOW()
+	`
+
+	res, err := dbtx.ExecContext(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
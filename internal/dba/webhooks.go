@@ -0,0 +1,281 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// create
+
+func CreateWebhook(ctx context.Context, dbtx DBTX, p *model.WebhookCreateParams) (*model.WebhookDB, error) {
+	stmt := `
+	INSERT INTO webhooks (url, events, secret)
+	VALUES ($1, $2, $3)
+	RETURNING id, active, created_at, version
+	`
+
+	args := []any{p.URL, pq.Array(p.Events), p.Secret}
+
+	webhook := model.WebhookDB{
+		URL:    p.URL,
+		Events: p.Events,
+		Secret: p.Secret,
+	}
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&webhook.ID, &webhook.Active, &webhook.CreatedAt, &webhook.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// read
+
+func GetWebhook(ctx context.Context, dbtx DBTX, id int64) (*model.WebhookDB, error) {
+	stmt := `
+	SELECT id, url, events, secret, active, created_at, version
+	FROM webhooks
+	WHERE id = $1
+	`
+
+	var webhook model.WebhookDB
+
+	err := dbtx.QueryRowContext(ctx, stmt, id).Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Secret, &webhook.Active, &webhook.CreatedAt, &webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("webhooks", id)
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+func GetWebhooks(ctx context.Context, dbtx DBTX) ([]*model.WebhookDB, error) {
+	stmt := `
+	SELECT id, url, events, secret, active, created_at, version
+	FROM webhooks
+	ORDER BY id ASC
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*model.WebhookDB{}
+	for rows.Next() {
+		var webhook model.WebhookDB
+
+		err := rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Secret, &webhook.Active, &webhook.CreatedAt, &webhook.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// update
+
+func UpdateWebhook(ctx context.Context, dbtx DBTX, p *model.WebhookEditParams) (*model.WebhookDB, error) {
+	stmt := `
+	UPDATE webhooks
+	SET url = $2, events = $3, active = $4, version = version + 1
+	WHERE id = $1
+	RETURNING id, url, events, secret, active, created_at, version
+	`
+
+	args := []any{p.ID, p.URL, pq.Array(p.Events), p.Active}
+
+	var webhook model.WebhookDB
+
+	err := dbtx.QueryRowContext(ctx, stmt, args...).Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Secret, &webhook.Active, &webhook.CreatedAt, &webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("webhooks", p.ID)
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+// delete
+
+func DeleteWebhook(ctx context.Context, dbtx DBTX, id int64) error {
+	stmt := `
+	DELETE FROM webhooks
+	WHERE id = $1
+	`
+
+	result, err := dbtx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errRecordNotFound("webhooks", id)
+	}
+
+	return nil
+}
+
+// deliveries
+
+// EnqueueWebhookDeliveries queues the payload for every active webhook subscribed
+// to the event; run it in the transaction of the change so no event is lost
+func EnqueueWebhookDeliveries(ctx context.Context, dbtx DBTX, event string, payload []byte) error {
+	stmt := `
+	INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	SELECT id, $1, $2
+	FROM webhooks
+	WHERE active AND $1 = ANY(events)
+	`
+
+	_, err := dbtx.ExecContext(ctx, stmt, event, payload)
+	return err
+}
+
+// ClaimWebhookDeliveries marks due deliveries as delivering and leases them for
+// the given duration; deliveries whose lease runs out, e.g. after a crash, are
+// claimed again
+func ClaimWebhookDeliveries(ctx context.Context, dbtx DBTX, limit int, lease time.Duration) ([]*model.WebhookDeliveryJob, error) {
+	stmt := `
+	UPDATE webhook_deliveries AS d
+	SET status = 'delivering', next_attempt_at = NOW() + make_interval(secs => $2)
+	FROM webhooks AS w
+	WHERE d.webhook_id = w.id AND d.id IN (
+		SELECT id
+		FROM webhook_deliveries
+		WHERE status IN ('pending', 'delivering') AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*model.WebhookDeliveryJob{}
+	for rows.Next() {
+		var job model.WebhookDeliveryJob
+
+		err := rows.Scan(&job.ID, &job.WebhookID, &job.Event, &job.Payload, &job.Attempts, &job.URL, &job.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, &job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func SetWebhookDeliveryResult(ctx context.Context, dbtx DBTX, p *model.WebhookDeliveryResultParams) error {
+	stmt := `
+	UPDATE webhook_deliveries
+	SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5, last_error = $6,
+		delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() ELSE delivered_at END
+	WHERE id = $1
+	`
+
+	args := []any{p.ID, p.Status, p.Attempts, p.NextAttemptAt, p.LastStatusCode, p.LastError}
+
+	_, err := dbtx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+func GetWebhookDeliveries(ctx context.Context, dbtx DBTX, webhookID int64, limit int) ([]*model.WebhookDeliveryDB, error) {
+	stmt := `
+	SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE webhook_id = $1
+	ORDER BY id DESC
+	LIMIT $2
+	`
+
+	rows, err := dbtx.QueryContext(ctx, stmt, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*model.WebhookDeliveryDB{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhookDelivery queues a fresh copy of a delivery, keeping the old one in the log
+func RedeliverWebhookDelivery(ctx context.Context, dbtx DBTX, id int64, webhookID int64) (*model.WebhookDeliveryDB, error) {
+	stmt := `
+	INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	SELECT webhook_id, event, payload
+	FROM webhook_deliveries
+	WHERE id = $1 AND webhook_id = $2
+	RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at
+	`
+
+	delivery, err := scanWebhookDelivery(dbtx.QueryRowContext(ctx, stmt, id, webhookID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errRecordNotFound("webhook_deliveries", id)
+		default:
+			return nil, err
+		}
+	}
+
+	return delivery, nil
+}
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (*model.WebhookDeliveryDB, error) {
+	var delivery model.WebhookDeliveryDB
+
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
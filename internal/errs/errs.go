@@ -14,6 +14,8 @@ const (
 	ERRNOTFOUND       = "not_found"
 	ERRNOTIMPLEMENTED = "not_implemented"
 	ERRNOTAUTHORIZED  = "not_authorized"
+	ERRPRECONDITION   = "precondition_failed"
+	ERRTOOMANY        = "too_many_requests"
 )
 
 type Error struct {
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// FileMailer is for development and tests: it writes each message to an .eml
+// file in dir, or only logs it when dir is empty
+type FileMailer struct {
+	dir    string
+	sender string
+	logger *slog.Logger
+}
+
+func NewFileMailer(dir string, sender string, logger *slog.Logger) *FileMailer {
+	return &FileMailer{
+		dir:    dir,
+		sender: sender,
+		logger: logger,
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if m.dir == "" {
+		m.logger.Info("email not sent", "to", msg.To, "subject", msg.Subject, "body", msg.PlainBody)
+		return nil
+	}
+
+	raw, err := msg.bytes(m.sender)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	path := filepath.Join(m.dir, name)
+
+	err = os.MkdirAll(m.dir, 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, raw, 0o600)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info("email written", "to", msg.To, "subject", msg.Subject, "path", path)
+	return nil
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// passed from handler to service; deleting an account takes the password even
+// though the user is signed in
+type AccountDeleteInput struct {
+	ID                int64  `form:"-"` // taken from session
+	PasswordPlaintext string `form:"password"`
+	// signed in again a moment ago with a passkey or identity provider, which
+	// stands in for the password accounts made by single sign-on don't know
+	Reauthenticated bool `form:"-"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *AccountDeleteInput) Validate() {
+	if !i.Reauthenticated {
+		i.CheckField(validator.NotBlank(i.PasswordPlaintext), "password", "this field cannot be blank")
+	}
+}
+
+// AccountExport is everything stored about a user, written as one json file
+// per field to the export zip
+type AccountExport struct {
+	Profile       *AccountExportProfile        `json:"profile"`
+	Permissions   []string                     `json:"permissions"`
+	Sessions      []*AccountExportSession      `json:"sessions"`
+	SavedSearches []*AccountExportSavedSearch  `json:"saved_searches"`
+	Notifications []*AccountExportNotification `json:"notifications"`
+	APITokens     []*AccountExportAPIToken     `json:"api_tokens"`
+	Passkeys      []*AccountExportPasskey      `json:"passkeys"`
+	Identities    []*AccountExportIdentity     `json:"identities"`
+}
+
+// AccountExportFile is one file of the export zip
+type AccountExportFile struct {
+	Name string
+	Data any
+}
+
+// Files lists the export's files in a fixed order
+func (e *AccountExport) Files() []AccountExportFile {
+	return []AccountExportFile{
+		{Name: "profile.json", Data: e.Profile},
+		{Name: "permissions.json", Data: e.Permissions},
+		{Name: "sessions.json", Data: e.Sessions},
+		{Name: "saved_searches.json", Data: e.SavedSearches},
+		{Name: "notifications.json", Data: e.Notifications},
+		{Name: "api_tokens.json", Data: e.APITokens},
+		{Name: "passkeys.json", Data: e.Passkeys},
+		{Name: "identities.json", Data: e.Identities},
+	}
+}
+
+type AccountExportProfile struct {
+	ID                  int64      `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	PendingEmail        string     `json:"pending_email,omitempty"`
+	Activated           bool       `json:"activated"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+}
+
+// the handler fills these in, since it knows the current session and how
+// long sessions live
+type AccountExportSession struct {
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Expiry     time.Time `json:"expiry"`
+	Current    bool      `json:"current"`
+}
+
+type AccountExportSavedSearch struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	LastRunAt time.Time `json:"last_run_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AccountExportNotification struct {
+	ID        int64     `json:"id"`
+	Message   string    `json:"message"`
+	Link      string    `json:"link"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// token secrets are only stored hashed and aren't exported
+type AccountExportAPIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// binary values are base64 encoded; the public key only verifies sign-ins and
+// can't be used to sign in
+type AccountExportPasskey struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	CredentialID   []byte     `json:"credential_id"`
+	PublicKey      []byte     `json:"public_key"`
+	Transports     []string   `json:"transports"`
+	AAGUID         []byte     `json:"aaguid"`
+	SignCount      uint32     `json:"sign_count"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackupState    bool       `json:"backup_state"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// accounts at identity providers linked for single sign-on
+type AccountExportIdentity struct {
+	ID          int64      `json:"id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NewAccountExport converts the stored records of a user
+func NewAccountExport(u *UserDB, permissions PermissionCodes, searches []*SavedSearchDB, notifications []*NotificationDB, tokens []*APITokenDB, passkeys []*PasskeyDB, identities []*UserIdentityDB) *AccountExport {
+	e := &AccountExport{
+		Profile: &AccountExportProfile{
+			ID:                  u.ID,
+			Name:                u.Name,
+			Email:               u.Email,
+			PendingEmail:        u.PendingEmail,
+			Activated:           u.Activated,
+			CreatedAt:           u.CreatedAt,
+			DeletionScheduledAt: u.DeletionScheduledAt,
+			TwoFactorEnabled:    u.TwoFactorEnabled,
+		},
+		Permissions:   []string{},
+		Sessions:      []*AccountExportSession{},
+		SavedSearches: []*AccountExportSavedSearch{},
+		Notifications: []*AccountExportNotification{},
+		APITokens:     []*AccountExportAPIToken{},
+		Passkeys:      []*AccountExportPasskey{},
+		Identities:    []*AccountExportIdentity{},
+	}
+
+	e.Permissions = append(e.Permissions, permissions...)
+	for _, s := range searches {
+		e.SavedSearches = append(e.SavedSearches, &AccountExportSavedSearch{
+			ID:        s.ID,
+			Name:      s.Name,
+			Query:     s.Query,
+			LastRunAt: s.LastRunAt,
+			CreatedAt: s.CreatedAt,
+		})
+	}
+	for _, n := range notifications {
+		e.Notifications = append(e.Notifications, &AccountExportNotification{
+			ID:        n.ID,
+			Message:   n.Message,
+			Link:      n.Link,
+			Read:      n.Read,
+			CreatedAt: n.CreatedAt,
+		})
+	}
+	for _, t := range tokens {
+		e.APITokens = append(e.APITokens, &AccountExportAPIToken{
+			ID:         t.ID,
+			Name:       t.Name,
+			Scopes:     t.Scopes,
+			ExpiresAt:  t.ExpiresAt,
+			LastUsedAt: t.LastUsedAt,
+			CreatedAt:  t.CreatedAt,
+		})
+	}
+	for _, pk := range passkeys {
+		e.Passkeys = append(e.Passkeys, &AccountExportPasskey{
+			ID:             pk.ID,
+			Name:           pk.Name,
+			CredentialID:   pk.CredentialID,
+			PublicKey:      pk.PublicKey,
+			Transports:     pk.Transports,
+			AAGUID:         pk.AAGUID,
+			SignCount:      pk.SignCount,
+			BackupEligible: pk.BackupEligible,
+			BackupState:    pk.BackupState,
+			LastUsedAt:     pk.LastUsedAt,
+			CreatedAt:      pk.CreatedAt,
+		})
+	}
+	for _, uid := range identities {
+		e.Identities = append(e.Identities, &AccountExportIdentity{
+			ID:          uid.ID,
+			Provider:    uid.Provider,
+			Subject:     uid.Subject,
+			Email:       uid.Email,
+			LastLoginAt: uid.LastLoginAt,
+			CreatedAt:   uid.CreatedAt,
+		})
+	}
+
+	return e
+}
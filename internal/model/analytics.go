@@ -0,0 +1,107 @@
+package model
+
+import (
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// kinds of logged searches
+const (
+	SearchKindBeans    = "beans"
+	SearchKindRoasters = "roasters"
+)
+
+// passed from service to repository
+type SearchEventParams struct {
+	Kind        string
+	Term        string
+	Results     int
+	SessionHash string
+}
+
+// passed from handler to service
+type SearchAnalyticsInput struct {
+	Days int `form:"days"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *SearchAnalyticsInput) Validate() {
+	i.CheckField(i.Days >= 1, "days", "this field must be at least 1")
+	i.CheckField(i.Days <= 365, "days", "this field must be at most 365")
+}
+
+func (i *SearchAnalyticsInput) ToParams() *SearchAnalyticsParams {
+	return &SearchAnalyticsParams{
+		Since: time.Now().AddDate(0, 0, -i.Days+1),
+		Limit: searchAnalyticsLimit,
+	}
+}
+
+// passed from service to repository
+type SearchAnalyticsParams struct {
+	Since time.Time
+	Limit int
+}
+
+const searchAnalyticsLimit = 25
+
+// returned from repository to service; aggregated over the requested days
+type SearchTermStatDB struct {
+	Kind        string
+	Term        string
+	Searches    int
+	Sessions    int
+	ZeroResults int
+	LastResults int
+}
+
+func (m *SearchTermStatDB) ToResponse() *SearchTermStatResponse {
+	return &SearchTermStatResponse{
+		Kind:        m.Kind,
+		Term:        m.Term,
+		Searches:    m.Searches,
+		Sessions:    m.Sessions,
+		ZeroResults: m.ZeroResults,
+		LastResults: m.LastResults,
+	}
+}
+
+type SearchDayStatDB struct {
+	Day         time.Time
+	Searches    int
+	ZeroResults int
+}
+
+func (m *SearchDayStatDB) ToResponse() *SearchDayStatResponse {
+	return &SearchDayStatResponse{
+		Day:         m.Day,
+		Searches:    m.Searches,
+		ZeroResults: m.ZeroResults,
+	}
+}
+
+// returned from service to handler
+type SearchTermStatResponse struct {
+	Kind        string
+	Term        string
+	Searches    int
+	Sessions    int
+	ZeroResults int
+	LastResults int
+}
+
+type SearchDayStatResponse struct {
+	Day         time.Time
+	Searches    int
+	ZeroResults int
+}
+
+type SearchAnalyticsResponse struct {
+	Days        int
+	TopTerms    []*SearchTermStatResponse
+	ZeroResults []*SearchTermStatResponse
+	Trend       []*SearchDayStatResponse
+	MaxDaily    int // largest daily search count, for scaling the trend
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// prefix of every api token, so leaked tokens are easy to recognize
+const apiTokenPrefix = "ssc_"
+
+// permission codes a token can be granted; a token never grants more than its
+// owner's own permissions
+var apiTokenScopes = []string{
+	"beans:read",
+	"beans:write",
+	"roasters:read",
+	"roasters:write",
+}
+
+// token lifetimes offered, in days
+var apiTokenLifetimes = []int{7, 30, 90, 365}
+
+// passed from handler to service
+type APITokenCreateInput struct {
+	UserID    int64    `form:"-"` // taken from session
+	Name      string   `form:"name"`
+	Scopes    []string `form:"scopes"`
+	ExpiresIn int      `form:"expires_in"` // days
+
+	validator.Validator `form:"-"`
+}
+
+func (i *APITokenCreateInput) Validate() {
+	i.CheckField(i.UserID > 0, "user_id", "this field must be greater than 0")
+	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Name, 50), "name", "this field must be at most 50 characters")
+	i.CheckField(len(i.Scopes) > 0, "scopes", "pick at least one scope")
+	for _, s := range i.Scopes {
+		i.CheckField(validator.PermittedValue(s, apiTokenScopes...), "scopes", fmt.Sprintf("scopes must be in %v", apiTokenScopes))
+	}
+	i.CheckField(validator.PermittedValue(i.ExpiresIn, apiTokenLifetimes...), "expires_in", fmt.Sprintf("this field must be one of %v", apiTokenLifetimes))
+}
+
+func (i *APITokenCreateInput) ToParams() (*APITokenCreateParams, error) {
+	plaintext, hash, err := generateToken(apiTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := slices.Clone(i.Scopes)
+	slices.Sort(scopes)
+
+	return &APITokenCreateParams{
+		UserID:    i.UserID,
+		Name:      i.Name,
+		Plaintext: plaintext,
+		Hash:      hash,
+		Scopes:    slices.Compact(scopes),
+		ExpiresAt: time.Now().AddDate(0, 0, i.ExpiresIn),
+	}, nil
+}
+
+// HasScope reports whether the scope is picked, for re-rendering the form
+func (i *APITokenCreateInput) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// ScopeOptions lists the scopes offered by the form
+func (i *APITokenCreateInput) ScopeOptions() []string {
+	return apiTokenScopes
+}
+
+// LifetimeOptions lists the lifetimes offered by the form, in days
+func (i *APITokenCreateInput) LifetimeOptions() []int {
+	return apiTokenLifetimes
+}
+
+// passed from service to repository
+type APITokenCreateParams struct {
+	UserID    int64
+	Name      string
+	Plaintext string // never stored; handed back once on creation
+	Hash      []byte
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// returned from repository to service
+type APITokenDB struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (m *APITokenDB) ToResponse() *APITokenResponse {
+	return &APITokenResponse{
+		ID:         m.ID,
+		Name:       m.Name,
+		Scopes:     m.Scopes,
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// returned from service to handler
+type APITokenResponse struct {
+	ID         int64
+	Name       string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+
+	// only set right after creation
+	Plaintext string
+}
+
+func (r *APITokenResponse) Expired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// user and scopes of a request authenticated with an api token
+type APITokenAuthResponse struct {
+	TokenID int64
+	User    *UserResponse
+	Scopes  []string
+}
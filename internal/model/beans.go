@@ -1,27 +1,35 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/query"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
 )
 
 // passed from handler to service
 // gets validated in service
 type BeanCreateInput struct {
-	Name       string         `form:"name"`
-	RoastLevel RoastLevelEnum `form:"roast_level"`
-	RoasterID  int64          `form:"roaster_id"`
+	Name       string         `form:"name" json:"name"`
+	RoastLevel RoastLevelEnum `form:"roast_level" json:"roast_level"`
+	RoasterID  int64          `form:"roaster_id" json:"roaster_id"`
 
-	validator.Validator `form:"-"`
+	// display only; resolved from RoasterID when the form is re-rendered
+	RoasterName string `form:"-" json:"-"`
+
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (i *BeanCreateInput) Validate() {
 	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
 	i.CheckField(validator.NotBlank(string(i.RoastLevel)), "roast_level", "this field cannot be blank")
 	i.CheckField(validator.PermittedValue(i.RoastLevel, roastLevels...), "roast_level", fmt.Sprintf("this field must be one of %v", roastLevels))
-	i.CheckField(i.RoasterID > 0, "roaster_id", "this field must be greater than 0")
+	i.CheckField(i.RoasterID > 0, "roaster_id", "pick a roaster from the suggestions")
 }
 
 func (i *BeanCreateInput) ToParams() *BeanCreateParams {
@@ -42,20 +50,34 @@ type BeanCreateParams struct {
 // passed from handler to service
 // gets validated in service
 type BeanEditInput struct {
-	ID         int64          `form:"-"`
-	Name       string         `form:"name"`
-	RoastLevel RoastLevelEnum `form:"roast_level"`
-	RoasterID  int64          `form:"roaster_id"`
+	ID         int64          `form:"-" json:"-"`
+	Name       string         `form:"name" json:"name"`
+	RoastLevel RoastLevelEnum `form:"roast_level" json:"roast_level"`
+	RoasterID  int64          `form:"roaster_id" json:"roaster_id"`
+
+	// version the edit is based on; 0 overwrites whatever is current
+	Version int `form:"version" json:"version,omitempty"`
+
+	// display only; resolved from RoasterID when the form is re-rendered
+	RoasterName string `form:"-" json:"-"`
 
-	validator.Validator `form:"-"`
+	// values the form was loaded with, carried in hidden fields so a conflict
+	// can tell the user's changes from someone else's
+	LoadedName        string         `form:"loaded_name" json:"-"`
+	LoadedRoastLevel  RoastLevelEnum `form:"loaded_roast_level" json:"-"`
+	LoadedRoasterID   int64          `form:"loaded_roaster_id" json:"-"`
+	LoadedRoasterName string         `form:"-" json:"-"` // display only, like RoasterName
+
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (i *BeanEditInput) Validate() {
 	i.CheckField(i.ID > 0, "id", "this field musts be greater than 0")
+	i.CheckField(i.Version >= 0, "version", "this field must not be negative")
 	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
 	i.CheckField(validator.NotBlank(string(i.RoastLevel)), "roast_level", "this field cannot be blank")
 	i.CheckField(validator.PermittedValue(i.RoastLevel, roastLevels...), "roast_level", fmt.Sprintf("this field must be one of %v", roastLevels))
-	i.CheckField(i.RoasterID > 0, "roaster_id", "this field must be greater than 0")
+	i.CheckField(i.RoasterID > 0, "roaster_id", "pick a roaster from the suggestions")
 }
 
 func (i *BeanEditInput) ToParams() *BeanEditParams {
@@ -64,6 +86,7 @@ func (i *BeanEditInput) ToParams() *BeanEditParams {
 		Name:       i.Name,
 		RoastLevel: i.RoastLevel,
 		RoasterID:  i.RoasterID,
+		Version:    i.Version,
 	}
 }
 
@@ -73,6 +96,7 @@ type BeanEditParams struct {
 	Name       string
 	RoastLevel RoastLevelEnum
 	RoasterID  int64
+	Version    int
 }
 
 // returned from repository to service
@@ -93,6 +117,8 @@ func (m *BeanDB) ToResponse() *BeanResponse {
 		Name:       m.Name,
 		RoastLevel: m.RoastLevel,
 		RoasterID:  m.RoasterID,
+		CreatedAt:  m.CreatedAt,
+		Version:    m.Version,
 	}
 	if m.Roaster != nil {
 		r.Roaster = m.Roaster.ToResponse()
@@ -102,26 +128,45 @@ func (m *BeanDB) ToResponse() *BeanResponse {
 
 // returned from service to handler
 type BeanResponse struct {
-	ID         int64
-	Name       string
-	RoastLevel RoastLevelEnum
-	RoasterID  int64
+	ID         int64          `json:"id"`
+	Name       string         `json:"name"`
+	RoastLevel RoastLevelEnum `json:"roast_level"`
+	RoasterID  int64          `json:"roaster_id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Version    int            `json:"version"`
 
-	Roaster *RoasterResponse
+	Roaster *RoasterResponse `json:"roaster,omitempty"`
 }
 
 func (r *BeanResponse) ToEditInput() *BeanEditInput {
-	return &BeanEditInput{
+	i := &BeanEditInput{
 		ID:         r.ID,
 		Name:       r.Name,
 		RoastLevel: r.RoastLevel,
 		RoasterID:  r.RoasterID,
 	}
+	if r.Roaster != nil {
+		i.RoasterName = r.Roaster.Name
+	}
+	i.loadedFrom(r)
+	return i
+}
+
+// loadedFrom bases the edit on the bean's current version and values
+func (i *BeanEditInput) loadedFrom(r *BeanResponse) {
+	i.Version = r.Version
+	i.LoadedName = r.Name
+	i.LoadedRoastLevel = r.RoastLevel
+	i.LoadedRoasterID = r.RoasterID
+	i.LoadedRoasterName = ""
+	if r.Roaster != nil {
+		i.LoadedRoasterName = r.Roaster.Name
+	}
 }
 
 type BeanFilterInput struct {
-	Term string `form:"term"`
-	Sort string `form:"sort"`
+	Term string `form:"term" json:"term"`
+	Sort string `form:"sort" json:"sort"`
 
 	// PageNum  int
 	// PageSize int
@@ -131,13 +176,19 @@ type BeanFilterInput struct {
 
 func (i *BeanFilterInput) Validate() {
 	i.CheckField(validator.MaxChars(i.Term, 50), "term", "this field must be at most 50 characters")
+	if msg := checkBeanQuery(i.Term); msg != "" {
+		i.AddFieldError("term", msg)
+	}
 	i.CheckField(validator.NotBlank(i.Sort), "sort", "this field must not be empty")
 	i.CheckField(validator.PermittedValue(i.Sort, beanSortBys...), "sort", fmt.Sprintf("this field must be in one of %v", beanSortBys))
 }
 
 func (i *BeanFilterInput) ToParams() *BeanFilterParams {
+	// parse errors were already reported by Validate
+	q, _ := query.Parse(i.Term, beanQueryFields...)
+
 	p := &BeanFilterParams{
-		SearchTerm: i.Term,
+		Query: q,
 	}
 	// TODO: maybe use a map instead since sorts used by multiple filters
 	switch i.Sort {
@@ -162,9 +213,41 @@ func (i *BeanFilterInput) ToParams() *BeanFilterParams {
 }
 
 type BeanFilterParams struct {
-	SearchTerm string
-	SortField  string
-	SortDir    string
+	Query     query.Query
+	AfterID   int64 // only beans with a greater id; 0 for all
+	SortField string
+	SortDir   string
+}
+
+// BeanFilterFromQuery builds a filter input from a url query string like the one
+// used by the bean list page, e.g. `term=roast:light&sort=name_asc`
+func BeanFilterFromQuery(qs string) (*BeanFilterInput, error) {
+	v, err := url.ParseQuery(strings.TrimPrefix(qs, "?"))
+	if err != nil {
+		return nil, err
+	}
+
+	i := &BeanFilterInput{
+		Term: v.Get("term"),
+		Sort: v.Get("sort"),
+	}
+	if i.Sort == "" {
+		i.Sort = SortByIDAsc
+	}
+
+	return i, nil
+}
+
+// Query encodes the filter back into a url query string for the bean list page
+func (i *BeanFilterInput) Query() string {
+	v := url.Values{}
+	if i.Term != "" {
+		v.Set("term", i.Term)
+	}
+	if i.Sort != "" {
+		v.Set("sort", i.Sort)
+	}
+	return v.Encode()
 }
 
 // value models
@@ -187,6 +270,21 @@ var roastLevels = []RoastLevelEnum{
 	RLDark,
 }
 
+// position of the roast level from light to dark; -1 if unknown
+func (rl RoastLevelEnum) Ordinal() int {
+	return slices.Index(roastLevels, rl)
+}
+
+// all roast levels from light to dark
+func RoastLevels() []RoastLevelEnum {
+	return slices.Clone(roastLevels)
+}
+
+// number of steps between the lightest and darkest roast level
+func RoastLevelSteps() int {
+	return len(roastLevels) - 1
+}
+
 // TODO: move this to filter.go
 const (
 	SortByIDAsc    string = "id_asc"
@@ -195,9 +293,54 @@ const (
 	SortByNameDesc string = "name_desc"
 )
 
+// qualifiers accepted in the bean search term, e.g. `roast:light roaster:"Sey"`
+const (
+	BeanQueryName    = "name"
+	BeanQueryRoast   = "roast"
+	BeanQueryRoaster = "roaster"
+)
+
+var beanQueryFields = []string{
+	BeanQueryName,
+	BeanQueryRoast,
+	BeanQueryRoaster,
+}
+
+// beans don't record where they were grown, so `origin:` can't be searched
+const beanQueryOrigin = "origin"
+
+// checkBeanQuery returns the field error for a bean search term, or "" if it
+// can be searched
+func checkBeanQuery(term string) string {
+	q, err := query.Parse(term, beanQueryFields...)
+	if err != nil {
+		var perr *query.Error
+		if errors.As(err, &perr) && perr.Field == beanQueryOrigin {
+			return fmt.Sprintf("beans don't record their origin, so it can't be searched (at position %d); qualifiers are %v", perr.Pos+1, beanQueryFields)
+		}
+		return err.Error()
+	}
+
+	// unknown roast levels would just match nothing
+	for _, g := range q.Groups {
+		for _, t := range g {
+			if t.Field == BeanQueryRoast && !slices.Contains(roastLevels, RoastLevelEnum(strings.ToLower(t.Value))) {
+				return fmt.Sprintf("unknown roast level %q; expected one of %v", t.Value, roastLevels)
+			}
+		}
+	}
+
+	return ""
+}
+
 var beanSortBys = []string{
 	SortByIDAsc,
 	SortByIDDesc,
 	SortByNameAsc,
 	SortByNameDesc,
 }
+
+// permitted sort values for the bean filter
+func BeanSortBys() []string {
+	return slices.Clone(beanSortBys)
+}
@@ -0,0 +1,94 @@
+package model
+
+// EditConflict sets a rejected edit against the values the user loaded and the
+// current values of the record, so the user can see which changes are theirs
+// and decide what to keep
+type EditConflict struct {
+	Fields []*EditConflictField
+}
+
+type EditConflictField struct {
+	Label         string
+	Loaded        string // when the user opened the form
+	Yours         string
+	Current       string
+	ChangedByYou  bool
+	ChangedByThem bool
+}
+
+// ChangedBy names who changed the field since the form was loaded: "you",
+// "them", "both" or "" for nobody
+func (f *EditConflictField) ChangedBy() string {
+	switch {
+	case f.ChangedByYou && f.ChangedByThem:
+		return "both"
+	case f.ChangedByYou:
+		return "you"
+	case f.ChangedByThem:
+		return "them"
+	default:
+		return ""
+	}
+}
+
+// add adds a field, and takes their value into the edit if only they changed
+// it, so submitting again doesn't undo their change
+func (c *EditConflict) add(label string, loaded string, yours *string, current string) {
+	f := c.addChanged(label, loaded, *yours, current, *yours != loaded, current != loaded)
+	if f.ChangedBy() == "them" {
+		*yours = current
+	}
+}
+
+// addChanged adds a field whose changes aren't seen in its displayed values,
+// like a roaster picked by id
+func (c *EditConflict) addChanged(label string, loaded string, yours string, current string, byYou bool, byThem bool) *EditConflictField {
+	f := &EditConflictField{
+		Label:         label,
+		Loaded:        loaded,
+		Yours:         yours,
+		Current:       current,
+		ChangedByYou:  byYou,
+		ChangedByThem: byThem,
+	}
+	c.Fields = append(c.Fields, f)
+	return f
+}
+
+// Conflict compares the edit and the current bean with the values the edit was
+// loaded with, and rebases the edit onto the current version, so submitting it
+// again keeps the user's changes and theirs where they don't overlap
+func (i *BeanEditInput) Conflict(current *BeanResponse) *EditConflict {
+	c := &EditConflict{}
+	c.add("Name", i.LoadedName, &i.Name, current.Name)
+	roastLevel := string(i.RoastLevel)
+	c.add("Roast Level", string(i.LoadedRoastLevel), &roastLevel, string(current.RoastLevel))
+	i.RoastLevel = RoastLevelEnum(roastLevel)
+	currentRoaster := ""
+	if current.Roaster != nil {
+		currentRoaster = current.Roaster.Name
+	}
+	f := c.addChanged("Roaster", i.LoadedRoasterName, i.RoasterName, currentRoaster, i.RoasterID != i.LoadedRoasterID, current.RoasterID != i.LoadedRoasterID)
+	if f.ChangedBy() == "them" {
+		i.RoasterID = current.RoasterID
+		i.RoasterName = currentRoaster
+	}
+
+	i.loadedFrom(current)
+	return c
+}
+
+// Conflict compares the edit and the current roaster with the values the edit
+// was loaded with, and rebases the edit onto the current version, so
+// submitting it again keeps the user's changes and theirs where they don't
+// overlap
+func (i *RoasterEditInput) Conflict(current *RoasterResponse) *EditConflict {
+	c := &EditConflict{}
+	c.add("Name", i.LoadedName, &i.Name, current.Name)
+	c.add("Description", i.LoadedDescription, &i.Description, current.Description)
+	c.add("Website", i.LoadedWebsite, &i.Website, current.Website)
+	c.add("Location", i.LoadedLocation, &i.Location, current.Location)
+
+	i.loadedFrom(current)
+	return c
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+)
+
+var exportFormats = []string{ExportFormatCSV, ExportFormatJSON, ExportFormatNDJSON}
+
+// ExportFormats lists the accepted export formats
+func ExportFormats() []string {
+	return slices.Clone(exportFormats)
+}
+
+// columns of an export file; a superset of the import columns, so an export can
+// be edited and imported again
+var (
+	beanExportColumns    = []string{"id", "external_ref", "name", "roast_level", "roaster_id", "roaster", "created_at"}
+	roasterExportColumns = []string{"id", "external_ref", "name", "description", "website", "location", "created_at"}
+)
+
+// BeanExportColumns lists the columns of a bean export file
+func BeanExportColumns() []string {
+	return slices.Clone(beanExportColumns)
+}
+
+// RoasterExportColumns lists the columns of a roaster export file
+func RoasterExportColumns() []string {
+	return slices.Clone(roasterExportColumns)
+}
+
+// ExportRow is a row that can be written as a csv record or a json object
+type ExportRow interface {
+	// values in the order of the export columns
+	Record() []string
+}
+
+// streamed from repository to handler, one row at a time
+type BeanExportRow struct {
+	ID          int64          `json:"id"`
+	ExternalRef string         `json:"external_ref"`
+	Name        string         `json:"name"`
+	RoastLevel  RoastLevelEnum `json:"roast_level"`
+	RoasterID   int64          `json:"roaster_id"`
+	Roaster     string         `json:"roaster"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func (r *BeanExportRow) Record() []string {
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		r.ExternalRef,
+		r.Name,
+		string(r.RoastLevel),
+		strconv.FormatInt(r.RoasterID, 10),
+		r.Roaster,
+		r.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+type RoasterExportRow struct {
+	ID          int64     `json:"id"`
+	ExternalRef string    `json:"external_ref"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Website     string    `json:"website"`
+	Location    string    `json:"location"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (r *RoasterExportRow) Record() []string {
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		r.ExternalRef,
+		r.Name,
+		r.Description,
+		r.Website,
+		r.Location,
+		r.CreatedAt.Format(time.RFC3339),
+	}
+}
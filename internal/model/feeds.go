@@ -0,0 +1,44 @@
+package model
+
+import (
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/query"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// entries per feed, newest first
+const feedEntryLimit = 50
+
+// passed from handler to service; takes the term of a bean list query string,
+// so any saved search can be followed as a feed
+type BeanFeedInput struct {
+	Term      string `form:"term"`
+	RoasterID int64  `form:"-"` // parsed from URL param; 0 for all roasters
+
+	validator.Validator `form:"-"`
+}
+
+func (i *BeanFeedInput) Validate() {
+	i.CheckField(validator.MaxChars(i.Term, 50), "term", "this field must be at most 50 characters")
+	if msg := checkBeanQuery(i.Term); msg != "" {
+		i.AddFieldError("term", msg)
+	}
+	i.CheckField(i.RoasterID >= 0, "roaster_id", "this field must not be negative")
+}
+
+func (i *BeanFeedInput) ToParams() *BeanFeedParams {
+	// parse errors were already reported by Validate
+	q, _ := query.Parse(i.Term, beanQueryFields...)
+
+	return &BeanFeedParams{
+		Query:     q,
+		RoasterID: i.RoasterID,
+		Limit:     feedEntryLimit,
+	}
+}
+
+// passed from service to repository
+type BeanFeedParams struct {
+	Query     query.Query
+	RoasterID int64
+	Limit     int
+}
@@ -0,0 +1,286 @@
+package model
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatJSON = "json"
+)
+
+var importFormats = []string{ImportFormatCSV, ImportFormatJSON}
+
+// largest accepted import file
+const ImportMaxBytes = 1 << 20
+
+// row actions shown in the preview
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+)
+
+// columns of an import file; external_ref identifies a row across imports
+var (
+	beanImportColumns    = []string{"external_ref", "name", "roast_level", "roaster_id", "roaster"}
+	roasterImportColumns = []string{"external_ref", "name", "description", "website", "location"}
+)
+
+// columns of an export file that are set by the database; skipped on import
+var importIgnoredColumns = []string{"id", "created_at"}
+
+// BeanImportColumns lists the columns of a bean import file
+func BeanImportColumns() []string {
+	return slices.Clone(beanImportColumns)
+}
+
+// RoasterImportColumns lists the columns of a roaster import file
+func RoasterImportColumns() []string {
+	return slices.Clone(roasterImportColumns)
+}
+
+// passed from handler to service; the parsed rows are filled in by the service,
+// each with its own field errors
+type ImportInput struct {
+	Format string `form:"format"`
+	Data   string `form:"data"`
+
+	BeanRows    []*BeanImportRow    `form:"-"`
+	RoasterRows []*RoasterImportRow `form:"-"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *ImportInput) Validate() {
+	i.CheckField(validator.PermittedValue(i.Format, importFormats...), "format", fmt.Sprintf("this field must be one of %v", importFormats))
+	i.CheckField(validator.NotBlank(i.Data), "data", "the file is empty")
+	i.CheckField(len(i.Data) <= ImportMaxBytes, "data", fmt.Sprintf("the file must be at most %d bytes", ImportMaxBytes))
+}
+
+// DetectImportFormat guesses the format from the file name, then the content
+func DetectImportFormat(filename string, data string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return ImportFormatCSV
+	case ".json":
+		return ImportFormatJSON
+	}
+	if strings.HasPrefix(strings.TrimSpace(data), "[") {
+		return ImportFormatJSON
+	}
+	return ImportFormatCSV
+}
+
+// one parsed row of an import file
+type BeanImportRow struct {
+	Line        int // line in a csv file, position in a json array
+	ExternalRef string
+	RoasterName string // resolved to RoasterID if the id is missing
+	Action      string
+
+	Input *BeanCreateInput
+}
+
+type RoasterImportRow struct {
+	Line        int
+	ExternalRef string
+	Action      string
+
+	Input *RoasterCreateInput
+}
+
+// passed from service to repository
+type BeanImportParams struct {
+	ExternalRef string
+	*BeanCreateParams
+}
+
+type RoasterImportParams struct {
+	ExternalRef string
+	*RoasterCreateParams
+}
+
+// returned from service to handler
+type ImportResponse struct {
+	DryRun    bool `json:"dry_run"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+}
+
+// ParseBeanImport reads the rows of a bean import file. Problems with a single
+// value are reported on its row; problems with the whole file are returned.
+func ParseBeanImport(format string, data string) ([]*BeanImportRow, error) {
+	records, err := parseImport(format, data, beanImportColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []*BeanImportRow{}
+	for _, rec := range records {
+		row := &BeanImportRow{
+			Line:        rec.line,
+			ExternalRef: rec.values["external_ref"],
+			RoasterName: rec.values["roaster"],
+			Input: &BeanCreateInput{
+				Name:       rec.values["name"],
+				RoastLevel: RoastLevelEnum(strings.ToLower(rec.values["roast_level"])),
+			},
+		}
+		if s := rec.values["roaster_id"]; s != "" {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				row.Input.AddFieldError("roaster_id", "this field must be a number")
+			}
+			row.Input.RoasterID = id
+		}
+		row.Input.RoasterName = row.RoasterName
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// ParseRoasterImport reads the rows of a roaster import file
+func ParseRoasterImport(format string, data string) ([]*RoasterImportRow, error) {
+	records, err := parseImport(format, data, roasterImportColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []*RoasterImportRow{}
+	for _, rec := range records {
+		rows = append(rows, &RoasterImportRow{
+			Line:        rec.line,
+			ExternalRef: rec.values["external_ref"],
+			Input: &RoasterCreateInput{
+				Name:        rec.values["name"],
+				Description: rec.values["description"],
+				Website:     rec.values["website"],
+				Location:    rec.values["location"],
+			},
+		})
+	}
+
+	return rows, nil
+}
+
+// ValidateImportRef checks the external reference of a row; refs must be unique in a file
+func ValidateImportRef(v *validator.Validator, ref string, seen map[string]int, line int) {
+	v.CheckField(validator.NotBlank(ref), "external_ref", "this field cannot be blank")
+	v.CheckField(validator.MaxChars(ref, 100), "external_ref", "this field must be at most 100 characters")
+	if prev, ok := seen[ref]; ok && ref != "" {
+		v.AddFieldError("external_ref", fmt.Sprintf("duplicate of the row at %d", prev))
+	}
+	seen[ref] = line
+}
+
+type importRecord struct {
+	line   int
+	values map[string]string
+}
+
+func parseImport(format string, data string, columns []string) ([]importRecord, error) {
+	switch format {
+	case ImportFormatCSV:
+		return parseImportCSV(data, columns)
+	case ImportFormatJSON:
+		return parseImportJSON(data, columns)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func parseImportCSV(data string, columns []string) ([]importRecord, error) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the file has no header row")
+		}
+		return nil, err
+	}
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(col, "\ufeff")))
+		if slices.Contains(importIgnoredColumns, col) {
+			header[i] = ""
+			continue
+		}
+		if !slices.Contains(columns, col) {
+			return nil, fmt.Errorf("unknown column %q; columns are %v", col, columns)
+		}
+		header[i] = col
+	}
+
+	records := []importRecord{}
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+		values := map[string]string{}
+		for i, v := range rec {
+			if header[i] != "" {
+				values[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		records = append(records, importRecord{line: line, values: values})
+	}
+
+	return records, nil
+}
+
+func parseImportJSON(data string, columns []string) ([]importRecord, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+
+	var objects []map[string]any
+	err := dec.Decode(&objects)
+	if err != nil {
+		return nil, fmt.Errorf("the file must be a JSON array of objects: %w", err)
+	}
+
+	records := []importRecord{}
+	for n, obj := range objects {
+		values := map[string]string{}
+		for key, v := range obj {
+			if slices.Contains(importIgnoredColumns, key) {
+				continue
+			}
+			if !slices.Contains(columns, key) {
+				return nil, fmt.Errorf("unknown key %q in object %d; keys are %v", key, n+1, columns)
+			}
+			switch v := v.(type) {
+			case nil:
+			case string:
+				values[key] = strings.TrimSpace(v)
+			case json.Number:
+				values[key] = v.String()
+			default:
+				return nil, fmt.Errorf("key %q in object %d must be a string or number", key, n+1)
+			}
+		}
+		records = append(records, importRecord{line: n + 1, values: values})
+	}
+
+	return records, nil
+}
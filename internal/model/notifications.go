@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// passed from service to repository
+type NotificationCreateParams struct {
+	UserID  int64
+	Message string
+	Link    string
+}
+
+// returned from repository to service
+type NotificationDB struct {
+	ID        int64
+	UserID    int64
+	Message   string
+	Link      string
+	Read      bool
+	CreatedAt time.Time
+}
+
+func (m *NotificationDB) ToResponse() *NotificationResponse {
+	return &NotificationResponse{
+		ID:        m.ID,
+		Message:   m.Message,
+		Link:      m.Link,
+		Read:      m.Read,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// returned from service to handler
+type NotificationResponse struct {
+	ID        int64
+	Message   string
+	Link      string
+	Read      bool
+	CreatedAt time.Time
+}
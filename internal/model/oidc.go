@@ -0,0 +1,104 @@
+package model
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passed from handler to service; the claims of an id token whose signature,
+// audience and nonce were already checked
+type OIDCLoginInput struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool // by the identity provider, or trusted to be
+	Name          string
+	AuthTime      time.Time // when the user last entered credentials at the provider; zero if not told
+
+	validator.Validator
+}
+
+func (i *OIDCLoginInput) Validate() {
+	if !validator.NotBlank(i.Provider) || !validator.NotBlank(i.Subject) {
+		i.AddNonFieldError("the identity provider didn't say who you are; try again")
+	}
+}
+
+// CanLinkByEmail reports whether the identity can be matched to an account by
+// email; only an email the identity provider vouches for proves ownership
+func (i *OIDCLoginInput) CanLinkByEmail() bool {
+	return i.EmailVerified && validator.Matches(i.Email, validator.EmailRX)
+}
+
+// ToUserParams makes a new account for the identity. It gets a random password
+// nobody knows; a password of their own can be set with a password reset
+func (i *OIDCLoginInput) ToUserParams() (*UserCreateParams, error) {
+	plaintext, _, err := generateToken("")
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	// fall back to the local part of the email and fit the name length limit
+	name := strings.TrimSpace(i.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(i.Email, "@")
+	}
+	for utf8.RuneCountInString(name) > 20 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return &UserCreateParams{
+		Name:         name,
+		Email:        i.Email,
+		PasswordHash: hash,
+		Activated:    true, // the identity provider verified the email
+	}, nil
+}
+
+func (i *OIDCLoginInput) ToIdentityParams(userID int64) *UserIdentityParams {
+	return &UserIdentityParams{
+		UserID:   userID,
+		Provider: i.Provider,
+		Subject:  i.Subject,
+		Email:    i.Email,
+	}
+}
+
+// passed from service to repository
+type UserIdentityParams struct {
+	UserID   int64
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// passed from repository to service
+type UserIdentityDB struct {
+	ID          int64
+	UserID      int64
+	Provider    string
+	Subject     string
+	Email       string
+	LastLoginAt *time.Time
+	CreatedAt   time.Time
+}
+
+// passed from service to handler
+type OIDCLoginResponse struct {
+	User *UserResponse
+	// the account was created by this sign-in, along with its initial role
+	Created bool
+	// an unactivated account with the same email that was deleted to make
+	// room for the identity's new account; 0 if there was none
+	ReplacedUserID int64
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// NewWebAuthnHandle generates the opaque id a user is known by to their
+// authenticators; random so it says nothing about the account
+func NewWebAuthnHandle() ([]byte, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// PasskeyUser is a user as the webauthn ceremonies see them
+type PasskeyUser struct {
+	Handle   []byte
+	Name     string
+	Email    string
+	Passkeys []*PasskeyDB
+}
+
+func (u *PasskeyUser) WebAuthnID() []byte {
+	return u.Handle
+}
+
+func (u *PasskeyUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	return u.Name
+}
+
+func (u *PasskeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, pk := range u.Passkeys {
+		creds = append(creds, pk.Credential())
+	}
+	return creds
+}
+
+// CredentialDescriptors lists the user's passkeys, so an authenticator isn't
+// registered twice
+func (u *PasskeyUser) CredentialDescriptors() []protocol.CredentialDescriptor {
+	descs := make([]protocol.CredentialDescriptor, 0, len(u.Passkeys))
+	for _, cred := range u.WebAuthnCredentials() {
+		descs = append(descs, cred.Descriptor())
+	}
+	return descs
+}
+
+// PasskeyByCredentialID finds the stored passkey a ceremony used
+func (u *PasskeyUser) PasskeyByCredentialID(id []byte) *PasskeyDB {
+	for _, pk := range u.Passkeys {
+		if string(pk.CredentialID) == string(id) {
+			return pk
+		}
+	}
+	return nil
+}
+
+// PasskeyCeremony is the start of a registration or login: the options for the
+// browser, and the challenge to keep in the session until the browser answers
+type PasskeyCeremony struct {
+	Options any
+	Session *webauthn.SessionData
+}
+
+// passed from handler to service; Credential is the browser's json encoded
+// answer to the registration options
+type PasskeyCreateInput struct {
+	UserID     int64                 `form:"-"` // taken from session
+	Session    *webauthn.SessionData `form:"-"` // taken from session, set when the options were handed out
+	Name       string                `form:"name"`
+	Credential string                `form:"credential"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *PasskeyCreateInput) Validate() {
+	i.CheckField(i.UserID > 0, "user_id", "this field must be greater than 0")
+	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Name, 50), "name", "this field must be at most 50 characters")
+	i.CheckField(i.Session != nil, "credential", "the passkey setup expired; try again")
+	i.CheckField(validator.NotBlank(i.Credential), "credential", "your browser didn't send a passkey; try again")
+}
+
+// ParseCredential decodes and parses the browser's answer
+func (i *PasskeyCreateInput) ParseCredential() (*protocol.ParsedCredentialCreationData, error) {
+	return protocol.ParseCredentialCreationResponseBody(strings.NewReader(i.Credential))
+}
+
+func (i *PasskeyCreateInput) ToParams(cred *webauthn.Credential) *PasskeyCreateParams {
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return &PasskeyCreateParams{
+		UserID:          i.UserID,
+		Name:            i.Name,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+	}
+}
+
+// passed from service to repository
+type PasskeyCreateParams struct {
+	UserID          int64
+	Name            string
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+}
+
+// passed from handler to service; Credential is the browser's json encoded
+// answer to the login options
+type PasskeyLoginInput struct {
+	Session    *webauthn.SessionData `form:"-"` // taken from session, set when the options were handed out
+	Credential string                `form:"credential"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *PasskeyLoginInput) Validate() {
+	i.CheckField(i.Session != nil, "credential", "the passkey sign-in expired; try again")
+	i.CheckField(validator.NotBlank(i.Credential), "credential", "your browser didn't send a passkey; try again")
+}
+
+// ParseCredential decodes and parses the browser's answer
+func (i *PasskeyLoginInput) ParseCredential() (*protocol.ParsedCredentialAssertionData, error) {
+	return protocol.ParseCredentialRequestResponseBody(strings.NewReader(i.Credential))
+}
+
+// passed from repository to service
+type PasskeyDB struct {
+	ID              int64
+	UserID          int64
+	Name            string
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
+}
+
+// Credential converts the stored passkey for verifying a login with it
+func (m *PasskeyDB) Credential() webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(m.Transports))
+	for _, t := range m.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(t))
+	}
+
+	return webauthn.Credential{
+		ID:              m.CredentialID,
+		PublicKey:       m.PublicKey,
+		AttestationType: m.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: m.BackupEligible,
+			BackupState:    m.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    m.AAGUID,
+			SignCount: m.SignCount,
+		},
+	}
+}
+
+func (m *PasskeyDB) ToResponse() *PasskeyResponse {
+	return &PasskeyResponse{
+		ID:         m.ID,
+		Name:       m.Name,
+		Synced:     m.BackupState,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// passed from service to handler
+type PasskeyResponse struct {
+	ID         int64
+	Name       string
+	Synced     bool // backed up by the platform, e.g. to a password manager
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// passed from service to handler
+type PasskeyLoginResponse struct {
+	User *UserResponse
+	// whether the authenticator checked it's really the user, e.g. with a
+	// fingerprint or PIN, making the passkey count as two factors
+	UserVerified bool
+}
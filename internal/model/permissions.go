@@ -1,9 +1,32 @@
 package model
 
-import "slices"
+import (
+	"slices"
+	"strconv"
+)
+
+// roles seeded with their policies by the migrations
+const (
+	RoleGuest     = "guest" // anonymous users
+	RoleUser      = "user"  // given on signup
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// PermissionRequireTwoFactor isn't checked against a route; granted to a role,
+// it makes two-factor authentication mandatory for the role's members
+const PermissionRequireTwoFactor = "2fa:require"
 
 type PermissionCodes []string
 
 func (pcs PermissionCodes) Contains(c string) bool {
 	return slices.Contains(pcs, c)
 }
+
+// RBACSubject is who casbin knows the user as; names aren't unique, ids are
+func RBACSubject(userID int64) string {
+	if userID == 0 {
+		return RoleGuest
+	}
+	return strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,27 @@
+package model
+
+// passed from service to repository
+type BeanSimilarityParams struct {
+	BeanID        int64
+	SimilarBeanID int64
+	Score         float64
+}
+
+// returned from repository to service
+type BeanSimilarityDB struct {
+	Bean  *BeanDB // the similar bean
+	Score float64
+}
+
+func (m *BeanSimilarityDB) ToResponse() *BeanSimilarityResponse {
+	return &BeanSimilarityResponse{
+		Bean:  m.Bean.ToResponse(),
+		Score: m.Score,
+	}
+}
+
+// returned from service to handler
+type BeanSimilarityResponse struct {
+	Bean  *BeanResponse
+	Score float64
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
@@ -9,12 +11,12 @@ import (
 
 // passed from handler to service
 type RoasterCreateInput struct {
-	Name        string `form:"name"`
-	Description string `form:"description"`
-	Website     string `form:"website"`
-	Location    string `form:"location"`
+	Name        string `form:"name" json:"name"`
+	Description string `form:"description" json:"description"`
+	Website     string `form:"website" json:"website"`
+	Location    string `form:"location" json:"location"`
 
-	validator.Validator `form:"-"`
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (i *RoasterCreateInput) Validate() {
@@ -30,7 +32,7 @@ func (i *RoasterCreateInput) ToParams() *RoasterCreateParams {
 		Name:        i.Name,
 		Description: i.Description,
 		Website:     i.Website,
-		Location:    i.Website,
+		Location:    i.Location,
 	}
 }
 
@@ -44,17 +46,28 @@ type RoasterCreateParams struct {
 
 // passed from handler to service
 type RoasterEditInput struct {
-	ID          int64  `form:"-"` // parsed from URL param
-	Name        string `form:"name"`
-	Description string `form:"description"`
-	Website     string `form:"website"`
-	Location    string `form:"location"`
+	ID          int64  `form:"-" json:"-"` // parsed from URL param
+	Name        string `form:"name" json:"name"`
+	Description string `form:"description" json:"description"`
+	Website     string `form:"website" json:"website"`
+	Location    string `form:"location" json:"location"`
 
-	validator.Validator `form:"-"`
+	// version the edit is based on; 0 overwrites whatever is current
+	Version int `form:"version" json:"version,omitempty"`
+
+	// values the form was loaded with, carried in hidden fields so a conflict
+	// can tell the user's changes from someone else's
+	LoadedName        string `form:"loaded_name" json:"-"`
+	LoadedDescription string `form:"loaded_description" json:"-"`
+	LoadedWebsite     string `form:"loaded_website" json:"-"`
+	LoadedLocation    string `form:"loaded_location" json:"-"`
+
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (i *RoasterEditInput) Validate() {
 	i.CheckField(i.ID > 0, "id", "this field must be greater than 0")
+	i.CheckField(i.Version >= 0, "version", "this field must not be negative")
 	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
 	i.CheckField(validator.MaxChars(i.Name, 50), "name", "this field must have at most 50 characters")
 	i.CheckField(validator.MaxChars(i.Description, 300), "description", "this field must have at most 300 characters")
@@ -68,7 +81,8 @@ func (i *RoasterEditInput) ToParams() *RoasterEditParams {
 		Name:        i.Name,
 		Description: i.Description,
 		Website:     i.Website,
-		Location:    i.Website,
+		Location:    i.Location,
+		Version:     i.Version,
 	}
 }
 
@@ -79,6 +93,7 @@ type RoasterEditParams struct {
 	Description string
 	Website     string
 	Location    string
+	Version     int
 }
 
 // returned from repository to service
@@ -101,6 +116,7 @@ func (m *RoasterDB) ToResponse() *RoasterResponse {
 		Description: m.Description,
 		Website:     m.Website,
 		Location:    m.Location,
+		Version:     m.Version,
 	}
 	if m.Beans != nil {
 		beans := []*BeanResponse{}
@@ -115,28 +131,40 @@ func (m *RoasterDB) ToResponse() *RoasterResponse {
 
 // returned from service to handler
 type RoasterResponse struct {
-	ID          int64
-	Name        string
-	Description string
-	Website     string
-	Location    string
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Website     string `json:"website"`
+	Location    string `json:"location"`
+	Version     int    `json:"version"`
 
-	Beans []*BeanResponse
+	Beans []*BeanResponse `json:"beans,omitempty"`
 }
 
 func (r *RoasterResponse) ToEditInput() *RoasterEditInput {
-	return &RoasterEditInput{
+	i := &RoasterEditInput{
 		ID:          r.ID,
 		Name:        r.Name,
 		Description: r.Description,
 		Website:     r.Website,
 		Location:    r.Location,
 	}
+	i.loadedFrom(r)
+	return i
+}
+
+// loadedFrom bases the edit on the roaster's current version and values
+func (i *RoasterEditInput) loadedFrom(r *RoasterResponse) {
+	i.Version = r.Version
+	i.LoadedName = r.Name
+	i.LoadedDescription = r.Description
+	i.LoadedWebsite = r.Website
+	i.LoadedLocation = r.Location
 }
 
 type RoasterFilterInput struct {
-	Term string `form:"term"`
-	Sort string `form:"sort"`
+	Term string `form:"term" json:"term"`
+	Sort string `form:"sort" json:"sort"`
 
 	// PageNum  int
 	// PageSize int
@@ -182,9 +210,40 @@ type RoasterFilterParams struct {
 	SortDir    string
 }
 
+// passed from handler to service for the roaster picker typeahead
+type RoasterSuggestInput struct {
+	Term string `form:"roaster_name" json:"roaster_name"`
+
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (i *RoasterSuggestInput) Validate() {
+	i.CheckField(validator.MaxChars(i.Term, 50), "roaster_name", "this field must be at most 50 characters")
+}
+
+func (i *RoasterSuggestInput) ToParams() *RoasterSuggestParams {
+	return &RoasterSuggestParams{
+		Term:  strings.TrimSpace(i.Term),
+		Limit: roasterSuggestLimit,
+	}
+}
+
+// passed from service to repository
+type RoasterSuggestParams struct {
+	Term  string
+	Limit int
+}
+
+const roasterSuggestLimit = 10
+
 var roasterSortBys = []string{
 	SortByIDAsc,
 	SortByIDDesc,
 	SortByNameAsc,
 	SortByNameDesc,
 }
+
+// permitted sort values for the roaster filter
+func RoasterSortBys() []string {
+	return slices.Clone(roasterSortBys)
+}
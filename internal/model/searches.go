@@ -0,0 +1,136 @@
+package model
+
+import (
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// passed from handler to service
+type SavedSearchCreateInput struct {
+	UserID int64  `form:"-"` // taken from session
+	Name   string `form:"name"`
+	Query  string `form:"query"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *SavedSearchCreateInput) Validate() {
+	i.CheckField(i.UserID > 0, "user_id", "this field must be greater than 0")
+	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Name, 50), "name", "this field must be at most 50 characters")
+	validateSavedSearchQuery(&i.Validator, i.Query)
+}
+
+func (i *SavedSearchCreateInput) ToParams() *SavedSearchCreateParams {
+	return &SavedSearchCreateParams{
+		UserID: i.UserID,
+		Name:   i.Name,
+		Query:  normalizeSavedSearchQuery(i.Query),
+	}
+}
+
+// passed from service to repository
+type SavedSearchCreateParams struct {
+	UserID int64
+	Name   string
+	Query  string
+}
+
+// passed from handler to service
+type SavedSearchEditInput struct {
+	ID     int64  `form:"-"` // parsed from URL param
+	UserID int64  `form:"-"` // taken from session
+	Name   string `form:"name"`
+	Query  string `form:"query"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *SavedSearchEditInput) Validate() {
+	i.CheckField(i.ID > 0, "id", "this field must be greater than 0")
+	i.CheckField(i.UserID > 0, "user_id", "this field must be greater than 0")
+	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Name, 50), "name", "this field must be at most 50 characters")
+	validateSavedSearchQuery(&i.Validator, i.Query)
+}
+
+func (i *SavedSearchEditInput) ToParams() *SavedSearchEditParams {
+	return &SavedSearchEditParams{
+		ID:     i.ID,
+		UserID: i.UserID,
+		Name:   i.Name,
+		Query:  normalizeSavedSearchQuery(i.Query),
+	}
+}
+
+// passed from service to repository
+type SavedSearchEditParams struct {
+	ID     int64
+	UserID int64
+	Name   string
+	Query  string
+}
+
+// returned from repository to service
+type SavedSearchDB struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Query      string
+	LastBeanID int64
+	LastRunAt  time.Time
+	CreatedAt  time.Time
+	Version    int
+}
+
+func (m *SavedSearchDB) ToResponse() *SavedSearchResponse {
+	return &SavedSearchResponse{
+		ID:        m.ID,
+		Name:      m.Name,
+		Query:     m.Query,
+		LastRunAt: m.LastRunAt,
+	}
+}
+
+// returned from service to handler
+type SavedSearchResponse struct {
+	ID        int64
+	Name      string
+	Query     string
+	LastRunAt time.Time
+}
+
+func (r *SavedSearchResponse) ToEditInput() *SavedSearchEditInput {
+	return &SavedSearchEditInput{
+		ID:    r.ID,
+		Name:  r.Name,
+		Query: r.Query,
+	}
+}
+
+// the saved query must be a valid bean list filter
+func validateSavedSearchQuery(v *validator.Validator, qs string) {
+	v.CheckField(validator.MaxChars(qs, 500), "query", "this field must be at most 500 characters")
+
+	filter, err := BeanFilterFromQuery(qs)
+	if err != nil {
+		v.AddFieldError("query", "this field must be a valid query string")
+		return
+	}
+
+	filter.Validate()
+	for _, msg := range filter.FieldErrors {
+		v.AddFieldError("query", "this field must be a valid bean search: "+msg)
+	}
+}
+
+// strip everything but the filter fields, so equal searches are stored equally
+func normalizeSavedSearchQuery(qs string) string {
+	filter, err := BeanFilterFromQuery(qs)
+	if err != nil {
+		// should never happen since input must be validated
+		return qs
+	}
+	return filter.Query()
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+)
+
+// how often a session's last seen time and address are written back
+const SessionSeenInterval = time.Minute
+
+// longest user agent kept for a session
+const sessionUserAgentMax = 255
+
+// NewSessionKey generates the key a signed-in session's record is found by;
+// it lives in the session data, so it stays the same when the token changes
+func NewSessionKey() (string, error) {
+	key, _, err := generateToken("")
+	return key, err
+}
+
+// passed from handler to service
+type UserSessionParams struct {
+	UserID    int64
+	Key       string
+	Token     string // session store token, which changes when it's renewed
+	IP        string
+	UserAgent string
+}
+
+// Truncate keeps overly long user agents out of the database
+func (p *UserSessionParams) Truncate() {
+	if len(p.UserAgent) > sessionUserAgentMax {
+		p.UserAgent = p.UserAgent[:sessionUserAgentMax]
+	}
+}
+
+// passed from repository to service
+type UserSessionDB struct {
+	ID         int64
+	UserID     int64
+	UserEmail  string // only filled in when listing sessions of all users
+	Key        string
+	Token      string // only filled in when getting or deleting a session
+	IP         string
+	UserAgent  string
+	LastSeenAt time.Time
+	CreatedAt  time.Time
+}
+
+func (m *UserSessionDB) ToResponse(currentKey string) *UserSessionResponse {
+	return &UserSessionResponse{
+		ID:         m.ID,
+		UserID:     m.UserID,
+		UserEmail:  m.UserEmail,
+		IP:         m.IP,
+		UserAgent:  m.UserAgent,
+		LastSeenAt: m.LastSeenAt,
+		CreatedAt:  m.CreatedAt,
+		Current:    currentKey != "" && m.Key == currentKey,
+	}
+}
+
+// passed from service to handler
+type UserSessionResponse struct {
+	ID         int64
+	UserID     int64
+	UserEmail  string
+	IP         string
+	UserAgent  string
+	LastSeenAt time.Time
+	CreatedAt  time.Time
+	Current    bool // the session making the request
+}
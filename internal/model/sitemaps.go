@@ -0,0 +1,70 @@
+package model
+
+import (
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// urls per sitemap file; sitemaps.org allows at most 50,000
+const SitemapPageSize = 50000
+
+const (
+	SitemapBeans    = "beans"
+	SitemapRoasters = "roasters"
+)
+
+// SitemapKinds lists the tables that get their own sitemap files
+func SitemapKinds() []string {
+	return []string{SitemapBeans, SitemapRoasters}
+}
+
+// passed from handler to service; parsed from a sitemap file name like beans-2.xml
+type SitemapPageInput struct {
+	Kind string
+	Page int // starting at 1
+
+	validator.Validator
+}
+
+func (i *SitemapPageInput) Validate() {
+	i.CheckField(validator.PermittedValue(i.Kind, SitemapKinds()...), "kind", "unknown sitemap")
+	i.CheckField(i.Page >= 1, "page", "this field must be at least 1")
+}
+
+func (i *SitemapPageInput) ToParams() *SitemapPageParams {
+	return &SitemapPageParams{
+		Kind:   i.Kind,
+		Limit:  SitemapPageSize,
+		Offset: (i.Page - 1) * SitemapPageSize,
+	}
+}
+
+// passed from service to repository
+type SitemapPageParams struct {
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+// number of sitemap files per kind
+type SitemapIndexResponse struct {
+	Pages map[string]int
+}
+
+func sitemapPages(count int) int {
+	return (count + SitemapPageSize - 1) / SitemapPageSize
+}
+
+// NewSitemapIndexResponse splits row counts per kind into sitemap files
+func NewSitemapIndexResponse(counts map[string]int) *SitemapIndexResponse {
+	r := &SitemapIndexResponse{Pages: map[string]int{}}
+	for kind, count := range counts {
+		r.Pages[kind] = sitemapPages(count)
+	}
+	return r
+}
+
+// ids of the records listed in one sitemap file
+type SitemapPageResponse struct {
+	Kind string
+	IDs  []int64
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// what failed logins are counted against; an email is counted whether or not
+// an account has it, so a lockout says nothing about which accounts exist
+const (
+	LoginThrottleAccount = "account"
+	LoginThrottleIP      = "ip"
+)
+
+// after a few free failures each further one doubles the wait before the next
+// attempt, up to LoginMaxDelay; failures are forgotten after a quiet window
+const (
+	LoginFreeFailures  = 3
+	LoginMaxDelay      = time.Minute
+	LoginFailureWindow = time.Hour
+)
+
+// LoginThrottlePolicy is when failed logins lock an email or client ip out
+type LoginThrottlePolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	Lockout            time.Duration
+}
+
+// MaxFailures is how many failures lock the scope out
+func (p LoginThrottlePolicy) MaxFailures(scope string) int {
+	if scope == LoginThrottleIP {
+		return p.MaxIPFailures
+	}
+	return p.MaxAccountFailures
+}
+
+// LoginThrottleKeys are what failed logins of the email from the client ip are
+// counted against, by scope
+func LoginThrottleKeys(email string, ip string) map[string]string {
+	keys := map[string]string{
+		LoginThrottleAccount: LoginThrottleKey(email),
+	}
+	if ip != "" {
+		keys[LoginThrottleIP] = ip
+	}
+	return keys
+}
+
+// LoginThrottleKey normalizes what is counted, so case doesn't give an email
+// fresh attempts
+func LoginThrottleKey(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// passed from repository to service
+type LoginThrottleDB struct {
+	Scope         string
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// Wait is how long until the next login attempt is allowed
+func (m *LoginThrottleDB) Wait(now time.Time) time.Duration {
+	if m.LockedUntil != nil && now.Before(*m.LockedUntil) {
+		return m.LockedUntil.Sub(now)
+	}
+
+	if m.Failures <= LoginFreeFailures || now.Sub(m.LastFailureAt) > LoginFailureWindow {
+		return 0
+	}
+
+	delay := LoginMaxDelay
+	if n := m.Failures - LoginFreeFailures - 1; n < 16 {
+		delay = min(time.Second<<n, LoginMaxDelay)
+	}
+
+	return max(m.LastFailureAt.Add(delay).Sub(now), 0)
+}
+
+func (m *LoginThrottleDB) ToResponse() *LoginThrottleResponse {
+	return &LoginThrottleResponse{
+		Scope:       m.Scope,
+		Key:         m.Key,
+		Failures:    m.Failures,
+		LockedUntil: m.LockedUntil,
+	}
+}
+
+// passed from service to handler
+type LoginThrottleResponse struct {
+	Scope       string
+	Key         string
+	Failures    int
+	LockedUntil *time.Time
+}
+
+// LoginThrottledMessage tells a user how long to wait, the same way for every
+// email and ip
+func LoginThrottledMessage(wait time.Duration) string {
+	switch {
+	case wait >= 2*time.Minute:
+		return fmt.Sprintf("too many failed login attempts; try again in %d minutes", int(wait.Round(time.Minute).Minutes()))
+	default:
+		return fmt.Sprintf("too many failed login attempts; try again in %d seconds", int(max(wait.Round(time.Second), time.Second).Seconds()))
+	}
+}
+
+// passed from handler to service
+type LoginUnlockInput struct {
+	Scope string `form:"scope"`
+	Key   string `form:"key"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *LoginUnlockInput) Validate() {
+	i.CheckField(validator.PermittedValue(i.Scope, LoginThrottleAccount, LoginThrottleIP), "scope", "this field must be account or ip")
+	i.CheckField(validator.NotBlank(i.Key), "key", "this field cannot be blank")
+}
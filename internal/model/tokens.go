@@ -0,0 +1,28 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+)
+
+// generateToken returns a random plaintext token with the given prefix and the
+// hash that gets stored in its place
+func generateToken(prefix string) (string, []byte, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plaintext := prefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+	return plaintext, HashToken(plaintext), nil
+}
+
+// HashToken hashes a plaintext token for lookup; tokens are random enough that
+// a fast hash is sufficient
+func HashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// rfc 6238 parameters; the defaults every authenticator app understands
+const (
+	totpIssuer = "somethingsomethingcoffee"
+	totpPeriod = 30
+	totpSkew   = 1 // steps accepted either side of now, for clock drift
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// NewTOTPKey generates a new secret for the account; its URL is what the QR
+// code encodes and is kept in the session until the user confirms it
+func NewTOTPKey(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+}
+
+// ValidateTOTP checks a code against the secret around t and returns the time
+// step it belongs to. Steps at or before lastStep were already used and are
+// rejected, so a code can't be replayed
+func ValidateTOTP(secret string, code string, t time.Time, lastStep int64) (int64, bool) {
+	now := t.Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		want, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// NewRecoveryCodes generates a fresh set of one-time recovery codes and the
+// hashes that get stored in their place
+func NewRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for n := range codes {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes[n] = code[:5] + "-" + code[5:]
+		hashes[n] = HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode drops the separators people type or paste along with a code
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// passed from handler to service
+type TwoFactorEnableInput struct {
+	ID     int64  `form:"-"` // taken from session
+	KeyURL string `form:"-"` // taken from session, set when the QR code was shown
+	Code   string `form:"code"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *TwoFactorEnableInput) Validate() {
+	i.CheckField(i.KeyURL != "", "code", "the setup expired; reload the page to get a new QR code")
+	i.CheckField(validator.NotBlank(i.Code), "code", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Code, 20), "code", "this field must be at most 20 characters")
+}
+
+// Secret reads the secret back out of the key URL
+func (i *TwoFactorEnableInput) Secret() (string, error) {
+	key, err := otp.NewKeyFromURL(i.KeyURL)
+	if err != nil {
+		return "", err
+	}
+	return key.Secret(), nil
+}
+
+func (i *TwoFactorEnableInput) NormalizedCode() string {
+	return normalizeCode(i.Code)
+}
+
+// passed from handler to service; the second login step, taking either a code
+// from the authenticator app or a recovery code
+type TwoFactorLoginInput struct {
+	UserID    int64  `form:"-" json:"-"` // taken from the pending login in the session
+	Code      string `form:"code" json:"code"`
+	IP        string `form:"-" json:"-"` // taken from request, for throttling
+	LockedOut bool   `form:"-" json:"-"` // set when this attempt locked the email or ip out
+
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (i *TwoFactorLoginInput) Validate() {
+	i.CheckField(validator.NotBlank(i.Code), "code", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Code, 20), "code", "this field must be at most 20 characters")
+}
+
+func (i *TwoFactorLoginInput) NormalizedCode() string {
+	return normalizeCode(i.Code)
+}
+
+// IsRecoveryCode tells recovery codes apart from authenticator codes, which
+// are all digits
+func (i *TwoFactorLoginInput) IsRecoveryCode() bool {
+	code := i.NormalizedCode()
+	return len(code) != totpOpts.Digits.Length() || strings.Trim(code, "0123456789") != ""
+}
+
+// passed from handler to service; turning 2fa off or getting new recovery
+// codes takes the password even though the user is signed in
+type TwoFactorPasswordInput struct {
+	ID                int64  `form:"-"` // taken from session
+	PasswordPlaintext string `form:"password"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *TwoFactorPasswordInput) Validate() {
+	i.CheckField(validator.NotBlank(i.PasswordPlaintext), "password", "this field cannot be blank")
+}
+
+// passed from repository to service
+type UserTOTPDB struct {
+	UserID   int64
+	Secret   string
+	LastStep int64
+}
+
+// passed from service to handler
+type TwoFactorResponse struct {
+	Enabled           bool
+	RecoveryCodesLeft int
+}
+
+// passed from service to handler; the only time recovery codes are readable
+type RecoveryCodesResponse struct {
+	Codes []string
+}
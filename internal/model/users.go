@@ -10,11 +10,11 @@ import (
 var AnonymousUser = &UserResponse{}
 
 type UserCreateInput struct {
-	Name              string `form:"name"`
-	Email             string `form:"email"`
-	PasswordPlaintext string `form:"password"`
+	Name              string `form:"name" json:"name"`
+	Email             string `form:"email" json:"email"`
+	PasswordPlaintext string `form:"password" json:"password"`
 
-	validator.Validator `form:"-"`
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (i *UserCreateInput) Validate() {
@@ -38,7 +38,7 @@ func (i *UserCreateInput) ToParams() (*UserCreateParams, error) {
 		Name:         i.Name,
 		Email:        i.Email,
 		PasswordHash: hash,
-		Activated:    true, // TODO: change to false after email registration confirmation implemented
+		Activated:    false, // until the emailed activation token is used
 	}, nil
 }
 
@@ -50,10 +50,12 @@ type UserCreateParams struct {
 }
 
 type UserLoginInput struct {
-	Email             string `form:"email"`
-	PasswordPlaintext string `form:"password"`
+	Email             string `form:"email" json:"email"`
+	PasswordPlaintext string `form:"password" json:"password"`
+	IP                string `form:"-" json:"-"` // taken from request, for throttling
+	LockedOut         bool   `form:"-" json:"-"` // set when this attempt locked the email or ip out
 
-	validator.Validator `form:"-"`
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (i *UserLoginInput) Validate() {
@@ -65,30 +67,163 @@ func (i *UserLoginInput) Validate() {
 	i.CheckField(validator.MaxBytes(i.PasswordPlaintext, 72), "password", "this field must be at most 72 bytes")
 }
 
+// ThrottleKeys are what failed logins are counted against, by scope
+func (i *UserLoginInput) ThrottleKeys() map[string]string {
+	return LoginThrottleKeys(i.Email, i.IP)
+}
+
+// passed from handler to service
+type UserNameEditInput struct {
+	ID      int64  `form:"-"` // taken from session
+	Version int    `form:"version"`
+	Name    string `form:"name"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *UserNameEditInput) Validate() {
+	i.CheckField(i.Version > 0, "version", "this field must be greater than 0")
+	i.CheckField(validator.NotBlank(i.Name), "name", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Name, 20), "name", "this field must be at most 20 characters")
+}
+
+func (i *UserNameEditInput) ToParams() *UserNameEditParams {
+	return &UserNameEditParams{
+		ID:      i.ID,
+		Version: i.Version,
+		Name:    i.Name,
+	}
+}
+
+// passed from service to repository
+type UserNameEditParams struct {
+	ID      int64
+	Version int
+	Name    string
+}
+
+// passed from handler to service; the new email only takes effect once the
+// link sent to it is followed
+type UserEmailEditInput struct {
+	ID      int64  `form:"-"` // taken from session
+	Version int    `form:"version"`
+	Email   string `form:"email"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *UserEmailEditInput) Validate() {
+	i.CheckField(i.Version > 0, "version", "this field must be greater than 0")
+	i.CheckField(validator.NotBlank(i.Email), "email", "this field cannot be blank")
+	i.CheckField(validator.Matches(i.Email, validator.EmailRX), "email", "this field must be a valid email")
+}
+
+func (i *UserEmailEditInput) ToParams() *UserEmailEditParams {
+	return &UserEmailEditParams{
+		ID:      i.ID,
+		Version: i.Version,
+		Email:   i.Email,
+	}
+}
+
+// passed from service to repository
+type UserEmailEditParams struct {
+	ID      int64
+	Version int
+	Email   string
+}
+
+// passed from handler to service
+type UserPasswordEditInput struct {
+	ID                int64  `form:"-"` // taken from session
+	Version           int    `form:"version"`
+	CurrentPassword   string `form:"current_password"`
+	PasswordPlaintext string `form:"password"`
+	// signed in again a moment ago, standing in for the current password
+	Reauthenticated bool `form:"-"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *UserPasswordEditInput) Validate() {
+	i.CheckField(i.Version > 0, "version", "this field must be greater than 0")
+	if !i.Reauthenticated {
+		i.CheckField(validator.NotBlank(i.CurrentPassword), "current_password", "this field cannot be blank")
+	}
+	i.CheckField(validator.NotBlank(i.PasswordPlaintext), "password", "this field cannot be blank")
+	i.CheckField(validator.MinChars(i.PasswordPlaintext, 8), "password", "this field must be at least 8 characters")
+	i.CheckField(validator.MaxChars(i.PasswordPlaintext, 30), "password", "this field must be at most 30 characters")
+	i.CheckField(validator.MaxBytes(i.PasswordPlaintext, 72), "password", "this field must be at most 72 bytes")
+}
+
+func (i *UserPasswordEditInput) ToParams() ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(i.PasswordPlaintext), 12)
+}
+
 type UserDB struct {
 	ID           int64
 	Name         string
 	Email        string
+	PendingEmail string
 	PasswordHash []byte
 	Activated    bool
 	CreatedAt    time.Time
 	Version      int
+
+	DeletionScheduledAt *time.Time
+	TwoFactorEnabled    bool
 }
 
 func (m *UserDB) ToResponse() *UserResponse {
 	return &UserResponse{
-		ID:        m.ID,
-		Name:      m.Name,
-		Email:     m.Email,
-		Activated: m.Activated,
+		ID:           m.ID,
+		Name:         m.Name,
+		Email:        m.Email,
+		PendingEmail: m.PendingEmail,
+		Activated:    m.Activated,
+		CreatedAt:    m.CreatedAt,
+		Version:      m.Version,
+
+		DeletionScheduledAt: m.DeletionScheduledAt,
+		TwoFactorEnabled:    m.TwoFactorEnabled,
 	}
 }
 
 type UserResponse struct {
-	ID        int64
-	Name      string
-	Email     string
-	Activated bool
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	PendingEmail string    `json:"pending_email,omitempty"` // waiting for confirmation
+	Activated    bool      `json:"activated"`
+	CreatedAt    time.Time `json:"created_at"`
+	Version      int       `json:"version"`
+
+	// set while the account waits out the deletion grace period
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+}
+
+func (r *UserResponse) ToNameEditInput() *UserNameEditInput {
+	return &UserNameEditInput{
+		ID:      r.ID,
+		Version: r.Version,
+		Name:    r.Name,
+	}
+}
+
+func (r *UserResponse) ToEmailEditInput() *UserEmailEditInput {
+	return &UserEmailEditInput{
+		ID:      r.ID,
+		Version: r.Version,
+		Email:   r.PendingEmail,
+	}
+}
+
+func (r *UserResponse) ToPasswordEditInput() *UserPasswordEditInput {
+	return &UserPasswordEditInput{
+		ID:      r.ID,
+		Version: r.Version,
+	}
 }
 
 func (r *UserResponse) IsAnonymous() bool {
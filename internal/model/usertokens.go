@@ -0,0 +1,148 @@
+package model
+
+import (
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// what a user token can be exchanged for; a token only works for its own scope
+const (
+	ScopeActivation    = "activation"
+	ScopePasswordReset = "password-reset"
+	ScopeEmailChange   = "email-change"
+)
+
+// token prefixes, so pasted codes are easy to recognize
+const (
+	activationTokenPrefix    = "act_"
+	passwordResetTokenPrefix = "rst_"
+	emailChangeTokenPrefix   = "eml_"
+)
+
+// how long emailed links stay valid
+const (
+	activationTokenTTL    = 3 * 24 * time.Hour
+	passwordResetTokenTTL = time.Hour
+	emailChangeTokenTTL   = 24 * time.Hour
+)
+
+// passed from service to repository
+type UserTokenParams struct {
+	UserID    int64
+	Scope     string
+	Plaintext string // only ever emailed, never stored
+	Hash      []byte
+	ExpiresAt time.Time
+}
+
+func newUserToken(userID int64, scope string, prefix string, ttl time.Duration) (*UserTokenParams, error) {
+	plaintext, hash, err := generateToken(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserTokenParams{
+		UserID:    userID,
+		Scope:     scope,
+		Plaintext: plaintext,
+		Hash:      hash,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// NewActivationToken generates a single-use activation token for the user
+func NewActivationToken(userID int64) (*UserTokenParams, error) {
+	return newUserToken(userID, ScopeActivation, activationTokenPrefix, activationTokenTTL)
+}
+
+// NewPasswordResetToken generates a single-use password reset token for the user
+func NewPasswordResetToken(userID int64) (*UserTokenParams, error) {
+	return newUserToken(userID, ScopePasswordReset, passwordResetTokenPrefix, passwordResetTokenTTL)
+}
+
+// NewEmailChangeToken generates a single-use token confirming the user's pending email
+func NewEmailChangeToken(userID int64) (*UserTokenParams, error) {
+	return newUserToken(userID, ScopeEmailChange, emailChangeTokenPrefix, emailChangeTokenTTL)
+}
+
+// passed from handler to service
+type UserActivateInput struct {
+	Token string `form:"token" json:"token"`
+
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (i *UserActivateInput) Validate() {
+	i.CheckField(validator.NotBlank(i.Token), "token", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Token, 100), "token", "this field must be at most 100 characters")
+}
+
+// data for the activation email
+type ActivationEmailData struct {
+	Name          string
+	Token         string
+	ActivationURL string
+	ExpiresAt     time.Time
+}
+
+// passed from handler to service
+type UserPasswordForgotInput struct {
+	Email string `form:"email" json:"email"`
+
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (i *UserPasswordForgotInput) Validate() {
+	i.CheckField(validator.NotBlank(i.Email), "email", "this field cannot be blank")
+	i.CheckField(validator.Matches(i.Email, validator.EmailRX), "email", "this field must be a valid email")
+}
+
+// passed from handler to service
+type UserPasswordResetInput struct {
+	Token             string `form:"token" json:"token"`
+	PasswordPlaintext string `form:"password" json:"password"`
+
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (i *UserPasswordResetInput) Validate() {
+	i.CheckField(validator.NotBlank(i.Token), "token", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Token, 100), "token", "this field must be at most 100 characters")
+	i.CheckField(validator.NotBlank(i.PasswordPlaintext), "password", "this field cannot be blank")
+	i.CheckField(validator.MinChars(i.PasswordPlaintext, 8), "password", "this field must be at least 8 characters")
+	i.CheckField(validator.MaxChars(i.PasswordPlaintext, 30), "password", "this field must be at most 30 characters")
+	i.CheckField(validator.MaxBytes(i.PasswordPlaintext, 72), "password", "this field must be at most 72 bytes")
+}
+
+func (i *UserPasswordResetInput) ToParams() ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(i.PasswordPlaintext), 12)
+}
+
+// data for the password reset email
+type PasswordResetEmailData struct {
+	Name      string
+	ResetURL  string
+	ExpiresAt time.Time
+}
+
+// passed from handler to service
+type UserEmailConfirmInput struct {
+	Token string `form:"token"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *UserEmailConfirmInput) Validate() {
+	i.CheckField(validator.NotBlank(i.Token), "token", "this field cannot be blank")
+	i.CheckField(validator.MaxChars(i.Token, 100), "token", "this field must be at most 100 characters")
+}
+
+// data for the email change confirmation email
+type EmailChangeEmailData struct {
+	Name       string
+	Email      string
+	ConfirmURL string
+	ExpiresAt  time.Time
+}
@@ -0,0 +1,275 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/validator"
+)
+
+// catalog events webhooks can subscribe to
+const (
+	WebhookBeanCreated    = "bean.created"
+	WebhookBeanUpdated    = "bean.updated"
+	WebhookBeanDeleted    = "bean.deleted"
+	WebhookRoasterCreated = "roaster.created"
+	WebhookRoasterUpdated = "roaster.updated"
+	WebhookRoasterDeleted = "roaster.deleted"
+)
+
+var webhookEvents = []string{
+	WebhookBeanCreated,
+	WebhookBeanUpdated,
+	WebhookBeanDeleted,
+	WebhookRoasterCreated,
+	WebhookRoasterUpdated,
+	WebhookRoasterDeleted,
+}
+
+// prefix of generated signing secrets
+const webhookSecretPrefix = "whsec_"
+
+// passed from handler to service
+type WebhookCreateInput struct {
+	URL    string   `form:"url"`
+	Events []string `form:"events"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *WebhookCreateInput) Validate() {
+	validateWebhook(&i.Validator, i.URL, i.Events)
+}
+
+func (i *WebhookCreateInput) ToParams() (*WebhookCreateParams, error) {
+	secret, _, err := generateToken(webhookSecretPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookCreateParams{
+		URL:    i.URL,
+		Events: normalizeWebhookEvents(i.Events),
+		Secret: secret,
+	}, nil
+}
+
+// HasEvent reports whether the event is picked, for re-rendering the form
+func (i *WebhookCreateInput) HasEvent(event string) bool {
+	return slices.Contains(i.Events, event)
+}
+
+// EventOptions lists the events offered by the form
+func (i *WebhookCreateInput) EventOptions() []string {
+	return webhookEvents
+}
+
+// passed from service to repository
+type WebhookCreateParams struct {
+	URL    string
+	Events []string
+	Secret string
+}
+
+// passed from handler to service
+type WebhookEditInput struct {
+	ID     int64    `form:"-"` // parsed from URL param
+	URL    string   `form:"url"`
+	Events []string `form:"events"`
+	Active bool     `form:"active"`
+
+	validator.Validator `form:"-"`
+}
+
+func (i *WebhookEditInput) Validate() {
+	i.CheckField(i.ID > 0, "id", "this field must be greater than 0")
+	validateWebhook(&i.Validator, i.URL, i.Events)
+}
+
+func (i *WebhookEditInput) ToParams() *WebhookEditParams {
+	return &WebhookEditParams{
+		ID:     i.ID,
+		URL:    i.URL,
+		Events: normalizeWebhookEvents(i.Events),
+		Active: i.Active,
+	}
+}
+
+// HasEvent reports whether the event is picked, for re-rendering the form
+func (i *WebhookEditInput) HasEvent(event string) bool {
+	return slices.Contains(i.Events, event)
+}
+
+// EventOptions lists the events offered by the form
+func (i *WebhookEditInput) EventOptions() []string {
+	return webhookEvents
+}
+
+// passed from service to repository
+type WebhookEditParams struct {
+	ID     int64
+	URL    string
+	Events []string
+	Active bool
+}
+
+// returned from repository to service
+type WebhookDB struct {
+	ID        int64
+	URL       string
+	Events    []string
+	Secret    string
+	Active    bool
+	CreatedAt time.Time
+	Version   int
+}
+
+func (m *WebhookDB) ToResponse() *WebhookResponse {
+	return &WebhookResponse{
+		ID:        m.ID,
+		URL:       m.URL,
+		Events:    m.Events,
+		Secret:    m.Secret,
+		Active:    m.Active,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// returned from service to handler
+type WebhookResponse struct {
+	ID        int64
+	URL       string
+	Events    []string
+	Secret    string
+	Active    bool
+	CreatedAt time.Time
+}
+
+func (r *WebhookResponse) ToEditInput() *WebhookEditInput {
+	return &WebhookEditInput{
+		ID:     r.ID,
+		URL:    r.URL,
+		Events: r.Events,
+		Active: r.Active,
+	}
+}
+
+func validateWebhook(v *validator.Validator, url string, events []string) {
+	v.CheckField(validator.NotBlank(url), "url", "this field cannot be blank")
+	v.CheckField(validator.MaxChars(url, 500), "url", "this field must be at most 500 characters")
+	v.CheckField(validator.IsURL(url), "url", "this field must be a valid URL")
+	v.CheckField(len(events) > 0, "events", "pick at least one event")
+	for _, e := range events {
+		v.CheckField(validator.PermittedValue(e, webhookEvents...), "events", fmt.Sprintf("events must be in %v", webhookEvents))
+	}
+}
+
+func normalizeWebhookEvents(events []string) []string {
+	events = slices.Clone(events)
+	slices.Sort(events)
+	return slices.Compact(events)
+}
+
+// delivery states
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryDelivering = "delivering"
+	WebhookDeliverySucceeded  = "succeeded"
+	WebhookDeliveryFailed     = "failed"
+)
+
+// deliveries are given up after this many attempts
+const WebhookMaxAttempts = 10
+
+// WebhookRetryDelay is the exponential backoff before the next attempt after a
+// number of failed attempts: 30s, 1m, 2m, ... capped at 12h
+func WebhookRetryDelay(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for n := 1; n < attempts; n++ {
+		delay *= 2
+		if delay >= 12*time.Hour {
+			return 12 * time.Hour
+		}
+	}
+	return delay
+}
+
+// body posted to subscribers
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// claimed delivery, with what's needed to send it
+type WebhookDeliveryJob struct {
+	ID        int64
+	WebhookID int64
+	Event     string
+	Payload   []byte
+	Attempts  int
+	URL       string
+	Secret    string
+}
+
+// passed from service to repository after an attempt
+type WebhookDeliveryResultParams struct {
+	ID             int64
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode *int
+	LastError      string
+}
+
+// returned from repository to service
+type WebhookDeliveryDB struct {
+	ID             int64
+	WebhookID      int64
+	Event          string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode *int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+func (m *WebhookDeliveryDB) ToResponse() *WebhookDeliveryResponse {
+	return &WebhookDeliveryResponse{
+		ID:             m.ID,
+		WebhookID:      m.WebhookID,
+		Event:          m.Event,
+		Payload:        string(m.Payload),
+		Status:         m.Status,
+		Attempts:       m.Attempts,
+		NextAttemptAt:  m.NextAttemptAt,
+		LastStatusCode: m.LastStatusCode,
+		LastError:      m.LastError,
+		CreatedAt:      m.CreatedAt,
+		DeliveredAt:    m.DeliveredAt,
+	}
+}
+
+// returned from service to handler
+type WebhookDeliveryResponse struct {
+	ID             int64
+	WebhookID      int64
+	Event          string
+	Payload        string
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode *int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// Retrying reports whether another attempt is scheduled
+func (r *WebhookDeliveryResponse) Retrying() bool {
+	return r.Status == WebhookDeliveryPending && r.Attempts > 0
+}
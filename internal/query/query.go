@@ -0,0 +1,230 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// a single search condition, e.g. `roaster:"Sey"` or `-decaf`
+type Term struct {
+	Field   string // empty for free text
+	Value   string
+	Negated bool
+}
+
+// terms joined by OR; the group matches if any of its terms match
+type Group []Term
+
+// groups joined by AND; the query matches if every group matches
+type Query struct {
+	Groups []Group
+}
+
+func (q Query) IsEmpty() bool {
+	return len(q.Groups) == 0
+}
+
+// parse error with the byte offset in the input where it was detected
+type Error struct {
+	Pos     int
+	Message string
+	Field   string // the qualifier, when it was an unknown one
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Message, e.Pos+1)
+}
+
+func errorf(pos int, format string, args ...any) *Error {
+	return &Error{
+		Pos:     pos,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Parse turns a search string like `roast:light roaster:"Sey" -decaf` into a
+// Query. Words are ANDed together, `OR` between two terms puts them in the same
+// group, a leading `-` negates a term and double quotes keep a phrase together.
+// Qualifiers other than the given fields are reported as errors.
+func Parse(s string, fields ...string) (Query, error) {
+	p := &parser{
+		input:  s,
+		fields: fields,
+	}
+	return p.parse()
+}
+
+type token struct {
+	term Term
+	or   bool // bare OR operator
+	pos  int
+}
+
+type parser struct {
+	input  string
+	fields []string
+	pos    int
+}
+
+func (p *parser) parse() (Query, error) {
+	var q Query
+
+	// set when the previous token was an OR, so the next term joins the last group
+	pendingOr := -1
+
+	for {
+		tok, ok, err := p.next()
+		if err != nil {
+			return Query{}, err
+		}
+		if !ok {
+			break
+		}
+
+		if tok.or {
+			if len(q.Groups) == 0 || pendingOr >= 0 {
+				return Query{}, errorf(tok.pos, "OR must be placed between two terms")
+			}
+			pendingOr = tok.pos
+			continue
+		}
+
+		if pendingOr >= 0 {
+			last := len(q.Groups) - 1
+			q.Groups[last] = append(q.Groups[last], tok.term)
+			pendingOr = -1
+		} else {
+			q.Groups = append(q.Groups, Group{tok.term})
+		}
+	}
+
+	if pendingOr >= 0 {
+		return Query{}, errorf(pendingOr, "OR must be placed between two terms")
+	}
+
+	return q, nil
+}
+
+// next reads the following token; ok is false at the end of the input
+func (p *parser) next() (token, bool, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return token{}, false, nil
+	}
+
+	start := p.pos
+	tok := token{pos: start}
+
+	if p.input[p.pos] == '-' {
+		tok.term.Negated = true
+		p.pos++
+	}
+
+	// quoted free text phrase
+	if p.peek() == '"' {
+		value, err := p.quoted()
+		if err != nil {
+			return token{}, false, err
+		}
+		if value == "" {
+			return token{}, false, errorf(start, "empty phrase")
+		}
+		tok.term.Value = value
+		return tok, true, nil
+	}
+
+	word := p.word()
+
+	// bare OR operator; a quoted "OR" is searched for as text instead
+	if word == "OR" && !tok.term.Negated {
+		tok.or = true
+		return tok, true, nil
+	}
+
+	field, value, qualified := strings.Cut(word, ":")
+	if !qualified {
+		if word == "" {
+			return token{}, false, errorf(start, "expected a term after -")
+		}
+		tok.term.Value = word
+		return tok, true, nil
+	}
+
+	field = strings.ToLower(field)
+	if !slices.Contains(p.fields, field) {
+		err := errorf(start, "unknown qualifier %q; expected one of %v", field, p.fields)
+		err.Field = field
+		return token{}, false, err
+	}
+	tok.term.Field = field
+
+	// qualifier followed by a quoted phrase, e.g. roaster:"Sey Coffee"
+	if value == "" && p.peek() == '"' {
+		var err error
+		value, err = p.quoted()
+		if err != nil {
+			return token{}, false, err
+		}
+	}
+	if value == "" {
+		return token{}, false, errorf(start, "missing value for qualifier %q", field)
+	}
+	tok.term.Value = value
+
+	return tok, true, nil
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) {
+		r, size := p.rune()
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+// word reads up to the next whitespace or quote
+func (p *parser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		r, size := p.rune()
+		if unicode.IsSpace(r) || r == '"' {
+			break
+		}
+		p.pos += size
+	}
+	return p.input[start:p.pos]
+}
+
+// rune decodes the character at the current position; continuation bytes of
+// multibyte characters must not be mistaken for whitespace on their own
+func (p *parser) rune() (rune, int) {
+	return utf8.DecodeRuneInString(p.input[p.pos:])
+}
+
+// quoted reads a double quoted phrase, starting at the opening quote
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+	p.pos++ // opening quote
+
+	end := strings.IndexByte(p.input[p.pos:], '"')
+	if end < 0 {
+		return "", errorf(start, "unterminated quote")
+	}
+
+	value := p.input[p.pos : p.pos+end]
+	p.pos += end + 1 // closing quote
+
+	return strings.TrimSpace(value), nil
+}
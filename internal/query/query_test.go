@@ -0,0 +1,186 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testFields = []string{"name", "roast", "roaster"}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Query
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  Query{},
+		},
+		{
+			name:  "only whitespace",
+			input: "  \t ",
+			want:  Query{},
+		},
+		{
+			name:  "free text",
+			input: "geisha",
+			want:  Query{Groups: []Group{{{Value: "geisha"}}}},
+		},
+		{
+			name:  "words are anded",
+			input: "washed geisha",
+			want:  Query{Groups: []Group{{{Value: "washed"}}, {{Value: "geisha"}}}},
+		},
+		{
+			name:  "qualifier",
+			input: "roast:light",
+			want:  Query{Groups: []Group{{{Field: "roast", Value: "light"}}}},
+		},
+		{
+			name:  "qualifier is case insensitive",
+			input: "ROAST:Light",
+			want:  Query{Groups: []Group{{{Field: "roast", Value: "Light"}}}},
+		},
+		{
+			name:  "quoted qualifier value",
+			input: `roaster:"Sey Coffee"`,
+			want:  Query{Groups: []Group{{{Field: "roaster", Value: "Sey Coffee"}}}},
+		},
+		{
+			name:  "quoted phrase",
+			input: `"natural process"`,
+			want:  Query{Groups: []Group{{{Value: "natural process"}}}},
+		},
+		{
+			name:  "quoted phrase is trimmed",
+			input: `" natural "`,
+			want:  Query{Groups: []Group{{{Value: "natural"}}}},
+		},
+		{
+			name:  "negated term",
+			input: "-decaf",
+			want:  Query{Groups: []Group{{{Value: "decaf", Negated: true}}}},
+		},
+		{
+			name:  "negated qualifier",
+			input: `-roaster:"acme"`,
+			want:  Query{Groups: []Group{{{Field: "roaster", Value: "acme", Negated: true}}}},
+		},
+		{
+			name:  "negated phrase",
+			input: `-"cold brew"`,
+			want:  Query{Groups: []Group{{{Value: "cold brew", Negated: true}}}},
+		},
+		{
+			name:  "or groups terms",
+			input: "roast:light OR roast:medium",
+			want:  Query{Groups: []Group{{{Field: "roast", Value: "light"}, {Field: "roast", Value: "medium"}}}},
+		},
+		{
+			name:  "or chains",
+			input: "a OR b OR c d",
+			want:  Query{Groups: []Group{{{Value: "a"}, {Value: "b"}, {Value: "c"}}, {{Value: "d"}}}},
+		},
+		{
+			name:  "lowercase or is text",
+			input: "a or b",
+			want:  Query{Groups: []Group{{{Value: "a"}}, {{Value: "or"}}, {{Value: "b"}}}},
+		},
+		{
+			name:  "quoted or is text",
+			input: `a "OR" b`,
+			want:  Query{Groups: []Group{{{Value: "a"}}, {{Value: "OR"}}, {{Value: "b"}}}},
+		},
+		{
+			name:  "negated or is text",
+			input: "a -OR",
+			want:  Query{Groups: []Group{{{Value: "a"}}, {{Value: "OR", Negated: true}}}},
+		},
+		{
+			name:  "non-ascii words",
+			input: "roaster:Hà café Åland",
+			want: Query{Groups: []Group{
+				{{Field: "roaster", Value: "Hà"}},
+				{{Value: "café"}},
+				{{Value: "Åland"}},
+			}},
+		},
+		{
+			// U+00A0 and U+0085 end in the bytes 0xa0 and 0x85, which are
+			// spaces only as whole characters
+			name:  "non-ascii whitespace",
+			input: "Hà\u00a0Ŕ\u0085ЅЀ\u3000東京",
+			want:  Query{Groups: []Group{{{Value: "Hà"}}, {{Value: "Ŕ"}}, {{Value: "ЅЀ"}}, {{Value: "東京"}}}},
+		},
+		{
+			name:  "non-ascii quoted value",
+			input: `roaster:"Café Ñandú" -décaf`,
+			want: Query{Groups: []Group{
+				{{Field: "roaster", Value: "Café Ñandú"}},
+				{{Value: "décaf", Negated: true}},
+			}},
+		},
+		{
+			name:  "mixed",
+			input: `roast:light roaster:"Sey" -decaf`,
+			want: Query{Groups: []Group{
+				{{Field: "roast", Value: "light"}},
+				{{Field: "roaster", Value: "Sey"}},
+				{{Value: "decaf", Negated: true}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input, testFields...)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v; want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		pos   int
+		field string // unknown qualifier
+	}{
+		{name: "unknown qualifier", input: "geisha origin:ethiopia", pos: 7, field: "origin"},
+		{name: "missing qualifier value", input: "roast:", pos: 0},
+		{name: "missing quoted qualifier value", input: `roaster:""`, pos: 0},
+		{name: "unterminated quote", input: `a "natural`, pos: 2},
+		{name: "unterminated qualifier quote", input: `roaster:"Sey`, pos: 8},
+		{name: "empty phrase", input: `""`, pos: 0},
+		{name: "lone dash", input: "a - b", pos: 2},
+		{name: "leading or", input: "OR a", pos: 0},
+		{name: "trailing or", input: "a OR", pos: 2},
+		{name: "double or", input: "a OR OR b", pos: 5},
+		{name: "unknown qualifier after non-ascii", input: "café Åland:x", pos: 6, field: "åland"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input, testFields...)
+
+			var perr *Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse(%q) error = %v; want a *Error", tt.input, err)
+			}
+			if perr.Pos != tt.pos {
+				t.Errorf("Parse(%q) error at %d (%v); want at %d", tt.input, perr.Pos, perr, tt.pos)
+			}
+			if tt.field != perr.Field {
+				t.Errorf("Parse(%q) error field %q; want %q", tt.input, perr.Field, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type SearchAnalyticsService struct {
+	db *sql.DB
+
+	// key of the searcher hashes; only ever in memory, and replaced once it's
+	// older than the events it hashed are kept, so hashes of ips and user
+	// agents can't be matched against guesses after the fact
+	mu        sync.Mutex
+	secret    []byte
+	secretSet time.Time
+}
+
+func NewSearchAnalyticsService(db *sql.DB) *SearchAnalyticsService {
+	return &SearchAnalyticsService{
+		db: db,
+	}
+}
+
+func (serv *SearchAnalyticsService) Report(ctx context.Context, i *model.SearchAnalyticsInput) (*model.SearchAnalyticsResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for search analytics: %q", i.FieldErrors)
+	}
+
+	sap := i.ToParams()
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	top, err := dba.GetTopSearchTerms(ctx, tx, sap)
+	if err != nil {
+		return nil, fmt.Errorf("analytics dba - top terms: %w", err)
+	}
+
+	zero, err := dba.GetZeroResultSearchTerms(ctx, tx, sap)
+	if err != nil {
+		return nil, fmt.Errorf("analytics dba - zero result terms: %w", err)
+	}
+
+	trend, err := dba.GetSearchTrend(ctx, tx, sap)
+	if err != nil {
+		return nil, fmt.Errorf("analytics dba - trend: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	sar := &model.SearchAnalyticsResponse{
+		Days:        i.Days,
+		TopTerms:    []*model.SearchTermStatResponse{},
+		ZeroResults: []*model.SearchTermStatResponse{},
+		Trend:       []*model.SearchDayStatResponse{},
+	}
+	for _, s := range top {
+		sar.TopTerms = append(sar.TopTerms, s.ToResponse())
+	}
+	for _, s := range zero {
+		sar.ZeroResults = append(sar.ZeroResults, s.ToResponse())
+	}
+	for _, s := range trend {
+		sar.Trend = append(sar.Trend, s.ToResponse())
+		sar.MaxDaily = max(sar.MaxDaily, s.Searches)
+	}
+
+	return sar, nil
+}
+
+// Prune deletes raw search events older than the retention period, and
+// rotates the searcher hash key with it
+func (serv *SearchAnalyticsService) Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	serv.mu.Lock()
+	if time.Since(serv.secretSet) >= retention {
+		serv.secret = nil
+	}
+	serv.mu.Unlock()
+
+	n, err := dba.PruneSearchEvents(ctx, serv.db, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("analytics dba - prune: %w", err)
+	}
+	return n, nil
+}
+
+// Record logs a search term and its result count. Only a keyed hash of the
+// searcher key is stored, enough to count unique searchers
+func (serv *SearchAnalyticsService) Record(ctx context.Context, kind string, term string, searcherKey string, results int) error {
+	term = strings.ToLower(strings.Join(strings.Fields(term), " "))
+	if term == "" {
+		return nil
+	}
+
+	hash, err := serv.searcherHash(searcherKey)
+	if err != nil {
+		return fmt.Errorf("analytics - searcher hash: %w", err)
+	}
+
+	// interact with db
+
+	err = dba.RecordSearch(ctx, serv.db, &model.SearchEventParams{
+		Kind:        kind,
+		Term:        term,
+		Results:     results,
+		SessionHash: hash,
+	})
+	if err != nil {
+		return fmt.Errorf("analytics dba - record search: %w", err)
+	}
+
+	return nil
+}
+
+// searcherHash is the HMAC of the searcher key under the current key, which is
+// made on first use after a restart or rotation. Searchers seen on both sides
+// of a new key count twice that day
+func (serv *SearchAnalyticsService) searcherHash(searcherKey string) (string, error) {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+
+	if serv.secret == nil {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return "", err
+		}
+		serv.secret = secret
+		serv.secretSet = time.Now()
+	}
+
+	mac := hmac.New(sha256.New, serv.secret)
+	mac.Write([]byte(searcherKey))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type APITokenService struct {
+	db *sql.DB
+}
+
+func NewAPITokenService(db *sql.DB) *APITokenService {
+	return &APITokenService{
+		db: db,
+	}
+}
+
+// Create returns the new token with its plaintext, which can't be read again later
+func (serv *APITokenService) Create(ctx context.Context, i *model.APITokenCreateInput) (*model.APITokenResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for api token create: %q", i.FieldErrors)
+	}
+
+	tcp, err := i.ToParams()
+	if err != nil {
+		return nil, fmt.Errorf("api token - generate: %w", err)
+	}
+
+	// interact with db
+
+	tdb, err := dba.CreateAPIToken(ctx, serv.db, tcp)
+	if err != nil {
+		return nil, fmt.Errorf("api token dba - create: %w", err)
+	}
+
+	// convert to response
+
+	tr := tdb.ToResponse()
+	tr.Plaintext = tcp.Plaintext
+
+	return tr, nil
+}
+
+func (serv *APITokenService) ListForUser(ctx context.Context, userID int64) ([]*model.APITokenResponse, error) {
+	// interact with db
+
+	tdbs, err := dba.GetAPITokensForUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("api token dba - list: %w", err)
+	}
+
+	// convert to response
+
+	trs := []*model.APITokenResponse{}
+	for _, tdb := range tdbs {
+		trs = append(trs, tdb.ToResponse())
+	}
+
+	return trs, nil
+}
+
+func (serv *APITokenService) Revoke(ctx context.Context, id int64, userID int64) error {
+	// interact with db
+
+	err := dba.DeleteAPIToken(ctx, serv.db, id, userID)
+	if err != nil {
+		return fmt.Errorf("api token dba - delete: %w", err)
+	}
+
+	return nil
+}
+
+// Authenticate resolves a plaintext bearer token to its owner and scopes and
+// records the use
+func (serv *APITokenService) Authenticate(ctx context.Context, plaintext string) (*model.APITokenAuthResponse, error) {
+	// interact with db
+
+	tdb, err := dba.GetAPITokenByHash(ctx, serv.db, model.HashToken(plaintext))
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			return nil, errs.Errorf(errs.ERRNOTAUTHORIZED, "invalid or expired api token")
+		}
+		return nil, fmt.Errorf("api token dba - get by hash: %w", err)
+	}
+
+	user, err := dba.GetUser(ctx, serv.db, tdb.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - get: %w", err)
+	}
+
+	// tokens stop working while the owner can't sign in
+	if !user.Activated || user.DeletionScheduledAt != nil {
+		return nil, errs.Errorf(errs.ERRNOTAUTHORIZED, "api token owner is inactive or pending deletion")
+	}
+
+	err = dba.TouchAPIToken(ctx, serv.db, tdb.ID)
+	if err != nil {
+		return nil, fmt.Errorf("api token dba - touch: %w", err)
+	}
+
+	// convert to response
+
+	// non-nil even when empty, so the token can never pass for a session
+	scopes := tdb.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &model.APITokenAuthResponse{
+		TokenID: tdb.ID,
+		User:    user.ToResponse(),
+		Scopes:  scopes,
+	}, nil
+}
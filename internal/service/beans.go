@@ -11,12 +11,14 @@ import (
 )
 
 type BeanService struct {
-	db *sql.DB
+	db              *sql.DB
+	recommendations *RecommendationService
 }
 
-func NewBeanService(db *sql.DB) *BeanService {
+func NewBeanService(db *sql.DB, recommendations *RecommendationService) *BeanService {
 	return &BeanService{
-		db: db,
+		db:              db,
+		recommendations: recommendations,
 	}
 }
 
@@ -33,20 +35,38 @@ func (serv *BeanService) Create(ctx context.Context, i *model.BeanCreateInput) (
 
 	// interact with db
 
-	bdb, err := dba.CreateBean(ctx, serv.db, bcp)
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	bdb, err := dba.CreateBean(ctx, tx, bcp)
 	if err != nil {
 		// TODO: think about how this can be improved
 		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
-			i.FieldErrors["roaster_id"] = "this ID doesn't exist or is invalid"
+			i.AddFieldError("roaster_id", "this roaster doesn't exist")
 			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed")
 		}
 		return nil, fmt.Errorf("bean repository - create: %w", err)
 	}
 
-	// convert to response
-
 	br := bdb.ToResponse()
 
+	err = enqueueWebhookEvent(ctx, tx, model.WebhookBeanCreated, br)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	serv.recommendations.Recompute(ctx, br.ID)
+
+	// convert to response
+
 	return br, nil
 }
 
@@ -124,13 +144,79 @@ func (serv *BeanService) Find(ctx context.Context, i *model.BeanFilterInput) ([]
 	return brs, nil
 }
 
+// Feed returns the newest beans matching the feed input
+func (serv *BeanService) Feed(ctx context.Context, i *model.BeanFeedInput) ([]*model.BeanResponse, error) {
+	// validate
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for bean feed: %q, %q", i.FieldErrors, i.NonFieldErrors)
+	}
+
+	bfp := i.ToParams()
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	bdbs, err := dba.FindNewBeans(ctx, tx, bfp)
+	if err != nil {
+		return nil, fmt.Errorf("bean dba - feed: %w", err)
+	}
+
+	err = dba.AttachManyBeanAssociations(ctx, tx, bdbs)
+	if err != nil {
+		return nil, fmt.Errorf("bean dba - feed: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	brs := []*model.BeanResponse{}
+	for _, bdb := range bdbs {
+		brs = append(brs, bdb.ToResponse())
+	}
+
+	return brs, nil
+}
+
+// Export streams the beans matching the filter to fn; validation errors are
+// returned before the first row
+func (serv *BeanService) Export(ctx context.Context, i *model.BeanFilterInput, fn func(*model.BeanExportRow) error) error {
+	// validate
+	i.Validate()
+
+	if !i.Valid() {
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for bean export: %q, %q", i.FieldErrors, i.NonFieldErrors)
+	}
+
+	bfp := i.ToParams()
+
+	// interact with db
+
+	err := dba.ExportBeans(ctx, serv.db, bfp, fn)
+	if err != nil {
+		return fmt.Errorf("bean dba - export: %w", err)
+	}
+
+	return nil
+}
+
 func (serv *BeanService) Update(ctx context.Context, i *model.BeanEditInput) (*model.BeanResponse, error) {
 	// validate
 
 	i.Validate()
 
 	if !i.Valid() {
-		return nil, errs.Errorf(errs.ERRBAD, "input validation failed for bean update")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for bean update")
 	}
 
 	bep := i.ToParams()
@@ -145,6 +231,10 @@ func (serv *BeanService) Update(ctx context.Context, i *model.BeanEditInput) (*m
 
 	bdb, err := dba.UpdateBean(ctx, tx, bep)
 	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRUNPROCESSABLE {
+			i.AddFieldError("roaster_id", "this roaster doesn't exist")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed")
+		}
 		return nil, fmt.Errorf("bean repository - update: %w", err)
 	}
 
@@ -153,14 +243,21 @@ func (serv *BeanService) Update(ctx context.Context, i *model.BeanEditInput) (*m
 		return nil, fmt.Errorf("bean repository - update: %w", err)
 	}
 
+	br := bdb.ToResponse()
+
+	err = enqueueWebhookEvent(ctx, tx, model.WebhookBeanUpdated, br)
+	if err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
 
-	// convert to response
+	serv.recommendations.Recompute(ctx, br.ID)
 
-	br := bdb.ToResponse()
+	// convert to response
 
 	return br, nil
 }
@@ -168,10 +265,21 @@ func (serv *BeanService) Update(ctx context.Context, i *model.BeanEditInput) (*m
 func (serv *BeanService) Delete(ctx context.Context, id int64) error {
 	// interact with db
 
-	err := dba.DeleteBean(ctx, serv.db, id)
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = dba.DeleteBean(ctx, tx, id)
 	if err != nil {
 		return fmt.Errorf("bean repository - delete: %w", err)
 	}
 
-	return nil
+	err = enqueueWebhookEvent(ctx, tx, model.WebhookBeanDeleted, map[string]int64{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type ImportService struct {
+	db              *sql.DB
+	recommendations *RecommendationService
+}
+
+func NewImportService(db *sql.DB, recommendations *RecommendationService) *ImportService {
+	return &ImportService{
+		db:              db,
+		recommendations: recommendations,
+	}
+}
+
+// Beans validates every row of a bean import file and, unless dryRun, creates or
+// updates all of them in a single transaction. Rows are matched to earlier
+// imports by external ref, so importing the same file twice changes nothing.
+func (serv *ImportService) Beans(ctx context.Context, i *model.ImportInput, dryRun bool) (*model.ImportResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for bean import: %q", i.FieldErrors)
+	}
+
+	rows, err := model.ParseBeanImport(i.Format, i.Data)
+	if err != nil {
+		i.AddFieldError("data", err.Error())
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for bean import: %q", i.FieldErrors)
+	}
+	if len(rows) == 0 {
+		i.AddFieldError("data", "the file has no rows")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for bean import: %q", i.FieldErrors)
+	}
+	i.BeanRows = rows
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = serv.resolveBeanRows(ctx, tx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	for _, row := range rows {
+		refs = append(refs, row.ExternalRef)
+	}
+	existing, err := dba.GetExistingExternalRefs(ctx, tx, "beans", refs)
+	if err != nil {
+		return nil, fmt.Errorf("import dba - bean refs: %w", err)
+	}
+
+	resp := &model.ImportResponse{DryRun: dryRun}
+	seen := map[string]int{}
+	invalid := 0
+	for _, row := range rows {
+		model.ValidateImportRef(&row.Input.Validator, row.ExternalRef, seen, row.Line)
+		row.Input.Validate()
+		if !row.Input.Valid() {
+			invalid++
+			continue
+		}
+
+		row.Action = model.ImportActionCreate
+		if existing[row.ExternalRef] {
+			row.Action = model.ImportActionUpdate
+		}
+	}
+	if invalid > 0 {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "bean import: %d of %d rows failed validation", invalid, len(rows))
+	}
+
+	// dry runs write too and roll back, so they report exactly what would change
+	changed := []int64{}
+	for _, row := range rows {
+		bdb, action, err := dba.UpsertBean(ctx, tx, &model.BeanImportParams{
+			ExternalRef:      row.ExternalRef,
+			BeanCreateParams: row.Input.ToParams(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("import dba - upsert bean at %d: %w", row.Line, err)
+		}
+
+		row.Action = action
+		countImportAction(resp, row.Action)
+
+		event := model.WebhookBeanUpdated
+		switch action {
+		case model.ImportActionUnchanged:
+			continue
+		case model.ImportActionCreate:
+			event = model.WebhookBeanCreated
+		}
+		changed = append(changed, bdb.ID)
+
+		err = enqueueWebhookEvent(ctx, tx, event, bdb.ToResponse())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !dryRun {
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		serv.recommendations.Recompute(ctx, changed...)
+	}
+
+	// convert to response
+
+	return resp, nil
+}
+
+// resolve roaster names to ids and check given ids, adding field errors to rows
+// whose roaster can't be found
+func (serv *ImportService) resolveBeanRows(ctx context.Context, dbtx dba.DBTX, rows []*model.BeanImportRow) error {
+	names := []string{}
+	ids := []int64{}
+	for _, row := range rows {
+		switch {
+		case row.Input.RoasterID > 0:
+			ids = append(ids, row.Input.RoasterID)
+		case row.RoasterName != "":
+			names = append(names, row.RoasterName)
+		}
+	}
+
+	byName, err := dba.GetRoasterIDsByName(ctx, dbtx, names)
+	if err != nil {
+		return fmt.Errorf("import dba - roasters by name: %w", err)
+	}
+	existing, err := dba.GetExistingRoasterIDs(ctx, dbtx, ids)
+	if err != nil {
+		return fmt.Errorf("import dba - roaster ids: %w", err)
+	}
+
+	for _, row := range rows {
+		v := &row.Input.Validator
+		switch {
+		case row.Input.RoasterID > 0:
+			v.CheckField(existing[row.Input.RoasterID], "roaster_id", "this roaster doesn't exist")
+		case row.RoasterName != "":
+			matches := byName[strings.ToLower(row.RoasterName)]
+			switch len(matches) {
+			case 0:
+				v.AddFieldError("roaster_id", fmt.Sprintf("no roaster is named %q", row.RoasterName))
+			case 1:
+				row.Input.RoasterID = matches[0]
+			default:
+				v.AddFieldError("roaster_id", fmt.Sprintf("%d roasters are named %q; use roaster_id instead", len(matches), row.RoasterName))
+			}
+		default:
+			v.AddFieldError("roaster_id", "set either roaster or roaster_id")
+		}
+	}
+
+	return nil
+}
+
+// Roasters validates every row of a roaster import file and, unless dryRun,
+// creates or updates all of them in a single transaction
+func (serv *ImportService) Roasters(ctx context.Context, i *model.ImportInput, dryRun bool) (*model.ImportResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for roaster import: %q", i.FieldErrors)
+	}
+
+	rows, err := model.ParseRoasterImport(i.Format, i.Data)
+	if err != nil {
+		i.AddFieldError("data", err.Error())
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for roaster import: %q", i.FieldErrors)
+	}
+	if len(rows) == 0 {
+		i.AddFieldError("data", "the file has no rows")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for roaster import: %q", i.FieldErrors)
+	}
+	i.RoasterRows = rows
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refs := []string{}
+	for _, row := range rows {
+		refs = append(refs, row.ExternalRef)
+	}
+	existing, err := dba.GetExistingExternalRefs(ctx, tx, "roasters", refs)
+	if err != nil {
+		return nil, fmt.Errorf("import dba - roaster refs: %w", err)
+	}
+
+	resp := &model.ImportResponse{DryRun: dryRun}
+	seen := map[string]int{}
+	invalid := 0
+	for _, row := range rows {
+		model.ValidateImportRef(&row.Input.Validator, row.ExternalRef, seen, row.Line)
+		row.Input.Validate()
+		if !row.Input.Valid() {
+			invalid++
+			continue
+		}
+
+		row.Action = model.ImportActionCreate
+		if existing[row.ExternalRef] {
+			row.Action = model.ImportActionUpdate
+		}
+	}
+	if invalid > 0 {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "roaster import: %d of %d rows failed validation", invalid, len(rows))
+	}
+
+	// dry runs write too and roll back, so they report exactly what would change
+	for _, row := range rows {
+		rdb, action, err := dba.UpsertRoaster(ctx, tx, &model.RoasterImportParams{
+			ExternalRef:         row.ExternalRef,
+			RoasterCreateParams: row.Input.ToParams(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("import dba - upsert roaster at %d: %w", row.Line, err)
+		}
+
+		row.Action = action
+		countImportAction(resp, row.Action)
+
+		event := model.WebhookRoasterUpdated
+		switch action {
+		case model.ImportActionUnchanged:
+			continue
+		case model.ImportActionCreate:
+			event = model.WebhookRoasterCreated
+		}
+
+		err = enqueueWebhookEvent(ctx, tx, event, rdb.ToResponse())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !dryRun {
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// convert to response
+
+	return resp, nil
+}
+
+func countImportAction(resp *model.ImportResponse, action string) {
+	switch action {
+	case model.ImportActionCreate:
+		resp.Created++
+	case model.ImportActionUpdate:
+		resp.Updated++
+	case model.ImportActionUnchanged:
+		resp.Unchanged++
+	}
+}
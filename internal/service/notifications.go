@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// how many of the latest notifications are shown to a user
+const notificationListLimit = 20
+
+type NotificationService struct {
+	db *sql.DB
+}
+
+func NewNotificationService(db *sql.DB) *NotificationService {
+	return &NotificationService{
+		db: db,
+	}
+}
+
+func (serv *NotificationService) ListForUser(ctx context.Context, userID int64) ([]*model.NotificationResponse, error) {
+	// interact with db
+
+	ndbs, err := dba.GetNotificationsForUser(ctx, serv.db, userID, notificationListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("notification dba - list: %w", err)
+	}
+
+	// convert to response
+
+	nrs := []*model.NotificationResponse{}
+	for _, ndb := range ndbs {
+		nrs = append(nrs, ndb.ToResponse())
+	}
+
+	return nrs, nil
+}
+
+func (serv *NotificationService) MarkRead(ctx context.Context, id int64, userID int64) error {
+	// interact with db
+
+	err := dba.MarkNotificationRead(ctx, serv.db, id, userID)
+	if err != nil {
+		return fmt.Errorf("notification dba - mark read: %w", err)
+	}
+
+	return nil
+}
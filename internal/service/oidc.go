@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type OIDCService struct {
+	db *sql.DB
+}
+
+func NewOIDCService(db *sql.DB) *OIDCService {
+	return &OIDCService{
+		db: db,
+	}
+}
+
+// Login finds the account of an identity provider's user. An identity seen
+// before is linked by its subject; a new one is linked to the activated
+// account with the same verified email, or gets a new account. An unactivated
+// account with the email is replaced, since whoever signed up with it never
+// proved they own it and may be waiting to take over the identity's account
+func (serv *OIDCService) Login(ctx context.Context, i *model.OIDCLoginInput) (*model.OIDCLoginResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for oidc login: %q", i.NonFieldErrors)
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	login, err := serv.linkedUser(ctx, tx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return login, nil
+}
+
+// Reauthenticate checks that a fresh sign-in with an identity provider was
+// with an identity linked to the user's account, so it can stand in for the
+// password when confirming account changes
+func (serv *OIDCService) Reauthenticate(ctx context.Context, i *model.OIDCLoginInput, userID int64) error {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for oidc reauthentication: %q", i.NonFieldErrors)
+	}
+
+	// interact with db
+
+	linkedID, err := dba.GetUserIDByIdentity(ctx, serv.db, i.Provider, i.Subject)
+	if err != nil && errs.ErrorCode(err) != errs.ERRNOTFOUND {
+		return fmt.Errorf("identity dba - get: %w", err)
+	}
+	if err != nil || linkedID != userID {
+		i.AddNonFieldError("the account you signed in with isn't linked to yours")
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for oidc reauthentication: %q", i.NonFieldErrors)
+	}
+
+	err = dba.TouchUserIdentity(ctx, serv.db, i.Provider, i.Subject, i.Email)
+	if err != nil {
+		return fmt.Errorf("identity dba - touch: %w", err)
+	}
+
+	return nil
+}
+
+// LinkedProviders lists the names of the identity providers linked to the user
+func (serv *OIDCService) LinkedProviders(ctx context.Context, userID int64) ([]string, error) {
+	// interact with db
+
+	uids, err := dba.GetUserIdentitiesForUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("identity dba - get for user: %w", err)
+	}
+
+	// convert to response
+
+	providers := []string{}
+	for _, uid := range uids {
+		providers = append(providers, uid.Provider)
+	}
+
+	return providers, nil
+}
+
+// linkedUser returns the identity's account, whether it was just created, and
+// the id of the unactivated account it replaced if any
+func (serv *OIDCService) linkedUser(ctx context.Context, tx *sql.Tx, i *model.OIDCLoginInput) (*model.OIDCLoginResponse, error) {
+	// known identity
+	userID, err := dba.GetUserIDByIdentity(ctx, tx, i.Provider, i.Subject)
+	if err == nil {
+		err = dba.TouchUserIdentity(ctx, tx, i.Provider, i.Subject, i.Email)
+		if err != nil {
+			return nil, fmt.Errorf("identity dba - touch: %w", err)
+		}
+
+		udb, err := dba.GetUser(ctx, tx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("user dba - oidc login: %w", err)
+		}
+		return &model.OIDCLoginResponse{User: udb.ToResponse()}, nil
+	}
+	if errs.ErrorCode(err) != errs.ERRNOTFOUND {
+		return nil, fmt.Errorf("identity dba - get: %w", err)
+	}
+
+	// new identity; only a verified email may claim or create an account
+	if !i.CanLinkByEmail() {
+		i.AddNonFieldError("your identity provider didn't confirm your email address, so you can't be signed in with it")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for oidc login: %q", i.NonFieldErrors)
+	}
+
+	login := &model.OIDCLoginResponse{}
+	udb, err := dba.GetUserByEmail(ctx, tx, i.Email)
+	switch {
+	case err == nil && udb.Activated:
+		// an activated account already proved the email
+
+	case err == nil || errs.ErrorCode(err) == errs.ERRNOTFOUND:
+		// never link to an account someone could have signed up for with
+		// another person's email; its password and sessions go with it
+		if err == nil {
+			err = dba.DeleteUnactivatedUser(ctx, tx, udb.ID)
+			if err != nil {
+				return nil, fmt.Errorf("user dba - delete unactivated: %w", err)
+			}
+			login.ReplacedUserID = udb.ID
+		}
+
+		ucp, err := i.ToUserParams()
+		if err != nil {
+			return nil, err
+		}
+
+		udb, err = dba.CreateUser(ctx, tx, ucp)
+		if err != nil {
+			return nil, fmt.Errorf("user dba - create: %w", err)
+		}
+		login.Created = true
+
+		err = dba.AddRoleForUser(ctx, tx, udb.ID, model.RoleUser)
+		if err != nil {
+			return nil, fmt.Errorf("permission dba - add role: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("user dba - get by email: %w", err)
+	}
+
+	err = dba.CreateUserIdentity(ctx, tx, i.ToIdentityParams(udb.ID))
+	if err != nil {
+		return nil, fmt.Errorf("identity dba - create: %w", err)
+	}
+
+	// convert to response
+
+	login.User = udb.ToResponse()
+
+	return login, nil
+}
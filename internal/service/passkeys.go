@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type PasskeyService struct {
+	db       *sql.DB
+	webauthn *webauthn.WebAuthn
+}
+
+func NewPasskeyService(db *sql.DB, wa *webauthn.WebAuthn) *PasskeyService {
+	return &PasskeyService{
+		db:       db,
+		webauthn: wa,
+	}
+}
+
+func (serv *PasskeyService) ListForUser(ctx context.Context, userID int64) ([]*model.PasskeyResponse, error) {
+	// interact with db
+
+	pkdbs, err := dba.GetPasskeysForUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("passkey dba - list: %w", err)
+	}
+
+	// convert to response
+
+	pkrs := []*model.PasskeyResponse{}
+	for _, pkdb := range pkdbs {
+		pkrs = append(pkrs, pkdb.ToResponse())
+	}
+
+	return pkrs, nil
+}
+
+// BeginRegistration starts adding a passkey to the user. The authenticator is
+// asked for a discoverable credential, so it can later sign in without an
+// email, and for no attestation, since any authenticator is welcome
+func (serv *PasskeyService) BeginRegistration(ctx context.Context, userID int64) (*model.PasskeyCeremony, error) {
+	// interact with db
+
+	user, err := serv.passkeyUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// begin ceremony
+
+	return serv.beginRegistration(user)
+}
+
+func (serv *PasskeyService) beginRegistration(user *model.PasskeyUser) (*model.PasskeyCeremony, error) {
+	creation, session, err := serv.webauthn.BeginRegistration(user,
+		webauthn.WithConveyancePreference(protocol.PreferNoAttestation),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(user.CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PasskeyCeremony{Options: creation.Response, Session: session}, nil
+}
+
+// FinishRegistration verifies the browser's answer against the challenge and
+// stores the passkey's public key
+func (serv *PasskeyService) FinishRegistration(ctx context.Context, i *model.PasskeyCreateInput) (*model.PasskeyResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey create: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	user, err := serv.passkeyUser(ctx, i.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := serv.verifyRegistration(user, i)
+	if err != nil {
+		return nil, err
+	}
+
+	pkdb, err := dba.CreatePasskey(ctx, serv.db, i.ToParams(cred))
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRCONFLICT {
+			i.AddFieldError("credential", "this passkey is already registered")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey create: %q", i.FieldErrors)
+		}
+		return nil, fmt.Errorf("passkey dba - create: %w", err)
+	}
+
+	// convert to response
+
+	return pkdb.ToResponse(), nil
+}
+
+// verifyRegistration checks the browser's answer against the challenge,
+// returning the new credential
+func (serv *PasskeyService) verifyRegistration(user *model.PasskeyUser, i *model.PasskeyCreateInput) (*webauthn.Credential, error) {
+	parsed, err := i.ParseCredential()
+	if err != nil {
+		i.AddFieldError("credential", "your browser sent a passkey we couldn't read; try again")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey create: %q", i.FieldErrors)
+	}
+
+	cred, err := serv.webauthn.CreateCredential(user, *i.Session, parsed)
+	if err != nil {
+		i.AddFieldError("credential", "the passkey couldn't be verified; try again")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey create: %q", i.FieldErrors)
+	}
+
+	return cred, nil
+}
+
+// BeginLogin starts a sign-in with any passkey; the authenticator tells which
+// user it belongs to
+func (serv *PasskeyService) BeginLogin(ctx context.Context) (*model.PasskeyCeremony, error) {
+	assertion, session, err := serv.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationPreferred),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PasskeyCeremony{Options: assertion.Response, Session: session}, nil
+}
+
+// FinishLogin verifies the browser's answer with the stored public key of the
+// passkey used. A signature counter that didn't move forward means the passkey
+// may have been cloned, and the login is refused
+func (serv *PasskeyService) FinishLogin(ctx context.Context, i *model.PasskeyLoginInput) (*model.PasskeyLoginResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey login: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	findUser := func(userHandle []byte) (*model.PasskeyUser, error) {
+		id, err := dba.GetUserIDByWebAuthnHandle(ctx, serv.db, userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return serv.passkeyUser(ctx, id)
+	}
+
+	cred, pk, err := serv.verifyLogin(i, findUser)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dba.UpdatePasskeyUse(ctx, serv.db, pk.ID, cred.Authenticator.SignCount, cred.Flags.BackupState)
+	if err != nil {
+		return nil, fmt.Errorf("passkey dba - update use: %w", err)
+	}
+
+	udb, err := dba.GetUser(ctx, serv.db, pk.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - passkey login: %w", err)
+	}
+
+	// convert to response
+
+	return &model.PasskeyLoginResponse{
+		User:         udb.ToResponse(),
+		UserVerified: cred.Flags.UserVerified,
+	}, nil
+}
+
+// verifyLogin checks the browser's answer with the public key of the passkey
+// used, returning the verified credential and the stored passkey it matches
+func (serv *PasskeyService) verifyLogin(i *model.PasskeyLoginInput, findUser func(userHandle []byte) (*model.PasskeyUser, error)) (*webauthn.Credential, *model.PasskeyDB, error) {
+	parsed, err := i.ParseCredential()
+	if err != nil {
+		i.AddFieldError("credential", "your browser sent a passkey we couldn't read; try again")
+		return nil, nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey login: %q", i.FieldErrors)
+	}
+
+	var user *model.PasskeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		u, err := findUser(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		user = u
+		return u, nil
+	}
+
+	cred, err := serv.webauthn.ValidateDiscoverableLogin(handler, *i.Session, parsed)
+	if err != nil {
+		i.AddFieldError("credential", "this passkey isn't registered here or couldn't be verified")
+		return nil, nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey login: %q", i.FieldErrors)
+	}
+	if cred.Authenticator.CloneWarning {
+		i.AddFieldError("credential", "this passkey may have been copied; sign in with your password and remove it")
+		return nil, nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for passkey login: %q", i.FieldErrors)
+	}
+
+	pk := user.PasskeyByCredentialID(cred.ID)
+	if pk == nil {
+		return nil, nil, errs.Errorf(errs.ERRINTERNAL, "verified passkey not found")
+	}
+
+	return cred, pk, nil
+}
+
+func (serv *PasskeyService) Delete(ctx context.Context, id int64, userID int64) error {
+	err := dba.DeletePasskey(ctx, serv.db, id, userID)
+	if err != nil {
+		return fmt.Errorf("passkey dba - delete: %w", err)
+	}
+	return nil
+}
+
+// passkeyUser loads the user with their passkeys, giving them a webauthn
+// handle on first use
+func (serv *PasskeyService) passkeyUser(ctx context.Context, userID int64) (*model.PasskeyUser, error) {
+	udb, err := dba.GetUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - passkey user: %w", err)
+	}
+
+	candidate, err := model.NewWebAuthnHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := dba.EnsureUserWebAuthnHandle(ctx, serv.db, userID, candidate)
+	if err != nil {
+		return nil, fmt.Errorf("passkey dba - ensure handle: %w", err)
+	}
+
+	pkdbs, err := dba.GetPasskeysForUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("passkey dba - list: %w", err)
+	}
+
+	return &model.PasskeyUser{
+		Handle:   handle,
+		Name:     udb.Name,
+		Email:    udb.Email,
+		Passkeys: pkdbs,
+	}, nil
+}
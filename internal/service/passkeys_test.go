@@ -0,0 +1,431 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+const testOrigin = "https://coffee.example"
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator is a software passkey: a P-256 key pair, answering the
+// ceremonies like a browser would with a "none" attestation
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+	verifyUser   bool // answer as if a fingerprint or PIN was checked
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{key: key, credentialID: id, origin: testOrigin, verifyUser: true}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, typ string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": b64(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (a *softAuthenticator) authData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if a.verifyUser {
+		flags |= flagUserVerified
+	}
+
+	var b bytes.Buffer
+	b.Write(rpIDHash[:])
+	b.WriteByte(flagUserPresent | flags)
+	binary.Write(&b, binary.BigEndian, a.signCount)
+	return b.Bytes()
+}
+
+// register answers registration options with a new credential, as json
+func (a *softAuthenticator) register(t *testing.T, ceremony *model.PasskeyCeremony, userHandle []byte) string {
+	t.Helper()
+
+	opts := ceremony.Options.(protocol.PublicKeyCredentialCreationOptions)
+	a.userHandle = userHandle
+
+	pub, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authData := a.authData(opts.RelyingParty.ID, flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, pub...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64(a.clientData(t, "webauthn.create", opts.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// login answers login options by signing the challenge, as json
+func (a *softAuthenticator) login(t *testing.T, ceremony *model.PasskeyCeremony) string {
+	t.Helper()
+
+	opts := ceremony.Options.(protocol.PublicKeyCredentialRequestOptions)
+	a.signCount++
+
+	clientData := a.clientData(t, "webauthn.get", opts.Challenge)
+	authData := a.authData(opts.RelyingPartyID, 0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(sig),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) string {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func newTestPasskeyService(t *testing.T) *PasskeyService {
+	t.Helper()
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          "coffee.example",
+		RPDisplayName: "somethingsomethingcoffee",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the ceremonies under test don't touch the database
+	return NewPasskeyService(nil, wa)
+}
+
+func newTestPasskeyUser(t *testing.T) *model.PasskeyUser {
+	t.Helper()
+
+	handle, err := model.NewWebAuthnHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.PasskeyUser{Handle: handle, Name: "alice", Email: "alice@example.com"}
+}
+
+// registerPasskey runs a registration and stores the passkey on the user the
+// way dba.CreatePasskey would
+func registerPasskey(t *testing.T, serv *PasskeyService, user *model.PasskeyUser, auth *softAuthenticator) *model.PasskeyDB {
+	t.Helper()
+
+	ceremony, err := serv.beginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &model.PasskeyCreateInput{
+		UserID:     1,
+		Session:    ceremony.Session,
+		Name:       "laptop",
+		Credential: auth.register(t, ceremony, user.Handle),
+	}
+	cred, err := serv.verifyRegistration(user, input)
+	if err != nil {
+		t.Fatalf("registration: %v %v", err, input.FieldErrors)
+	}
+
+	p := input.ToParams(cred)
+	pk := &model.PasskeyDB{
+		ID:              int64(len(user.Passkeys) + 1),
+		UserID:          p.UserID,
+		Name:            p.Name,
+		CredentialID:    p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transports:      p.Transports,
+		AAGUID:          p.AAGUID,
+		SignCount:       p.SignCount,
+		BackupEligible:  p.BackupEligible,
+		BackupState:     p.BackupState,
+	}
+	user.Passkeys = append(user.Passkeys, pk)
+	return pk
+}
+
+// loginWithPasskey runs a sign-in, finding the user by the handle the
+// authenticator answers with
+func loginWithPasskey(t *testing.T, serv *PasskeyService, user *model.PasskeyUser, auth *softAuthenticator) (*webauthn.Credential, *model.PasskeyDB, *model.PasskeyLoginInput, error) {
+	t.Helper()
+
+	ceremony, err := serv.BeginLogin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &model.PasskeyLoginInput{
+		Session:    ceremony.Session,
+		Credential: auth.login(t, ceremony),
+	}
+	findUser := func(handle []byte) (*model.PasskeyUser, error) {
+		if !bytes.Equal(handle, user.Handle) {
+			return nil, errors.New("no user with this handle")
+		}
+		return user, nil
+	}
+
+	cred, pk, err := serv.verifyLogin(input, findUser)
+	return cred, pk, input, err
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	serv := newTestPasskeyService(t)
+	user := newTestPasskeyUser(t)
+	auth := newSoftAuthenticator(t)
+
+	stored := registerPasskey(t, serv, user, auth)
+	if !bytes.Equal(stored.CredentialID, auth.credentialID) {
+		t.Errorf("stored credential id %x; want %x", stored.CredentialID, auth.credentialID)
+	}
+
+	cred, pk, input, err := loginWithPasskey(t, serv, user, auth)
+	if err != nil {
+		t.Fatalf("login: %v %v", err, input.FieldErrors)
+	}
+	if pk != stored {
+		t.Errorf("login matched passkey %d; want %d", pk.ID, stored.ID)
+	}
+	if !cred.Flags.UserVerified {
+		t.Error("login not user verified; want verified")
+	}
+	if cred.Authenticator.SignCount != auth.signCount {
+		t.Errorf("sign count %d; want %d", cred.Authenticator.SignCount, auth.signCount)
+	}
+}
+
+func TestPasskeyLoginWithoutUserVerification(t *testing.T) {
+	serv := newTestPasskeyService(t)
+	user := newTestPasskeyUser(t)
+	auth := newSoftAuthenticator(t)
+	registerPasskey(t, serv, user, auth)
+
+	// only stands in for the password, so 2fa users still need their code
+	auth.verifyUser = false
+	cred, _, input, err := loginWithPasskey(t, serv, user, auth)
+	if err != nil {
+		t.Fatalf("login: %v %v", err, input.FieldErrors)
+	}
+	if cred.Flags.UserVerified {
+		t.Error("login user verified; want unverified")
+	}
+}
+
+func TestPasskeyRegistrationExcludesRegistered(t *testing.T) {
+	serv := newTestPasskeyService(t)
+	user := newTestPasskeyUser(t)
+	auth := newSoftAuthenticator(t)
+	registerPasskey(t, serv, user, auth)
+
+	ceremony, err := serv.beginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ceremony.Options.(protocol.PublicKeyCredentialCreationOptions)
+	if len(opts.CredentialExcludeList) != 1 || !bytes.Equal(opts.CredentialExcludeList[0].CredentialID, auth.credentialID) {
+		t.Errorf("excluded credentials %v; want the registered passkey", opts.CredentialExcludeList)
+	}
+}
+
+func TestPasskeyRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer func(t *testing.T, serv *PasskeyService, user *model.PasskeyUser, auth *softAuthenticator) *model.PasskeyCreateInput
+	}{
+		{
+			name: "other origin",
+			answer: func(t *testing.T, serv *PasskeyService, user *model.PasskeyUser, auth *softAuthenticator) *model.PasskeyCreateInput {
+				ceremony, _ := serv.beginRegistration(user)
+				auth.origin = "https://evil.example"
+				return &model.PasskeyCreateInput{Session: ceremony.Session, Credential: auth.register(t, ceremony, user.Handle)}
+			},
+		},
+		{
+			name: "other ceremony's challenge",
+			answer: func(t *testing.T, serv *PasskeyService, user *model.PasskeyUser, auth *softAuthenticator) *model.PasskeyCreateInput {
+				ceremony, _ := serv.beginRegistration(user)
+				other, _ := serv.beginRegistration(user)
+				return &model.PasskeyCreateInput{Session: other.Session, Credential: auth.register(t, ceremony, user.Handle)}
+			},
+		},
+		{
+			name: "unreadable",
+			answer: func(t *testing.T, serv *PasskeyService, user *model.PasskeyUser, auth *softAuthenticator) *model.PasskeyCreateInput {
+				ceremony, _ := serv.beginRegistration(user)
+				return &model.PasskeyCreateInput{Session: ceremony.Session, Credential: `{"id":"x"}`}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := newTestPasskeyService(t)
+			user := newTestPasskeyUser(t)
+			input := tt.answer(t, serv, user, newSoftAuthenticator(t))
+
+			_, err := serv.verifyRegistration(user, input)
+			if err == nil {
+				t.Fatal("registration accepted; want rejected")
+			}
+			if _, ok := input.FieldErrors["credential"]; !ok {
+				t.Errorf("field errors %v; want one on credential", input.FieldErrors)
+			}
+		})
+	}
+}
+
+func TestPasskeyLoginRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		before func(user *model.PasskeyUser, auth *softAuthenticator)
+		want   string // in the credential field error
+	}{
+		{
+			name: "other origin",
+			before: func(user *model.PasskeyUser, auth *softAuthenticator) {
+				auth.origin = "https://evil.example"
+			},
+			want: "couldn't be verified",
+		},
+		{
+			name: "other key",
+			before: func(user *model.PasskeyUser, auth *softAuthenticator) {
+				key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				auth.key = key
+			},
+			want: "couldn't be verified",
+		},
+		{
+			name: "removed passkey",
+			before: func(user *model.PasskeyUser, auth *softAuthenticator) {
+				user.Passkeys = nil
+			},
+			want: "couldn't be verified",
+		},
+		{
+			name: "unknown user",
+			before: func(user *model.PasskeyUser, auth *softAuthenticator) {
+				auth.userHandle = []byte("someone else")
+			},
+			want: "couldn't be verified",
+		},
+		{
+			name: "cloned passkey",
+			before: func(user *model.PasskeyUser, auth *softAuthenticator) {
+				// the stored count is ahead of the one the authenticator signs
+				user.Passkeys[0].SignCount = 10
+				auth.signCount = 4
+			},
+			want: "copied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := newTestPasskeyService(t)
+			user := newTestPasskeyUser(t)
+			auth := newSoftAuthenticator(t)
+			registerPasskey(t, serv, user, auth)
+
+			tt.before(user, auth)
+
+			_, _, input, err := loginWithPasskey(t, serv, user, auth)
+			if err == nil {
+				t.Fatal("login accepted; want rejected")
+			}
+			if msg := input.FieldErrors["credential"]; !strings.Contains(msg, tt.want) {
+				t.Errorf("credential field error %q; want it to mention %q", msg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// weights of the attributes shared between two beans; they add up to 1
+const (
+	similarityRoasterWeight = 0.4
+	similarityRoastWeight   = 0.4
+	similarityNameWeight    = 0.2
+)
+
+const (
+	similarityMinScore  = 0.3 // pairs scoring lower aren't worth recommending
+	similarityKeep      = 10  // scores stored per bean
+	similarityListLimit = 5   // recommendations shown per bean
+	similarityBatchMax  = 50  // more changed beans are recomputed from scratch
+)
+
+type RecommendationService struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewRecommendationService(db *sql.DB, logger *slog.Logger) *RecommendationService {
+	return &RecommendationService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Similar returns the precomputed most similar beans to the given bean
+func (serv *RecommendationService) Similar(ctx context.Context, beanID int64) ([]*model.BeanSimilarityResponse, error) {
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sdbs, err := dba.GetSimilarBeans(ctx, tx, beanID, similarityListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("recommendation dba - similar: %w", err)
+	}
+
+	beans := []*model.BeanDB{}
+	for _, sdb := range sdbs {
+		beans = append(beans, sdb.Bean)
+	}
+	err = dba.AttachManyBeanAssociations(ctx, tx, beans)
+	if err != nil {
+		return nil, fmt.Errorf("recommendation dba - similar: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	srs := []*model.BeanSimilarityResponse{}
+	for _, sdb := range sdbs {
+		srs = append(srs, sdb.ToResponse())
+	}
+
+	return srs, nil
+}
+
+// RecomputeAll rebuilds the similarity table from scratch
+func (serv *RecommendationService) RecomputeAll(ctx context.Context) error {
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bdbs, err := dba.FindBeans(ctx, tx, &model.BeanFilterParams{SortField: "id", SortDir: "ASC"})
+	if err != nil {
+		return fmt.Errorf("bean dba - find: %w", err)
+	}
+
+	sims := []*model.BeanSimilarityParams{}
+	for _, a := range bdbs {
+		sims = append(sims, topSimilarities(a, bdbs)...)
+	}
+
+	err = dba.DeleteAllBeanSimilarities(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("recommendation dba - delete all: %w", err)
+	}
+
+	err = dba.InsertBeanSimilarities(ctx, tx, sims)
+	if err != nil {
+		return fmt.Errorf("recommendation dba - insert: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Recompute refreshes the recommendations of beans that were just created or
+// edited. It runs after their write committed, so failures are only logged;
+// the periodic full recompute catches up
+func (serv *RecommendationService) Recompute(ctx context.Context, beanIDs ...int64) {
+	var err error
+	if len(beanIDs) > similarityBatchMax {
+		err = serv.RecomputeAll(ctx)
+	} else {
+		for _, id := range beanIDs {
+			err = errors.Join(err, serv.recomputeBean(ctx, id))
+		}
+	}
+	if err != nil {
+		serv.logger.Error(err.Error(), "job", "bean similarity", "beans", len(beanIDs))
+	}
+}
+
+// recomputeBean refreshes the scores between one bean and the beans that may
+// be similar enough to it. Other beans' lists are trimmed but not refilled, the
+// periodic full recompute takes care of that.
+func (serv *RecommendationService) recomputeBean(ctx context.Context, beanID int64) error {
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bean, err := dba.GetBean(ctx, tx, beanID)
+	if err != nil {
+		return fmt.Errorf("bean dba - get: %w", err)
+	}
+
+	words := []string{}
+	for w := range nameWords(bean.Name) {
+		words = append(words, w)
+	}
+	candidates, err := dba.FindSimilarityCandidates(ctx, tx, bean, roastDistanceWithin(0), roastDistanceWithin(similarityNameWeight), words)
+	if err != nil {
+		return fmt.Errorf("recommendation dba - candidates: %w", err)
+	}
+
+	// the bean's own list, plus the bean in every other list it qualifies for
+	sims := topSimilarities(bean, candidates)
+	trim := []int64{bean.ID}
+	for _, other := range candidates {
+		score := beanSimilarity(other, bean)
+		if score >= similarityMinScore {
+			sims = append(sims, &model.BeanSimilarityParams{BeanID: other.ID, SimilarBeanID: bean.ID, Score: score})
+			trim = append(trim, other.ID)
+		}
+	}
+
+	err = dba.DeleteBeanSimilarities(ctx, tx, bean.ID)
+	if err != nil {
+		return fmt.Errorf("recommendation dba - delete: %w", err)
+	}
+
+	err = dba.InsertBeanSimilarities(ctx, tx, sims)
+	if err != nil {
+		return fmt.Errorf("recommendation dba - insert: %w", err)
+	}
+
+	err = dba.TrimBeanSimilarities(ctx, tx, trim, similarityKeep)
+	if err != nil {
+		return fmt.Errorf("recommendation dba - trim: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// roastDistanceWithin is the furthest apart two beans' roast levels can be for
+// them to still reach the minimum score, given what their other attributes
+// add; -1 if even the same roast level isn't enough
+func roastDistanceWithin(other float64) int {
+	steps := model.RoastLevelSteps()
+	for d := steps; d >= 0; d-- {
+		// a little slack for rounding, candidates are scored exactly later
+		if similarityRoastWeight*(1-float64(d)/float64(steps))+other >= similarityMinScore-1e-9 {
+			return d
+		}
+	}
+	return -1
+}
+
+// topSimilarities scores bean against all others and keeps the best ones
+func topSimilarities(bean *model.BeanDB, others []*model.BeanDB) []*model.BeanSimilarityParams {
+	sims := []*model.BeanSimilarityParams{}
+	for _, other := range others {
+		if other.ID == bean.ID {
+			continue
+		}
+		score := beanSimilarity(bean, other)
+		if score >= similarityMinScore {
+			sims = append(sims, &model.BeanSimilarityParams{BeanID: bean.ID, SimilarBeanID: other.ID, Score: score})
+		}
+	}
+
+	slices.SortFunc(sims, func(a, b *model.BeanSimilarityParams) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.SimilarBeanID, b.SimilarBeanID)
+	})
+
+	return sims[:min(len(sims), similarityKeep)]
+}
+
+// beanSimilarity scores two beans between 0 and 1 from the attributes they share:
+// the roaster, how close their roast levels are, and the words in their names,
+// which is where origin and flavor information lives for now
+func beanSimilarity(a, b *model.BeanDB) float64 {
+	score := 0.0
+
+	if a.RoasterID == b.RoasterID {
+		score += similarityRoasterWeight
+	}
+
+	ra, rb := a.RoastLevel.Ordinal(), b.RoastLevel.Ordinal()
+	if ra >= 0 && rb >= 0 {
+		distance := math.Abs(float64(ra - rb))
+		score += similarityRoastWeight * (1 - distance/float64(model.RoastLevelSteps()))
+	}
+
+	score += similarityNameWeight * jaccard(nameWords(a.Name), nameWords(b.Name))
+
+	return score
+}
+
+func nameWords(name string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+// share of words that appear in both sets
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
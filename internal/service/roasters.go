@@ -33,15 +33,31 @@ func (serv *RoasterService) Create(ctx context.Context, i *model.RoasterCreateIn
 
 	// interact with db
 
-	rdb, err := dba.CreateRoaster(ctx, serv.db, rcp)
+	tx, err := serv.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("roaster dba - create: %w", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	// convert to response
+	rdb, err := dba.CreateRoaster(ctx, tx, rcp)
+	if err != nil {
+		return nil, fmt.Errorf("roaster dba - create: %w", err)
+	}
 
 	rr := rdb.ToResponse()
 
+	err = enqueueWebhookEvent(ctx, tx, model.WebhookRoasterCreated, rr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
 	return rr, nil
 }
 
@@ -120,6 +136,56 @@ func (serv *RoasterService) Find(ctx context.Context, i *model.RoasterFilterInpu
 	return rrs, nil
 }
 
+// Export streams the roasters matching the filter to fn; validation errors are
+// returned before the first row
+func (serv *RoasterService) Export(ctx context.Context, i *model.RoasterFilterInput, fn func(*model.RoasterExportRow) error) error {
+	// validate
+	i.Validate()
+
+	if !i.Valid() {
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for roaster export: %q, %q", i.FieldErrors, i.NonFieldErrors)
+	}
+
+	rfp := i.ToParams()
+
+	// interact with db
+
+	err := dba.ExportRoasters(ctx, serv.db, rfp, fn)
+	if err != nil {
+		return fmt.Errorf("roaster dba - export: %w", err)
+	}
+
+	return nil
+}
+
+func (serv *RoasterService) Suggest(ctx context.Context, i *model.RoasterSuggestInput) ([]*model.RoasterResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for roaster suggest: %q", i.FieldErrors)
+	}
+
+	rsp := i.ToParams()
+
+	// interact with db
+
+	rdbs, err := dba.SuggestRoasters(ctx, serv.db, rsp)
+	if err != nil {
+		return nil, fmt.Errorf("roaster dba - suggest: %w", err)
+	}
+
+	// convert to response
+
+	rrs := []*model.RoasterResponse{}
+	for _, rdb := range rdbs {
+		rrs = append(rrs, rdb.ToResponse())
+	}
+
+	return rrs, nil
+}
+
 func (serv *RoasterService) Update(ctx context.Context, i *model.RoasterEditInput) (*model.RoasterResponse, error) {
 	// validate
 
@@ -149,6 +215,13 @@ func (serv *RoasterService) Update(ctx context.Context, i *model.RoasterEditInpu
 		return nil, fmt.Errorf("roaster repository - update: %w", err)
 	}
 
+	rr := rdb.ToResponse()
+
+	err = enqueueWebhookEvent(ctx, tx, model.WebhookRoasterUpdated, rr)
+	if err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
@@ -156,18 +229,27 @@ func (serv *RoasterService) Update(ctx context.Context, i *model.RoasterEditInpu
 
 	// convert to response
 
-	rr := rdb.ToResponse()
-
 	return rr, nil
 }
 
 func (serv *RoasterService) Delete(ctx context.Context, id int64) error {
 	// interact with db
 
-	err := dba.DeleteRoaster(ctx, serv.db, id)
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = dba.DeleteRoaster(ctx, tx, id)
 	if err != nil {
 		return fmt.Errorf("roaster repository - delete: %w", err)
 	}
 
-	return nil
+	err = enqueueWebhookEvent(ctx, tx, model.WebhookRoasterDeleted, map[string]int64{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
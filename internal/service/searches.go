@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type SavedSearchService struct {
+	db *sql.DB
+}
+
+func NewSavedSearchService(db *sql.DB) *SavedSearchService {
+	return &SavedSearchService{
+		db: db,
+	}
+}
+
+func (serv *SavedSearchService) Create(ctx context.Context, i *model.SavedSearchCreateInput) (*model.SavedSearchResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for saved search create: %q", i.FieldErrors)
+	}
+
+	scp := i.ToParams()
+
+	// interact with db
+
+	sdb, err := dba.CreateSavedSearch(ctx, serv.db, scp)
+	if err != nil {
+		return nil, fmt.Errorf("saved search dba - create: %w", err)
+	}
+
+	// convert to response
+
+	return sdb.ToResponse(), nil
+}
+
+func (serv *SavedSearchService) ListForUser(ctx context.Context, userID int64) ([]*model.SavedSearchResponse, error) {
+	// interact with db
+
+	sdbs, err := dba.GetSavedSearchesForUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("saved search dba - list: %w", err)
+	}
+
+	// convert to response
+
+	srs := []*model.SavedSearchResponse{}
+	for _, sdb := range sdbs {
+		srs = append(srs, sdb.ToResponse())
+	}
+
+	return srs, nil
+}
+
+func (serv *SavedSearchService) Update(ctx context.Context, i *model.SavedSearchEditInput) (*model.SavedSearchResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for saved search update: %q", i.FieldErrors)
+	}
+
+	sep := i.ToParams()
+
+	// interact with db
+
+	sdb, err := dba.UpdateSavedSearch(ctx, serv.db, sep)
+	if err != nil {
+		return nil, fmt.Errorf("saved search dba - update: %w", err)
+	}
+
+	// convert to response
+
+	return sdb.ToResponse(), nil
+}
+
+func (serv *SavedSearchService) Delete(ctx context.Context, id int64, userID int64) error {
+	// interact with db
+
+	err := dba.DeleteSavedSearch(ctx, serv.db, id, userID)
+	if err != nil {
+		return fmt.Errorf("saved search dba - delete: %w", err)
+	}
+
+	return nil
+}
+
+// RunAll re-runs every saved search and notifies its owner about beans that are
+// new since the previous run. It returns the number of notifications sent.
+func (serv *SavedSearchService) RunAll(ctx context.Context) (int, error) {
+	sdbs, err := dba.GetAllSavedSearches(ctx, serv.db)
+	if err != nil {
+		return 0, fmt.Errorf("saved search dba - run all: %w", err)
+	}
+
+	// keep going when a single search fails, and report all failures at the end
+	sent := 0
+	var runErrs []error
+	for _, sdb := range sdbs {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		notified, err := serv.run(ctx, sdb)
+		if err != nil {
+			runErrs = append(runErrs, fmt.Errorf("saved search %d: %w", sdb.ID, err))
+			continue
+		}
+		if notified {
+			sent++
+		}
+	}
+
+	return sent, errors.Join(runErrs...)
+}
+
+func (serv *SavedSearchService) run(ctx context.Context, sdb *model.SavedSearchDB) (bool, error) {
+	// validate
+
+	filter, err := model.BeanFilterFromQuery(sdb.Query)
+	if err != nil {
+		return false, errs.Errorf(errs.ERRUNPROCESSABLE, "invalid saved query string: %s", err)
+	}
+
+	filter.Validate()
+
+	if !filter.Valid() {
+		return false, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for saved search run: %q", filter.FieldErrors)
+	}
+
+	bfp := filter.ToParams()
+	bfp.AfterID = sdb.LastBeanID
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	bdbs, err := dba.FindBeans(ctx, tx, bfp)
+	if err != nil {
+		return false, fmt.Errorf("bean dba - find: %w", err)
+	}
+
+	lastBeanID := sdb.LastBeanID
+	for _, bdb := range bdbs {
+		lastBeanID = max(lastBeanID, bdb.ID)
+	}
+
+	if len(bdbs) > 0 {
+		message := fmt.Sprintf("%d new bean(s) match your saved search %q", len(bdbs), sdb.Name)
+		if len(bdbs) == 1 {
+			message = fmt.Sprintf("%q matches your saved search %q", bdbs[0].Name, sdb.Name)
+		}
+
+		_, err = dba.CreateNotification(ctx, tx, &model.NotificationCreateParams{
+			UserID:  sdb.UserID,
+			Message: message,
+			Link:    "/beans?" + sdb.Query,
+		})
+		if err != nil {
+			return false, fmt.Errorf("notification dba - create: %w", err)
+		}
+	}
+
+	err = dba.SetSavedSearchRun(ctx, tx, sdb.ID, lastBeanID)
+	if err != nil {
+		return false, fmt.Errorf("saved search dba - set run: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return len(bdbs) > 0, nil
+}
@@ -1,17 +1,54 @@
 package service
 
-import "database/sql"
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/mailer"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
 
 type Services struct {
-	Beans    *BeanService
-	Roasters *RoasterService
-	Users    *UserService // interacts with permissions
+	APITokens       *APITokenService
+	Beans           *BeanService
+	Imports         *ImportService
+	LoginThrottles  *LoginThrottleService
+	Notifications   *NotificationService
+	OIDC            *OIDCService
+	Passkeys        *PasskeyService
+	Recommendations *RecommendationService
+	Roasters        *RoasterService
+	SavedSearches   *SavedSearchService
+	Searches        *SearchAnalyticsService
+	Sessions        *SessionService
+	Sitemaps        *SitemapService
+	TwoFactor       *TwoFactorService
+	Users           *UserService // interacts with permissions
+	Webhooks        *WebhookService
 }
 
-func NewServices(db *sql.DB) *Services {
+func NewServices(db *sql.DB, logger *slog.Logger, mlr mailer.Mailer, wa *webauthn.WebAuthn, throttle model.LoginThrottlePolicy) *Services {
+	recommendations := NewRecommendationService(db, logger)
+	throttles := NewLoginThrottleService(db, throttle)
+
 	return &Services{
-		Beans:    NewBeanService(db),
-		Roasters: NewRoasterService(db),
-		Users:    NewUserService(db),
+		APITokens:       NewAPITokenService(db),
+		Beans:           NewBeanService(db, recommendations),
+		Imports:         NewImportService(db, recommendations),
+		LoginThrottles:  throttles,
+		Notifications:   NewNotificationService(db),
+		OIDC:            NewOIDCService(db),
+		Passkeys:        NewPasskeyService(db, wa),
+		Recommendations: recommendations,
+		Roasters:        NewRoasterService(db),
+		SavedSearches:   NewSavedSearchService(db),
+		Searches:        NewSearchAnalyticsService(db),
+		Sessions:        NewSessionService(db),
+		Sitemaps:        NewSitemapService(db),
+		TwoFactor:       NewTwoFactorService(db, throttles),
+		Users:           NewUserService(db, mlr, throttles),
+		Webhooks:        NewWebhookService(db),
 	}
 }
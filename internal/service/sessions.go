@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// number of sessions on the admin sessions page
+const recentSessionsLimit = 100
+
+type SessionService struct {
+	db *sql.DB
+}
+
+func NewSessionService(db *sql.DB) *SessionService {
+	return &SessionService{
+		db: db,
+	}
+}
+
+// Start records a newly signed-in session
+func (serv *SessionService) Start(ctx context.Context, p *model.UserSessionParams) error {
+	p.Truncate()
+
+	_, err := dba.CreateUserSession(ctx, serv.db, p)
+	if err != nil {
+		return fmt.Errorf("session dba - create: %w", err)
+	}
+	return nil
+}
+
+// Seen checks the session wasn't revoked, and records where it was used from
+// at most every SessionSeenInterval, or right away when its token was renewed.
+// False means the session was revoked
+func (serv *SessionService) Seen(ctx context.Context, p *model.UserSessionParams) (bool, error) {
+	p.Truncate()
+
+	sdb, err := dba.GetUserSession(ctx, serv.db, p.Key, p.UserID)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			return false, nil
+		}
+		return false, fmt.Errorf("session dba - get: %w", err)
+	}
+
+	if time.Since(sdb.LastSeenAt) >= model.SessionSeenInterval || sdb.Token != p.Token || sdb.IP != p.IP || sdb.UserAgent != p.UserAgent {
+		err = dba.TouchUserSession(ctx, serv.db, sdb.ID, p)
+		if err != nil {
+			return false, fmt.Errorf("session dba - touch: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+func (serv *SessionService) ListForUser(ctx context.Context, userID int64, currentKey string) ([]*model.UserSessionResponse, error) {
+	// interact with db
+
+	sdbs, err := dba.GetUserSessionsForUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("session dba - list: %w", err)
+	}
+
+	// convert to response
+
+	srs := []*model.UserSessionResponse{}
+	for _, sdb := range sdbs {
+		srs = append(srs, sdb.ToResponse(currentKey))
+	}
+
+	return srs, nil
+}
+
+// ListRecent lists the sessions of all users that were seen last
+func (serv *SessionService) ListRecent(ctx context.Context) ([]*model.UserSessionResponse, error) {
+	// interact with db
+
+	sdbs, err := dba.GetRecentUserSessions(ctx, serv.db, recentSessionsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("session dba - list recent: %w", err)
+	}
+
+	// convert to response
+
+	srs := []*model.UserSessionResponse{}
+	for _, sdb := range sdbs {
+		srs = append(srs, sdb.ToResponse(""))
+	}
+
+	return srs, nil
+}
+
+// Revoke ends one of the user's sessions and returns its key and session store
+// token
+func (serv *SessionService) Revoke(ctx context.Context, id int64, userID int64) (string, string, error) {
+	sdb, err := dba.DeleteUserSession(ctx, serv.db, id, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("session dba - delete: %w", err)
+	}
+	return sdb.Key, sdb.Token, nil
+}
+
+// RevokeAll ends all the user's sessions except the one with keepKey, and
+// returns their session store tokens
+func (serv *SessionService) RevokeAll(ctx context.Context, userID int64, keepKey string) ([]string, error) {
+	tokens, err := dba.DeleteUserSessionsForUser(ctx, serv.db, userID, keepKey)
+	if err != nil {
+		return nil, fmt.Errorf("session dba - delete for user: %w", err)
+	}
+	return tokens, nil
+}
+
+// End forgets sessions that were signed out or destroyed
+func (serv *SessionService) End(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := dba.DeleteUserSessionsByKey(ctx, serv.db, keys)
+	if err != nil {
+		return fmt.Errorf("session dba - delete by key: %w", err)
+	}
+	return nil
+}
+
+// Prune forgets sessions that have expired from the session store
+func (serv *SessionService) Prune(ctx context.Context, lifetime time.Duration) (int64, error) {
+	n, err := dba.DeleteExpiredUserSessions(ctx, serv.db, lifetime)
+	if err != nil {
+		return 0, fmt.Errorf("session dba - delete expired: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+type SitemapService struct {
+	db *sql.DB
+}
+
+func NewSitemapService(db *sql.DB) *SitemapService {
+	return &SitemapService{
+		db: db,
+	}
+}
+
+// Index returns how many sitemap files each kind is split into
+func (serv *SitemapService) Index(ctx context.Context) (*model.SitemapIndexResponse, error) {
+	// interact with db
+
+	counts, err := dba.CountSitemapEntries(ctx, serv.db)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap dba - count: %w", err)
+	}
+
+	// convert to response
+
+	return model.NewSitemapIndexResponse(counts), nil
+}
+
+// Page returns the ids listed in one sitemap file
+func (serv *SitemapService) Page(ctx context.Context, i *model.SitemapPageInput) (*model.SitemapPageResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRNOTFOUND, "sitemap not found")
+	}
+
+	smp := i.ToParams()
+
+	// interact with db
+
+	ids, err := dba.FindSitemapIDs(ctx, serv.db, smp)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap dba - page: %w", err)
+	}
+
+	// pages past the end don't exist; the first page is always served, even if empty
+	if len(ids) == 0 && i.Page > 1 {
+		return nil, errs.Errorf(errs.ERRNOTFOUND, "sitemap not found")
+	}
+
+	// convert to response
+
+	return &model.SitemapPageResponse{Kind: i.Kind, IDs: ids}, nil
+}
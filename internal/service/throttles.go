@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash is compared against for unknown emails, so they take as
+// long to turn down as a wrong password
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not anyone's password"), 12)
+	return hash
+})
+
+// LoginThrottleService counts failed logins, both wrong passwords and wrong
+// two-factor codes, against the email and client ip
+type LoginThrottleService struct {
+	db     *sql.DB
+	policy model.LoginThrottlePolicy
+}
+
+func NewLoginThrottleService(db *sql.DB, policy model.LoginThrottlePolicy) *LoginThrottleService {
+	return &LoginThrottleService{
+		db:     db,
+		policy: policy,
+	}
+}
+
+// ListLocked lists the emails and client ips currently locked out
+func (serv *LoginThrottleService) ListLocked(ctx context.Context) ([]*model.LoginThrottleResponse, error) {
+	// interact with db
+
+	tdbs, err := dba.GetLockedLoginThrottles(ctx, serv.db)
+	if err != nil {
+		return nil, fmt.Errorf("login throttle dba - list locked: %w", err)
+	}
+
+	// convert to response
+
+	trs := []*model.LoginThrottleResponse{}
+	for _, tdb := range tdbs {
+		trs = append(trs, tdb.ToResponse())
+	}
+
+	return trs, nil
+}
+
+// Unlock forgets the failed logins of an email or client ip
+func (serv *LoginThrottleService) Unlock(ctx context.Context, i *model.LoginUnlockInput) error {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for login unlock: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	err := dba.DeleteLoginThrottle(ctx, serv.db, i.Scope, model.LoginThrottleKey(i.Key))
+	if err != nil {
+		return fmt.Errorf("login throttle dba - delete: %w", err)
+	}
+
+	return nil
+}
+
+// wait is how long the email and client ip of a login have to wait before
+// they may try again
+func (serv *LoginThrottleService) wait(ctx context.Context, keys map[string]string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+
+	for scope, key := range keys {
+		t, err := dba.GetLoginThrottle(ctx, serv.db, scope, key)
+		if err != nil {
+			return 0, fmt.Errorf("login throttle dba - get: %w", err)
+		}
+		wait = max(wait, t.Wait(now))
+	}
+
+	return wait, nil
+}
+
+// failed counts a failed login against its email and client ip, and locks
+// out those over the limit; it reports whether this failure locked any out
+func (serv *LoginThrottleService) failed(ctx context.Context, keys map[string]string) (bool, error) {
+	lockedOut := false
+
+	for scope, key := range keys {
+		t, err := dba.RecordLoginFailure(ctx, serv.db, scope, key, model.LoginFailureWindow)
+		if err != nil {
+			return false, fmt.Errorf("login throttle dba - record failure: %w", err)
+		}
+
+		if t.LockedUntil == nil && t.Failures >= serv.policy.MaxFailures(scope) {
+			err = dba.LockLoginThrottle(ctx, serv.db, scope, key, time.Now().Add(serv.policy.Lockout))
+			if err != nil {
+				return false, fmt.Errorf("login throttle dba - lock: %w", err)
+			}
+			lockedOut = true
+		}
+	}
+
+	return lockedOut, nil
+}
+
+// forgive forgets the failures of the account's email once its login is
+// complete; the ip's stay, so knowing one password doesn't buy more guesses
+// at others
+func (serv *LoginThrottleService) forgive(ctx context.Context, email string) error {
+	err := dba.DeleteLoginThrottle(ctx, serv.db, model.LoginThrottleAccount, model.LoginThrottleKey(email))
+	if err != nil && errs.ErrorCode(err) != errs.ERRNOTFOUND {
+		return fmt.Errorf("login throttle dba - delete: %w", err)
+	}
+	return nil
+}
+
+// loginFailed counts a wrong password and says whether it locked the login
+// out, the same for emails with and without an account
+func (serv *UserService) loginFailed(ctx context.Context, i *model.UserLoginInput) error {
+	lockedOut, err := serv.throttles.failed(ctx, i.ThrottleKeys())
+	if err != nil {
+		return err
+	}
+
+	if lockedOut {
+		i.LockedOut = true
+		msg := model.LoginThrottledMessage(serv.throttles.policy.Lockout)
+		i.AddNonFieldError(msg)
+		return errs.Errorf(errs.ERRTOOMANY, "%s", msg)
+	}
+
+	i.AddNonFieldError("invalid email or password")
+	return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed: %q", i.NonFieldErrors)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testDB connects to the migrated database in CT_TEST_DB_DSN; tests that
+// need one are skipped without it
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("CT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("CT_TEST_DB_DSN isn't set to a migrated database")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// wrongTOTPCode is a code that isn't valid for the secret right now
+func wrongTOTPCode(secret string) string {
+	for n := 0; ; n++ {
+		code := fmt.Sprintf("%06d", n)
+		if _, ok := model.ValidateTOTP(secret, code, time.Now(), 0); !ok {
+			return code
+		}
+	}
+}
+
+func TestTwoFactorLoginLockout(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	policy := model.LoginThrottlePolicy{MaxAccountFailures: 5, MaxIPFailures: 100, Lockout: time.Hour}
+	throttles := NewLoginThrottleService(db, policy)
+	users := NewUserService(db, nil, throttles)
+	twoFactor := NewTwoFactorService(db, throttles)
+
+	const password = "correct horse battery"
+	const ip = "192.0.2.1"
+	email := fmt.Sprintf("lockout-%d@example.com", time.Now().UnixNano())
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	udb, err := dba.CreateUser(ctx, db, &model.UserCreateParams{Name: "lockout", Email: email, PasswordHash: hash, Activated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM users WHERE id = $1`, udb.ID)
+		db.Exec(`DELETE FROM login_throttles WHERE (scope, key) IN (('account', $1), ('ip', $2))`, email, ip)
+	})
+
+	key, err := model.NewTOTPKey(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dba.SetUserTOTP(ctx, db, udb.ID, key.Secret(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := wrongTOTPCode(key.Secret())
+
+	login := func() error {
+		_, err := users.Login(ctx, &model.UserLoginInput{Email: email, PasswordPlaintext: password, IP: ip})
+		return err
+	}
+	verify := func(code string) (*model.TwoFactorLoginInput, error) {
+		i := &model.TwoFactorLoginInput{UserID: udb.ID, Code: code, IP: ip}
+		_, err := twoFactor.Verify(ctx, i)
+		return i, err
+	}
+
+	// someone with the password logs in again for every guess at the code,
+	// waiting out the delays between failures
+	for n := 1; n <= policy.MaxAccountFailures; n++ {
+		err = login()
+		if err != nil {
+			t.Fatalf("login before guess %d: %v", n, err)
+		}
+
+		i, err := verify(wrong)
+		want := errs.ERRUNPROCESSABLE
+		if n == policy.MaxAccountFailures {
+			want = errs.ERRTOOMANY
+		}
+		if errs.ErrorCode(err) != want {
+			t.Fatalf("guess %d: %v; want %s", n, err, want)
+		}
+		if i.LockedOut != (n == policy.MaxAccountFailures) {
+			t.Errorf("guess %d: locked out %t", n, i.LockedOut)
+		}
+
+		_, err = db.Exec(`UPDATE login_throttles SET last_failure_at = last_failure_at - interval '2 minutes' WHERE (scope, key) IN (('account', $1), ('ip', $2))`, email, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the lockout holds for the password and the right code alike
+	err = login()
+	if errs.ErrorCode(err) != errs.ERRTOOMANY {
+		t.Errorf("login after lockout: %v; want %s", err, errs.ERRTOOMANY)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verify(code)
+	if errs.ErrorCode(err) != errs.ERRTOOMANY {
+		t.Errorf("right code after lockout: %v; want %s", err, errs.ERRTOOMANY)
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TwoFactorService struct {
+	db        *sql.DB
+	throttles *LoginThrottleService
+}
+
+func NewTwoFactorService(db *sql.DB, throttles *LoginThrottleService) *TwoFactorService {
+	return &TwoFactorService{
+		db:        db,
+		throttles: throttles,
+	}
+}
+
+// Status tells whether the user has 2fa on and how many recovery codes are left
+func (serv *TwoFactorService) Status(ctx context.Context, userID int64) (*model.TwoFactorResponse, error) {
+	// interact with db
+
+	udb, err := dba.GetUser(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - two-factor status: %w", err)
+	}
+
+	n, err := dba.CountRecoveryCodes(ctx, serv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("two-factor dba - count recovery codes: %w", err)
+	}
+
+	// convert to response
+
+	return &model.TwoFactorResponse{
+		Enabled:           udb.TwoFactorEnabled,
+		RecoveryCodesLeft: n,
+	}, nil
+}
+
+// Enable confirms the secret from the QR code with a code from the
+// authenticator app, turns 2fa on and hands out a fresh set of recovery codes
+func (serv *TwoFactorService) Enable(ctx context.Context, i *model.TwoFactorEnableInput) (*model.RecoveryCodesResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for two-factor enable: %q", i.FieldErrors)
+	}
+
+	secret, err := i.Secret()
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := model.ValidateTOTP(secret, i.NormalizedCode(), time.Now(), 0)
+	if !ok {
+		i.AddFieldError("code", "this code is not valid; check the time on your device")
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for two-factor enable: %q", i.FieldErrors)
+	}
+
+	codes, hashes, err := model.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = dba.SetUserTOTP(ctx, tx, i.ID, secret, step)
+	if err != nil {
+		return nil, fmt.Errorf("two-factor dba - enable: %w", err)
+	}
+
+	err = dba.ReplaceRecoveryCodes(ctx, tx, i.ID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("two-factor dba - replace recovery codes: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return &model.RecoveryCodesResponse{Codes: codes}, nil
+}
+
+// Disable checks the password and turns 2fa off, dropping the recovery codes
+func (serv *TwoFactorService) Disable(ctx context.Context, i *model.TwoFactorPasswordInput) error {
+	// validate
+
+	err := serv.checkPassword(ctx, i)
+	if err != nil {
+		return err
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = dba.SetUserTOTP(ctx, tx, i.ID, "", 0)
+	if err != nil {
+		return fmt.Errorf("two-factor dba - disable: %w", err)
+	}
+
+	err = dba.DeleteRecoveryCodes(ctx, tx, i.ID)
+	if err != nil {
+		return fmt.Errorf("two-factor dba - delete recovery codes: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes checks the password and replaces the user's recovery
+// codes, used or not, with a new set
+func (serv *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, i *model.TwoFactorPasswordInput) (*model.RecoveryCodesResponse, error) {
+	// validate
+
+	err := serv.checkPassword(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := model.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// recovery codes are only any use with 2fa on
+	_, err = dba.GetUserTOTP(ctx, tx, i.ID)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			return nil, errs.Errorf(errs.ERRCONFLICT, "two-factor authentication is not enabled")
+		}
+		return nil, fmt.Errorf("two-factor dba - regenerate recovery codes: %w", err)
+	}
+
+	err = dba.ReplaceRecoveryCodes(ctx, tx, i.ID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("two-factor dba - replace recovery codes: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return &model.RecoveryCodesResponse{Codes: codes}, nil
+}
+
+// Verify is the second login step. It takes a code from the authenticator
+// app, which can't be used twice, or one of the recovery codes, which is used
+// up. Wrong codes count against the account and client ip like wrong
+// passwords, so logging in again doesn't buy more guesses
+func (serv *TwoFactorService) Verify(ctx context.Context, i *model.TwoFactorLoginInput) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for two-factor login: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	udb, err := dba.GetUser(ctx, serv.db, i.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - verify: %w", err)
+	}
+	keys := model.LoginThrottleKeys(udb.Email, i.IP)
+
+	// a lockout that started after the password was checked still applies
+	wait, err := serv.throttles.wait(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		msg := model.LoginThrottledMessage(wait)
+		i.AddNonFieldError(msg)
+		return nil, errs.Errorf(errs.ERRTOOMANY, "%s", msg)
+	}
+
+	t, err := dba.GetUserTOTP(ctx, serv.db, i.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("two-factor dba - verify: %w", err)
+	}
+
+	if i.IsRecoveryCode() {
+		err = dba.ConsumeRecoveryCode(ctx, serv.db, i.UserID, model.HashToken(i.NormalizedCode()))
+	} else if step, ok := model.ValidateTOTP(t.Secret, i.NormalizedCode(), time.Now(), t.LastStep); ok {
+		err = dba.UseUserTOTPStep(ctx, serv.db, i.UserID, step)
+	} else {
+		err = errs.Errorf(errs.ERRNOTFOUND, "two-factor code does not match")
+	}
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRNOTFOUND, errs.ERRCONFLICT:
+			return nil, serv.codeFailed(ctx, i, keys)
+		default:
+			return nil, fmt.Errorf("two-factor dba - verify: %w", err)
+		}
+	}
+
+	// the login is complete, so the account's failures are forgiven
+	err = serv.throttles.forgive(ctx, udb.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// codeFailed counts a wrong code and says whether it locked the login out
+func (serv *TwoFactorService) codeFailed(ctx context.Context, i *model.TwoFactorLoginInput, keys map[string]string) error {
+	lockedOut, err := serv.throttles.failed(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	if lockedOut {
+		i.LockedOut = true
+		msg := model.LoginThrottledMessage(serv.throttles.policy.Lockout)
+		i.AddNonFieldError(msg)
+		return errs.Errorf(errs.ERRTOOMANY, "%s", msg)
+	}
+
+	i.AddFieldError("code", "this code is not valid")
+	return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for two-factor login: %q", i.FieldErrors)
+}
+
+func (serv *TwoFactorService) checkPassword(ctx context.Context, i *model.TwoFactorPasswordInput) error {
+	i.Validate()
+
+	if !i.Valid() {
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for two-factor password: %q", i.FieldErrors)
+	}
+
+	udb, err := dba.GetUser(ctx, serv.db, i.ID)
+	if err != nil {
+		return fmt.Errorf("user dba - check password: %w", err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(udb.PasswordHash, []byte(i.PasswordPlaintext))
+	if err != nil {
+		i.AddFieldError("password", "this is not your current password")
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for two-factor password: %q", i.FieldErrors)
+	}
+
+	return nil
+}
@@ -3,20 +3,28 @@ package service
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/mailer"
 	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct {
-	db *sql.DB
+	db        *sql.DB
+	mailer    mailer.Mailer
+	throttles *LoginThrottleService
 }
 
-func NewUserService(db *sql.DB) *UserService {
+func NewUserService(db *sql.DB, mlr mailer.Mailer, throttles *LoginThrottleService) *UserService {
 	return &UserService{
-		db: db,
+		db:        db,
+		mailer:    mlr,
+		throttles: throttles,
 	}
 }
 
@@ -60,8 +68,12 @@ func (serv *UserService) Signup(ctx context.Context, i *model.UserCreateInput) (
 		return nil, err
 	}
 
-	// add initial permissions
-	err = dba.AddPermissionsForUser(ctx, tx, user.ID, model.PermissionCodes{"beans:read", "roasters:read"})
+	// the initial role goes with the account, so one never exists without it;
+	// the handler has the enforcer load it
+	err = dba.AddRoleForUser(ctx, tx, user.ID, model.RoleUser)
+	if err != nil {
+		return nil, fmt.Errorf("permission dba - add role: %w", err)
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -86,20 +98,43 @@ func (serv *UserService) Login(ctx context.Context, i *model.UserLoginInput) (*m
 
 	// interact with db
 
-	// get existing user
-	udb, err := dba.GetUserByEmail(ctx, serv.db, i.Email)
+	// turn away emails and ips with too many failures before hashing anything
+	wait, err := serv.throttles.wait(ctx, i.ThrottleKeys())
 	if err != nil {
-		// TODO: add to nonfield errors
 		return nil, err
 	}
+	if wait > 0 {
+		msg := model.LoginThrottledMessage(wait)
+		i.AddNonFieldError(msg)
+		return nil, errs.Errorf(errs.ERRTOOMANY, "%s", msg)
+	}
 
-	// check plaintext against hash
-	err = bcrypt.CompareHashAndPassword(udb.PasswordHash, []byte(i.PasswordPlaintext))
-	if err != nil {
-		// TODO: add to nonfield errors
+	// get existing user; unknown emails are checked against a dummy hash
+	hash := dummyPasswordHash()
+	udb, err := dba.GetUserByEmail(ctx, serv.db, i.Email)
+	switch {
+	case err == nil:
+		hash = udb.PasswordHash
+	case errs.ErrorCode(err) != errs.ERRNOTFOUND:
 		return nil, err
 	}
 
+	// check plaintext against hash
+	err = bcrypt.CompareHashAndPassword(hash, []byte(i.PasswordPlaintext))
+	if err != nil || udb == nil {
+		return nil, serv.loginFailed(ctx, i)
+	}
+
+	// the account's failures are forgiven once the login is complete; with
+	// 2fa on that's after the code, or wrong codes would start over with
+	// every login
+	if !udb.TwoFactorEnabled {
+		err = serv.throttles.forgive(ctx, i.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// convert to response
 
 	ur := udb.ToResponse()
@@ -107,6 +142,618 @@ func (serv *UserService) Login(ctx context.Context, i *model.UserLoginInput) (*m
 	return ur, nil // is returning the user useful?
 }
 
+// SendActivation emails the user a new activation token, replacing any earlier
+// ones; activateURL is the page that takes the token
+func (serv *UserService) SendActivation(ctx context.Context, userID int64, activateURL string) error {
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	udb, err := dba.GetUser(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("user dba - send activation: %w", err)
+	}
+	if udb.Activated {
+		return errs.Errorf(errs.ERRCONFLICT, "user account is already activated")
+	}
+
+	utp, err := model.NewActivationToken(userID)
+	if err != nil {
+		return fmt.Errorf("user - generate activation token: %w", err)
+	}
+
+	err = dba.DeleteUserTokens(ctx, tx, userID, model.ScopeActivation)
+	if err != nil {
+		return fmt.Errorf("user token dba - delete: %w", err)
+	}
+
+	err = dba.CreateUserToken(ctx, tx, utp)
+	if err != nil {
+		return fmt.Errorf("user token dba - create: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// send email
+
+	data := &model.ActivationEmailData{
+		Name:          udb.Name,
+		Token:         utp.Plaintext,
+		ActivationURL: activateURL + "?" + url.Values{"token": {utp.Plaintext}}.Encode(),
+		ExpiresAt:     utp.ExpiresAt,
+	}
+
+	msg, err := mailer.NewMessage(udb.Email, "user_activation.tmpl", data)
+	if err != nil {
+		return fmt.Errorf("user - render activation email: %w", err)
+	}
+
+	err = serv.mailer.Send(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("user - send activation email: %w", err)
+	}
+
+	return nil
+}
+
+// Activate uses up an activation token and activates its user
+func (serv *UserService) Activate(ctx context.Context, i *model.UserActivateInput) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user activation: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, err := dba.ConsumeUserToken(ctx, tx, model.HashToken(i.Token), model.ScopeActivation)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			i.AddFieldError("token", "this activation token is invalid, expired or already used")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user activation: %q", i.FieldErrors)
+		}
+		return nil, fmt.Errorf("user token dba - consume: %w", err)
+	}
+
+	udb, err := dba.ActivateUser(ctx, tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - activate: %w", err)
+	}
+
+	// other outstanding activation links are useless now
+	err = dba.DeleteUserTokens(ctx, tx, userID, model.ScopeActivation)
+	if err != nil {
+		return nil, fmt.Errorf("user token dba - delete: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// SendPasswordReset emails a password reset link if an account uses the email.
+// Unknown emails aren't an error, so callers can't tell whether one is registered
+func (serv *UserService) SendPasswordReset(ctx context.Context, i *model.UserPasswordForgotInput, resetURL string) error {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for password forgot: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	udb, err := dba.GetUserByEmail(ctx, tx, i.Email)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			return nil
+		}
+		return fmt.Errorf("user dba - send password reset: %w", err)
+	}
+
+	utp, err := model.NewPasswordResetToken(udb.ID)
+	if err != nil {
+		return fmt.Errorf("user - generate password reset token: %w", err)
+	}
+
+	// only the latest link works
+	err = dba.DeleteUserTokens(ctx, tx, udb.ID, model.ScopePasswordReset)
+	if err != nil {
+		return fmt.Errorf("user token dba - delete: %w", err)
+	}
+
+	err = dba.CreateUserToken(ctx, tx, utp)
+	if err != nil {
+		return fmt.Errorf("user token dba - create: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// send email
+
+	data := &model.PasswordResetEmailData{
+		Name:      udb.Name,
+		ResetURL:  resetURL + "?" + url.Values{"token": {utp.Plaintext}}.Encode(),
+		ExpiresAt: utp.ExpiresAt,
+	}
+
+	msg, err := mailer.NewMessage(udb.Email, "user_password_reset.tmpl", data)
+	if err != nil {
+		return fmt.Errorf("user - render password reset email: %w", err)
+	}
+
+	err = serv.mailer.Send(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("user - send password reset email: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword uses up a password reset token and sets the new password of its
+// user; signing the user out of existing sessions is left to the caller
+func (serv *UserService) ResetPassword(ctx context.Context, i *model.UserPasswordResetInput) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for password reset: %q", i.FieldErrors)
+	}
+
+	hash, err := i.ToParams()
+	if err != nil {
+		// conversion can fail at hashing of password, but shouldn't bc validation
+		return nil, err
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, err := dba.ConsumeUserToken(ctx, tx, model.HashToken(i.Token), model.ScopePasswordReset)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			i.AddFieldError("token", "this reset link is invalid, expired or already used")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for password reset: %q", i.FieldErrors)
+		}
+		return nil, fmt.Errorf("user token dba - consume: %w", err)
+	}
+
+	udb, err := dba.UpdateUserPassword(ctx, tx, userID, 0, hash)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - reset password: %w", err)
+	}
+
+	err = dba.DeleteUserTokens(ctx, tx, userID, model.ScopePasswordReset)
+	if err != nil {
+		return nil, fmt.Errorf("user token dba - delete: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// ChangeName sets the display name of a user
+func (serv *UserService) ChangeName(ctx context.Context, i *model.UserNameEditInput) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user name edit: %q", i.FieldErrors)
+	}
+
+	unp := i.ToParams()
+
+	// interact with db
+
+	udb, err := dba.UpdateUserName(ctx, serv.db, unp)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - change name: %w", err)
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// ChangeEmail stores the new email as pending and emails it a confirmation
+// link; confirmURL is the page that takes the token
+func (serv *UserService) ChangeEmail(ctx context.Context, i *model.UserEmailEditInput, confirmURL string) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user email edit: %q", i.FieldErrors)
+	}
+
+	uep := i.ToParams()
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := dba.GetUserByEmail(ctx, tx, uep.Email)
+	switch {
+	case err == nil && existing.ID == uep.ID:
+		i.AddFieldError("email", "this is already your email")
+	case err == nil:
+		i.AddFieldError("email", "this email is already in use")
+	case errs.ErrorCode(err) != errs.ERRNOTFOUND:
+		return nil, fmt.Errorf("user dba - change email: %w", err)
+	}
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user email edit: %q", i.FieldErrors)
+	}
+
+	udb, err := dba.SetUserPendingEmail(ctx, tx, uep)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - change email: %w", err)
+	}
+
+	utp, err := model.NewEmailChangeToken(udb.ID)
+	if err != nil {
+		return nil, fmt.Errorf("user - generate email change token: %w", err)
+	}
+
+	// links sent to earlier pending emails stop working
+	err = dba.DeleteUserTokens(ctx, tx, udb.ID, model.ScopeEmailChange)
+	if err != nil {
+		return nil, fmt.Errorf("user token dba - delete: %w", err)
+	}
+
+	err = dba.CreateUserToken(ctx, tx, utp)
+	if err != nil {
+		return nil, fmt.Errorf("user token dba - create: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// send email to the new address
+
+	data := &model.EmailChangeEmailData{
+		Name:       udb.Name,
+		Email:      udb.PendingEmail,
+		ConfirmURL: confirmURL + "?" + url.Values{"token": {utp.Plaintext}}.Encode(),
+		ExpiresAt:  utp.ExpiresAt,
+	}
+
+	msg, err := mailer.NewMessage(udb.PendingEmail, "user_email_change.tmpl", data)
+	if err != nil {
+		return nil, fmt.Errorf("user - render email change email: %w", err)
+	}
+
+	err = serv.mailer.Send(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("user - send email change email: %w", err)
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// ConfirmEmail uses up an email change token and switches its user to their pending email
+func (serv *UserService) ConfirmEmail(ctx context.Context, i *model.UserEmailConfirmInput) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for email confirmation: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, err := dba.ConsumeUserToken(ctx, tx, model.HashToken(i.Token), model.ScopeEmailChange)
+	if err != nil {
+		if errs.ErrorCode(err) == errs.ERRNOTFOUND {
+			i.AddFieldError("token", "this confirmation link is invalid, expired or already used")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for email confirmation: %q", i.FieldErrors)
+		}
+		return nil, fmt.Errorf("user token dba - consume: %w", err)
+	}
+
+	udb, err := dba.ConfirmUserPendingEmail(ctx, tx, userID)
+	if err != nil {
+		switch errs.ErrorCode(err) {
+		case errs.ERRCONFLICT:
+			i.AddFieldError("token", "another account started using this email since the link was sent")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for email confirmation: %q", i.FieldErrors)
+		case errs.ERRNOTFOUND:
+			i.AddFieldError("token", "this confirmation link is invalid, expired or already used")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for email confirmation: %q", i.FieldErrors)
+		}
+		return nil, fmt.Errorf("user dba - confirm email: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// ChangePassword sets a new password after checking the current one; signing
+// out other sessions is left to the caller
+func (serv *UserService) ChangePassword(ctx context.Context, i *model.UserPasswordEditInput) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user password edit: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := dba.GetUser(ctx, tx, i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - change password: %w", err)
+	}
+
+	if !i.Reauthenticated {
+		err = bcrypt.CompareHashAndPassword(current.PasswordHash, []byte(i.CurrentPassword))
+		if err != nil {
+			i.AddFieldError("current_password", "this is not your current password")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for user password edit: %q", i.FieldErrors)
+		}
+	}
+
+	hash, err := i.ToParams()
+	if err != nil {
+		// conversion can fail at hashing of password, but shouldn't bc validation
+		return nil, err
+	}
+
+	udb, err := dba.UpdateUserPassword(ctx, tx, i.ID, i.Version, hash)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - change password: %w", err)
+	}
+
+	// reset links sent before the change would undo it
+	err = dba.DeleteUserTokens(ctx, tx, i.ID, model.ScopePasswordReset)
+	if err != nil {
+		return nil, fmt.Errorf("user token dba - delete: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// ScheduleDeletion checks the password and schedules the account to be deleted
+// once the grace period is over; until then it can be cancelled
+func (serv *UserService) ScheduleDeletion(ctx context.Context, i *model.AccountDeleteInput, grace time.Duration) (*model.UserResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for account delete: %q", i.FieldErrors)
+	}
+
+	// interact with db
+
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := dba.GetUser(ctx, tx, i.ID)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - schedule deletion: %w", err)
+	}
+
+	if !i.Reauthenticated {
+		err = bcrypt.CompareHashAndPassword(current.PasswordHash, []byte(i.PasswordPlaintext))
+		if err != nil {
+			i.AddFieldError("password", "this is not your current password")
+			return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for account delete: %q", i.FieldErrors)
+		}
+	}
+
+	// asking again doesn't push the date back
+	if current.DeletionScheduledAt != nil {
+		return current.ToResponse(), nil
+	}
+
+	at := time.Now().Add(grace)
+	udb, err := dba.ScheduleUserDeletion(ctx, tx, i.ID, &at)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - schedule deletion: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+func (serv *UserService) CancelDeletion(ctx context.Context, id int64) (*model.UserResponse, error) {
+	// interact with db
+
+	udb, err := dba.ScheduleUserDeletion(ctx, serv.db, id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - cancel deletion: %w", err)
+	}
+
+	// convert to response
+
+	return udb.ToResponse(), nil
+}
+
+// DeleteScheduled deletes every account whose grace period is over and returns
+// their ids and the session store tokens of their sessions. Beans and roasters
+// don't record who added them, so there's nothing to anonymize; everything else
+// of the user is removed by cascading deletes
+func (serv *UserService) DeleteScheduled(ctx context.Context) ([]int64, []string, error) {
+	tx, err := serv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// the session records would cascade too, but their tokens are needed
+	tokens, err := dba.DeleteUserSessionsForScheduledUsers(ctx, tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("session dba - delete for scheduled users: %w", err)
+	}
+
+	ids, err := dba.DeleteScheduledUsers(ctx, tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("user dba - delete scheduled: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ids, tokens, nil
+}
+
+// Export collects everything stored about a user, except their sessions which
+// live in the session store
+func (serv *UserService) Export(ctx context.Context, id int64) (*model.AccountExport, error) {
+	// interact with db
+
+	// one snapshot, so the files agree with each other
+	tx, err := serv.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	udb, err := dba.GetUser(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user dba - export: %w", err)
+	}
+
+	pcs, err := dba.GetPermissionsForUser(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("permission dba - export: %w", err)
+	}
+
+	ssdbs, err := dba.GetSavedSearchesForUser(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("saved search dba - export: %w", err)
+	}
+
+	ndbs, err := dba.GetNotificationsForUser(ctx, tx, id, 0)
+	if err != nil {
+		return nil, fmt.Errorf("notification dba - export: %w", err)
+	}
+
+	atdbs, err := dba.GetAPITokensForUser(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("api token dba - export: %w", err)
+	}
+
+	pkdbs, err := dba.GetPasskeysForUser(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("passkey dba - export: %w", err)
+	}
+
+	uids, err := dba.GetUserIdentitiesForUser(ctx, tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("identity dba - export: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert to response
+
+	return model.NewAccountExport(udb, pcs, ssdbs, ndbs, atdbs, pkdbs, uids), nil
+}
+
+// PruneTokens deletes expired user tokens of every scope
+func (serv *UserService) PruneTokens(ctx context.Context) (int64, error) {
+	n, err := dba.DeleteExpiredUserTokens(ctx, serv.db)
+	if err != nil {
+		return 0, fmt.Errorf("user token dba - prune: %w", err)
+	}
+	return n, nil
+}
+
 func (serv *UserService) GetPermissions(ctx context.Context, id int64) (model.PermissionCodes, error) {
 	pcs, err := dba.GetPermissionsForUser(ctx, serv.db, id)
 	if err != nil {
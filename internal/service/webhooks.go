@@ -0,0 +1,273 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/dba"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/errs"
+	"github.com/patrickarmengol/somethingsomethingcoffee/internal/model"
+)
+
+// how many deliveries are shown in the log of a webhook
+const webhookDeliveryLogLimit = 50
+
+// how long a claimed delivery is reserved before another worker may retry it
+const webhookDeliveryLease = 5 * time.Minute
+
+type WebhookService struct {
+	db     *sql.DB
+	client *http.Client
+}
+
+func NewWebhookService(db *sql.DB) *WebhookService {
+	return &WebhookService{
+		db: db,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// subscribers must answer themselves
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (serv *WebhookService) Create(ctx context.Context, i *model.WebhookCreateInput) (*model.WebhookResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for webhook create: %q", i.FieldErrors)
+	}
+
+	wcp, err := i.ToParams()
+	if err != nil {
+		return nil, fmt.Errorf("webhook - generate secret: %w", err)
+	}
+
+	// interact with db
+
+	wdb, err := dba.CreateWebhook(ctx, serv.db, wcp)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - create: %w", err)
+	}
+
+	// convert to response
+
+	return wdb.ToResponse(), nil
+}
+
+func (serv *WebhookService) Get(ctx context.Context, id int64) (*model.WebhookResponse, error) {
+	// interact with db
+
+	wdb, err := dba.GetWebhook(ctx, serv.db, id)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - get: %w", err)
+	}
+
+	// convert to response
+
+	return wdb.ToResponse(), nil
+}
+
+func (serv *WebhookService) List(ctx context.Context) ([]*model.WebhookResponse, error) {
+	// interact with db
+
+	wdbs, err := dba.GetWebhooks(ctx, serv.db)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - list: %w", err)
+	}
+
+	// convert to response
+
+	wrs := []*model.WebhookResponse{}
+	for _, wdb := range wdbs {
+		wrs = append(wrs, wdb.ToResponse())
+	}
+
+	return wrs, nil
+}
+
+func (serv *WebhookService) Update(ctx context.Context, i *model.WebhookEditInput) (*model.WebhookResponse, error) {
+	// validate
+
+	i.Validate()
+
+	if !i.Valid() {
+		return nil, errs.Errorf(errs.ERRUNPROCESSABLE, "input validation failed for webhook update: %q", i.FieldErrors)
+	}
+
+	wep := i.ToParams()
+
+	// interact with db
+
+	wdb, err := dba.UpdateWebhook(ctx, serv.db, wep)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - update: %w", err)
+	}
+
+	// convert to response
+
+	return wdb.ToResponse(), nil
+}
+
+func (serv *WebhookService) Delete(ctx context.Context, id int64) error {
+	// interact with db
+
+	err := dba.DeleteWebhook(ctx, serv.db, id)
+	if err != nil {
+		return fmt.Errorf("webhook dba - delete: %w", err)
+	}
+
+	return nil
+}
+
+// Deliveries returns the latest deliveries of a webhook, newest first
+func (serv *WebhookService) Deliveries(ctx context.Context, webhookID int64) ([]*model.WebhookDeliveryResponse, error) {
+	// interact with db
+
+	ddbs, err := dba.GetWebhookDeliveries(ctx, serv.db, webhookID, webhookDeliveryLogLimit)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - deliveries: %w", err)
+	}
+
+	// convert to response
+
+	drs := []*model.WebhookDeliveryResponse{}
+	for _, ddb := range ddbs {
+		drs = append(drs, ddb.ToResponse())
+	}
+
+	return drs, nil
+}
+
+// Redeliver queues the payload of an earlier delivery again
+func (serv *WebhookService) Redeliver(ctx context.Context, id int64, webhookID int64) (*model.WebhookDeliveryResponse, error) {
+	// interact with db
+
+	ddb, err := dba.RedeliverWebhookDelivery(ctx, serv.db, id, webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - redeliver: %w", err)
+	}
+
+	// convert to response
+
+	return ddb.ToResponse(), nil
+}
+
+// Claim reserves up to limit due deliveries for sending with Deliver
+func (serv *WebhookService) Claim(ctx context.Context, limit int) ([]*model.WebhookDeliveryJob, error) {
+	jobs, err := dba.ClaimWebhookDeliveries(ctx, serv.db, limit, webhookDeliveryLease)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dba - claim: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Deliver posts a claimed delivery and records the outcome; failed attempts are
+// retried with exponential backoff until model.WebhookMaxAttempts
+func (serv *WebhookService) Deliver(ctx context.Context, job *model.WebhookDeliveryJob) error {
+	statusCode, sendErr := serv.send(ctx, job)
+
+	p := &model.WebhookDeliveryResultParams{
+		ID:            job.ID,
+		Status:        model.WebhookDeliverySucceeded,
+		Attempts:      job.Attempts + 1,
+		NextAttemptAt: time.Now(),
+	}
+	if statusCode != 0 {
+		p.LastStatusCode = &statusCode
+	}
+	if sendErr != nil {
+		p.LastError = sendErr.Error()
+		p.Status = model.WebhookDeliveryPending
+		p.NextAttemptAt = time.Now().Add(model.WebhookRetryDelay(p.Attempts))
+		if p.Attempts >= model.WebhookMaxAttempts {
+			p.Status = model.WebhookDeliveryFailed
+		}
+	}
+
+	// record the outcome even if ctx was cancelled mid-request
+	err := dba.SetWebhookDeliveryResult(context.WithoutCancel(ctx), serv.db, p)
+	if err != nil {
+		return fmt.Errorf("webhook dba - set result: %w", err)
+	}
+
+	if sendErr != nil {
+		return fmt.Errorf("webhook %d delivery %d attempt %d: %w", job.WebhookID, job.ID, p.Attempts, sendErr)
+	}
+	return nil
+}
+
+// post the payload; returns the response status if one was received
+func (serv *WebhookService) send(ctx context.Context, job *model.WebhookDeliveryJob) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "somethingsomethingcoffee-webhooks")
+	req.Header.Set("X-Webhook-Event", job.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(job.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload(job.Secret, timestamp, job.Payload))
+
+	resp, err := serv.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload is the hex HMAC-SHA256 of "<timestamp>.<payload>" under the
+// webhook secret, sent as `X-Webhook-Signature: sha256=<hex>`
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// queue a catalog event for the subscribed webhooks, within the transaction of the change
+func enqueueWebhookEvent(ctx context.Context, dbtx dba.DBTX, event string, data any) error {
+	payload, err := json.Marshal(model.WebhookPayload{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = dba.EnqueueWebhookDeliveries(ctx, dbtx, event, payload)
+	if err != nil {
+		return fmt.Errorf("webhook dba - enqueue %s: %w", event, err)
+	}
+
+	return nil
+}
@@ -1,2 +1 @@
-DROP TABLE IF EXISTS users_permissions;
-DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS casbin_rule;
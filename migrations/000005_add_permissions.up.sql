@@ -1,16 +1,33 @@
-CREATE TABLE IF NOT EXISTS roles (
-    id bigserial PRIMARY KEY,
-    name text NOT NULL
-)
+-- the casbin policy; the same table the sql adapter would create
+CREATE TABLE IF NOT EXISTS casbin_rule (
+    p_type varchar(32) NOT NULL DEFAULT '',
+    v0 varchar(255) NOT NULL DEFAULT '',
+    v1 varchar(255) NOT NULL DEFAULT '',
+    v2 varchar(255) NOT NULL DEFAULT '',
+    v3 varchar(255) NOT NULL DEFAULT '',
+    v4 varchar(255) NOT NULL DEFAULT '',
+    v5 varchar(255) NOT NULL DEFAULT ''
+);
 
-CREATE TABLE IF NOT EXISTS users_roles (
-    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
-    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE;
-)
+CREATE INDEX IF NOT EXISTS idx_casbin_rule ON casbin_rule (p_type, v0, v1);
 
-INSERT INTO roles (name)
+-- role policies; users are given roles by id with 'g' rules
+INSERT INTO casbin_rule (p_type, v0, v1, v2)
 VALUES
-    ('guest'),
-    ('user'),
-    ('moderator'),
-    ('admin');
+    ('p', 'guest', 'beans', 'read'),
+    ('p', 'guest', 'roasters', 'read'),
+    ('p', 'user', 'beans', 'read'),
+    ('p', 'user', 'roasters', 'read'),
+    ('p', 'moderator', 'beans', 'read'),
+    ('p', 'moderator', 'beans', 'write'),
+    ('p', 'moderator', 'roasters', 'read'),
+    ('p', 'moderator', 'roasters', 'write'),
+    ('p', 'moderator', '2fa', 'require'),
+    ('p', 'admin', 'beans', 'read'),
+    ('p', 'admin', 'beans', 'write'),
+    ('p', 'admin', 'roasters', 'read'),
+    ('p', 'admin', 'roasters', 'write'),
+    ('p', 'admin', 'analytics', 'read'),
+    ('p', 'admin', 'webhooks', 'write'),
+    ('p', 'admin', 'users', 'write'),
+    ('p', 'admin', '2fa', 'require');
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS search_stats_daily;
+
+DROP TABLE IF EXISTS search_events;
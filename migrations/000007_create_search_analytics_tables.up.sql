@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS search_events (
+    id bigserial PRIMARY KEY,
+    kind text NOT NULL,
+    term text NOT NULL,
+    results integer NOT NULL,
+    session_hash text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS search_events_created_at_idx ON search_events (created_at);
+CREATE INDEX IF NOT EXISTS search_events_session_idx ON search_events (kind, term, session_hash, created_at);
+
+CREATE TABLE IF NOT EXISTS search_stats_daily (
+    day date NOT NULL,
+    kind text NOT NULL,
+    term text NOT NULL,
+    searches integer NOT NULL DEFAULT 0,
+    sessions integer NOT NULL DEFAULT 0,
+    zero_results integer NOT NULL DEFAULT 0,
+    last_results integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, kind, term)
+);
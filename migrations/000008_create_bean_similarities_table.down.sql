@@ -0,0 +1 @@
+DROP TABLE IF EXISTS bean_similarities;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS bean_similarities (
+    bean_id bigint NOT NULL REFERENCES beans (id) ON DELETE CASCADE,
+    similar_bean_id bigint NOT NULL REFERENCES beans (id) ON DELETE CASCADE,
+    score real NOT NULL,
+    computed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (bean_id, similar_bean_id)
+);
+
+CREATE INDEX IF NOT EXISTS bean_similarities_score_idx ON bean_similarities (bean_id, score DESC);
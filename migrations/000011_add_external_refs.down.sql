@@ -0,0 +1,2 @@
+ALTER TABLE beans DROP COLUMN IF EXISTS external_ref;
+ALTER TABLE roasters DROP COLUMN IF EXISTS external_ref;
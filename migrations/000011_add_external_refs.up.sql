@@ -0,0 +1,2 @@
+ALTER TABLE roasters ADD COLUMN IF NOT EXISTS external_ref text UNIQUE;
+ALTER TABLE beans ADD COLUMN IF NOT EXISTS external_ref text UNIQUE;
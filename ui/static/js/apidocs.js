@@ -0,0 +1,150 @@
+// renders the openapi document into #api-docs
+(function () {
+    const root = document.getElementById('api-docs');
+    if (!root) {
+        return;
+    }
+
+    const methodColors = {
+        get: 'is-info',
+        post: 'is-success',
+        put: 'is-warning',
+        delete: 'is-danger',
+    };
+
+    function el(tag, attrs, ...children) {
+        const node = document.createElement(tag);
+        for (const [k, v] of Object.entries(attrs || {})) {
+            node.setAttribute(k, v);
+        }
+        for (const child of children) {
+            node.append(child);
+        }
+        return node;
+    }
+
+    function refName(ref) {
+        return ref.split('/').pop();
+    }
+
+    // short type description of a schema, e.g. "string, max 50" or "array of Bean"
+    function describe(schema) {
+        if (!schema) {
+            return '';
+        }
+        if (schema.$ref) {
+            return refName(schema.$ref);
+        }
+        if (schema.allOf) {
+            return schema.allOf.map(describe).join(' & ') + constraints(schema);
+        }
+        if (schema.type === 'array') {
+            return 'array of ' + describe(schema.items);
+        }
+        let text = schema.type || 'any';
+        if (schema.format) {
+            text += ' (' + schema.format + ')';
+        }
+        if (schema.enum) {
+            text += ': ' + schema.enum.join(' | ');
+        }
+        return text + constraints(schema);
+    }
+
+    function constraints(schema) {
+        const parts = [];
+        if (schema.minLength !== undefined) parts.push('min ' + schema.minLength);
+        if (schema.maxLength !== undefined) parts.push('max ' + schema.maxLength);
+        if (schema.minimum !== undefined) parts.push('≥ ' + schema.minimum);
+        return parts.length ? ', ' + parts.join(', ') : '';
+    }
+
+    function schemaTable(name, schema) {
+        const required = schema.required || [];
+        const rows = Object.entries(schema.properties || {}).map(([field, s]) =>
+            el('tr', {},
+                el('td', {}, el('code', {}, field)),
+                el('td', {}, describe(s)),
+                el('td', {}, required.includes(field) ? 'required' : ''),
+            ));
+        if (schema.enum) {
+            rows.push(el('tr', {}, el('td', { colspan: '3' }, describe(schema))));
+        }
+        return el('div', { class: 'box', id: 'schema-' + name },
+            el('h3', { class: 'title is-5' }, name),
+            el('table', { class: 'table is-fullwidth is-narrow' }, el('tbody', {}, ...rows)));
+    }
+
+    function operation(method, path, op) {
+        const head = el('p', {},
+            el('span', { class: 'tag is-medium ' + (methodColors[method] || '') }, method.toUpperCase()),
+            ' ',
+            el('code', {}, path),
+            ' ',
+            op.summary);
+
+        const details = el('div', { class: 'content is-small mt-2' });
+        if (op['x-permission']) {
+            details.append(el('p', {}, 'Requires permission ', el('code', {}, op['x-permission'])));
+        } else if (op.security && op.security.length) {
+            details.append(el('p', {}, 'Requires a signed-in user'));
+        }
+        for (const p of op.parameters || []) {
+            details.append(el('p', {}, p.in + ' parameter ', el('code', {}, p.name), ': ', describe(p.schema),
+                p.description ? ' — ' + p.description : ''));
+        }
+        if (op.requestBody) {
+            details.append(el('p', {}, 'Body: ', describe(op.requestBody.content['application/json'].schema)));
+        }
+        const responses = el('ul');
+        for (const [status, r] of Object.entries(op.responses)) {
+            const content = r.content && r.content['application/json'];
+            let body = '';
+            if (content && content.schema.properties) {
+                body = ' — ' + Object.entries(content.schema.properties)
+                    .map(([k, s]) => k + ': ' + describe(s)).join(', ');
+            } else if (content) {
+                body = ' — ' + describe(content.schema);
+            }
+            responses.append(el('li', {}, el('strong', {}, status), ' ', r.description, body));
+        }
+        details.append(responses);
+
+        return el('div', { class: 'box' }, head, details);
+    }
+
+    function render(spec) {
+        root.replaceChildren();
+        root.append(el('p', { class: 'mb-5' }, spec.info.description));
+
+        for (const tag of spec.tags) {
+            const section = el('div', { class: 'mb-6' }, el('h2', { class: 'title is-4' }, tag.name));
+            for (const [path, item] of Object.entries(spec.paths)) {
+                for (const [method, op] of Object.entries(item)) {
+                    if (op.tags.includes(tag.name)) {
+                        section.append(operation(method, path, op));
+                    }
+                }
+            }
+            root.append(section);
+        }
+
+        const schemas = el('div', {}, el('h2', { class: 'title is-4' }, 'Schemas'));
+        for (const [name, schema] of Object.entries(spec.components.schemas)) {
+            schemas.append(schemaTable(name, schema));
+        }
+        root.append(schemas);
+    }
+
+    fetch(root.dataset.spec, { headers: { Accept: 'application/json' } })
+        .then((res) => {
+            if (!res.ok) {
+                throw new Error(res.status + ' ' + res.statusText);
+            }
+            return res.json();
+        })
+        .then(render)
+        .catch((err) => {
+            root.replaceChildren(el('div', { class: 'notification is-danger' }, 'Could not load the API spec: ' + err.message));
+        });
+})();
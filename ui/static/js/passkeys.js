@@ -0,0 +1,104 @@
+// runs the webauthn ceremonies for forms marked with data-passkey. The
+// authenticator's answer goes into the form's credential input, then htmx
+// submits the form on the passkey-ready event
+(function () {
+    function decode(value) {
+        const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        const binary = atob(base64.padEnd(base64.length + (4 - base64.length % 4) % 4, '='));
+        return Uint8Array.from(binary, (c) => c.charCodeAt(0)).buffer;
+    }
+
+    function encode(buffer) {
+        const binary = String.fromCharCode(...new Uint8Array(buffer));
+        return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function showError(message) {
+        const errorTarget = document.getElementById('htmx-error');
+        errorTarget.innerText = message;
+        errorTarget.removeAttribute('hidden');
+    }
+
+    // fetches the options for a ceremony; the server keeps the challenge
+    async function options(url) {
+        const resp = await fetch(url, { method: 'POST', credentials: 'same-origin' });
+        if (!resp.ok) {
+            throw new Error(await resp.text());
+        }
+        return (await resp.json()).publicKey;
+    }
+
+    // registers a new passkey
+    async function create() {
+        const publicKey = await options('/account/passkeys/options');
+        publicKey.challenge = decode(publicKey.challenge);
+        publicKey.user.id = decode(publicKey.user.id);
+        for (const cred of publicKey.excludeCredentials || []) {
+            cred.id = decode(cred.id);
+        }
+
+        const cred = await navigator.credentials.create({ publicKey });
+        return {
+            id: cred.id,
+            rawId: encode(cred.rawId),
+            type: cred.type,
+            authenticatorAttachment: cred.authenticatorAttachment,
+            clientExtensionResults: cred.getClientExtensionResults(),
+            response: {
+                clientDataJSON: encode(cred.response.clientDataJSON),
+                attestationObject: encode(cred.response.attestationObject),
+                transports: cred.response.getTransports ? cred.response.getTransports() : [],
+            },
+        };
+    }
+
+    // signs in with any passkey registered here
+    async function get() {
+        const publicKey = await options('/user/login/passkey/options');
+        publicKey.challenge = decode(publicKey.challenge);
+        for (const cred of publicKey.allowCredentials || []) {
+            cred.id = decode(cred.id);
+        }
+
+        const cred = await navigator.credentials.get({ publicKey });
+        return {
+            id: cred.id,
+            rawId: encode(cred.rawId),
+            type: cred.type,
+            authenticatorAttachment: cred.authenticatorAttachment,
+            clientExtensionResults: cred.getClientExtensionResults(),
+            response: {
+                clientDataJSON: encode(cred.response.clientDataJSON),
+                authenticatorData: encode(cred.response.authenticatorData),
+                signature: encode(cred.response.signature),
+                userHandle: cred.response.userHandle ? encode(cred.response.userHandle) : null,
+            },
+        };
+    }
+
+    const ceremonies = { create, get };
+
+    // listen on the document, since htmx swaps the forms out
+    document.addEventListener('submit', async function (evt) {
+        const form = evt.target;
+        const ceremony = ceremonies[form.dataset.passkey];
+        if (!ceremony) {
+            return;
+        }
+        evt.preventDefault();
+
+        if (!window.PublicKeyCredential) {
+            showError("This browser doesn't support passkeys.");
+            return;
+        }
+
+        try {
+            form.elements.credential.value = JSON.stringify(await ceremony());
+        } catch (err) {
+            // also raised when the user cancels the browser's passkey dialog
+            showError(`Passkey error: ${err.message}`);
+            return;
+        }
+        htmx.trigger(form, 'passkey-ready');
+    });
+})();